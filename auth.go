@@ -0,0 +1,44 @@
+package goapi
+
+import "time"
+
+type SignUpInput struct {
+	FirstName string `json:"first_name" binding:"required,max=50"`
+	LastName  string `json:"last_name" binding:"required,max=50"`
+	Age       int    `json:"age" binding:"min=0,max=150"`
+	Email     string `json:"email" binding:"required,email"`
+	Password  string `json:"password" binding:"required,min=8,max=72"`
+}
+
+type SignInInput struct {
+	Email    string `json:"email" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+type RefreshInput struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+type Tokens struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+}
+
+// Account holds the sign-in credentials of a user.
+type Account struct {
+	UserID       int
+	Role         Role
+	Email        string
+	PasswordHash string
+}
+
+// RefreshToken is the server-side record of an issued refresh token, keyed
+// by the token's jti claim.
+type RefreshToken struct {
+	ID        string
+	UserID    int
+	ExpiresAt time.Time
+	RevokedAt *time.Time
+}
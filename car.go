@@ -0,0 +1,51 @@
+package goapi
+
+import (
+	"errors"
+	"time"
+)
+
+type Car struct {
+	CarID int    `json:"car_id" readonly:"true"`
+	Name  string `json:"name" binding:"required,max=50"`
+	Power Power  `json:"power"`
+	Type  string `json:"type" binding:"required,max=10"`
+	Year  int    `json:"year" binding:"required,min=1886,notfuture"`
+	// Price is the list price in effect now, if the car has one.
+	Price     *Money    `json:"price,omitempty" readonly:"true"`
+	CreatedAt time.Time `json:"created_at" readonly:"true"`
+	UpdatedAt time.Time `json:"updated_at" readonly:"true"`
+	// DeletedAt is set once the car is soft deleted. Orders keep showing
+	// the cars they were placed for.
+	DeletedAt *time.Time `json:"deleted_at,omitempty" readonly:"true"`
+	// Version is bumped on every change to the car. It is its ETag.
+	Version int `json:"version" readonly:"true"`
+}
+
+// CarSortFields lists the fields the cars list can be sorted by.
+var CarSortFields = []string{"id", "name", "power", "type", "year"}
+
+type CarFilter struct {
+	Type     string
+	YearFrom *int
+	YearTo   *int
+	PowerMin *Power
+	Deleted  Deleted
+}
+
+// CarUpdate holds the fields of a car to change; nil fields stay as they
+// are.
+type CarUpdate struct {
+	Name  *string `json:"name,omitempty" binding:"omitempty,max=50"`
+	Power *Power  `json:"power,omitempty"`
+	Type  *string `json:"type,omitempty" binding:"omitempty,max=10"`
+	Year  *int    `json:"year,omitempty" binding:"omitempty,min=1886,notfuture"`
+}
+
+func (i CarUpdate) Validate() error {
+	if i.Name == nil && i.Power == nil && i.Type == nil && i.Year == nil {
+		return errors.New("no fields to update")
+	}
+
+	return nil
+}
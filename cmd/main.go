@@ -1,9 +1,20 @@
 package main
 
 import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
 	"log"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 
 	goapi "github.com/Stremilov/car-shop"
+	"github.com/Stremilov/car-shop/pkg/config"
 	"github.com/Stremilov/car-shop/pkg/handler"
 	"github.com/Stremilov/car-shop/pkg/repository"
 	"github.com/Stremilov/car-shop/pkg/service"
@@ -13,13 +24,124 @@ import (
 // @version 1.0
 // @description API documentation for test project
 
+// @securityDefinitions.apikey ApiKeyAuth
+// @in header
+// @name Authorization
+// @description Access token from /auth/sign-in, as "Bearer <token>"
+
 func main() {
-	repos := repository.NewRepository()
-	services := service.NewService(repos)
-	handlers := handler.NewHandler(services)
+	if err := run(os.Args[1:]); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// run starts the application with the given command line arguments and
+// blocks until the server fails or is stopped by SIGINT or SIGTERM.
+func run(args []string) error {
+	cfg, args, err := config.Load(args)
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+
+	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: cfg.LogLevel})))
+
+	if len(args) > 0 && args[0] != "migrate" {
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	var (
+		db    *sql.DB
+		repos *repository.Repository
+	)
+	switch cfg.Storage {
+	case "postgres":
+		db, err = repository.NewPostgresDB(cfg.DB)
+		if err != nil {
+			return fmt.Errorf("failed to initialize database: %w", err)
+		}
+		defer func() {
+			if err := db.Close(); err != nil {
+				slog.Error("Failed to close database", "error", err)
+				return
+			}
+			slog.Info("Database connections closed")
+		}()
+
+		if len(args) > 0 {
+			if err := runMigrate(db, args[1:]); err != nil {
+				return fmt.Errorf("migration failed: %w", err)
+			}
+			return nil
+		}
+
+		if err := checkSchema(db); err != nil {
+			return err
+		}
+		slog.Info("Connected to the database successfully")
+
+		repos = repository.NewRepository(db)
+	case "memory":
+		if len(args) > 0 {
+			return errors.New("migrations are only available with postgres storage")
+		}
+		slog.Info("Using in-memory storage, data will be lost on exit")
+
+		repos = repository.NewMemoryRepository()
+	}
+
+	services := service.NewService(repos, cfg)
+	if cfg.Auth.AdminEmail != "" {
+		if err := services.Authorization.EnsureAdmin(cfg.Auth.AdminEmail, cfg.Auth.AdminPassword); err != nil {
+			return fmt.Errorf("failed to ensure admin account: %w", err)
+		}
+	}
+	handlers := handler.NewHandler(services, cfg.HTTP)
+
+	// The purge is waited for before the database is closed.
+	purgeDone := make(chan struct{})
+	go func() {
+		defer close(purgeDone)
+		runPurge(ctx, services.Trash, cfg.Deletion.PurgeInterval)
+	}()
+	defer func() {
+		stop()
+		<-purgeDone
+	}()
 
 	server := new(goapi.Server)
-	if err := server.Run("8080", handlers.InitRoutesAndDB()); err != nil {
-		log.Fatalf("Error running server: %v", err)
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- server.Run(cfg.HTTP, handlers.InitRoutesAndDB())
+	}()
+	slog.Info("Server started", "port", cfg.HTTP.Port)
+
+	select {
+	case err := <-serverErr:
+		return fmt.Errorf("error running server: %w", err)
+	case <-ctx.Done():
 	}
+	stop()
+
+	slog.Info("Shutting down, waiting for in-flight requests", "timeout", cfg.HTTP.ShutdownTimeout)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.HTTP.ShutdownTimeout)
+	defer cancel()
+
+	if err := server.ShutDown(shutdownCtx); err != nil {
+		return fmt.Errorf("server did not shut down cleanly: %w", err)
+	}
+
+	if err := <-serverErr; err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("error running server: %w", err)
+	}
+
+	slog.Info("Server stopped gracefully")
+
+	return nil
 }
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func freePort(t *testing.T) string {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	return strconv.Itoa(l.Addr().(*net.TCPAddr).Port)
+}
+
+func waitForServer(t *testing.T, url string) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		resp, err := http.Get(url)
+		if err == nil {
+			resp.Body.Close()
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	t.Fatalf("server at %s did not start", url)
+}
+
+func TestRunStopsOnSignal(t *testing.T) {
+	for _, sig := range []syscall.Signal{syscall.SIGINT, syscall.SIGTERM} {
+		t.Run(sig.String(), func(t *testing.T) {
+			port := freePort(t)
+			url := "http://127.0.0.1:" + port + "/api/user/get-all"
+
+			done := make(chan error, 1)
+			go func() {
+				done <- run([]string{"-storage=memory", "-auth-jwt-secret=" + strings.Repeat("x", 32), "-payment-webhook-secret=" + strings.Repeat("y", 32), "-http-port=" + port, "-http-shutdown-timeout=5s"})
+			}()
+
+			waitForServer(t, url)
+
+			if err := syscall.Kill(syscall.Getpid(), sig); err != nil {
+				t.Fatal(err)
+			}
+
+			select {
+			case err := <-done:
+				if err != nil {
+					t.Fatalf("run returned %v, want nil", err)
+				}
+			case <-time.After(10 * time.Second):
+				t.Fatal("run did not return after the signal")
+			}
+
+			if resp, err := http.Get(url); err == nil {
+				resp.Body.Close()
+				t.Fatal("server still accepts requests after shutdown")
+			}
+		})
+	}
+}
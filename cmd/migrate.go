@@ -0,0 +1,88 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/Stremilov/car-shop/pkg/migrate"
+)
+
+// runMigrate implements the "migrate up|down|status" subcommands.
+func runMigrate(db *sql.DB, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: car-shop [flags] migrate up|down|status")
+	}
+
+	migrator, err := migrate.New(db)
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up()
+		for _, m := range applied {
+			fmt.Printf("applied %d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(applied) == 0 {
+			fmt.Println("schema is up to date")
+		}
+	case "down":
+		m, err := migrator.Down()
+		if errors.Is(err, migrate.ErrNoMigrations) {
+			fmt.Println(err)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Printf("rolled back %d_%s\n", m.Version, m.Name)
+	case "status":
+		statuses, err := migrator.Status()
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+		for _, s := range statuses {
+			appliedAt := "pending"
+			if s.Applied {
+				appliedAt = s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\n", s.Version, s.Name, appliedAt)
+		}
+		return w.Flush()
+	default:
+		return fmt.Errorf("unknown migrate command %q, expected up, down or status", args[0])
+	}
+
+	return nil
+}
+
+// checkSchema refuses to serve against a database that still has pending
+// migrations or that a newer release has migrated. It only reads the
+// database.
+func checkSchema(db *sql.DB) error {
+	migrator, err := migrate.New(db)
+	if err != nil {
+		return err
+	}
+
+	pending, err := migrator.Check()
+	if err != nil {
+		return err
+	}
+
+	if len(pending) > 0 {
+		return fmt.Errorf("database schema is behind by %d migration(s), run \"car-shop migrate up\" first", len(pending))
+	}
+
+	return nil
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/Stremilov/car-shop/pkg/service"
+)
+
+// runPurge purges the soft deleted records past the retention period right
+// away and then every interval until ctx is done.
+func runPurge(ctx context.Context, trash service.Trash, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		purged, err := trash.Purge(time.Now())
+		switch {
+		case err != nil:
+			slog.Error("Failed to purge deleted records", "error", err)
+		case purged != service.Purged{}:
+			slog.Info("Purged deleted records", "users", purged.Users, "cars", purged.Cars, "orders", purged.Orders)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
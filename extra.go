@@ -0,0 +1,18 @@
+package goapi
+
+import "time"
+
+// Extra is an accessory or service that can be ordered along with cars,
+// such as winter tyres or an extended warranty. Price is in cents of
+// Currency.
+type Extra struct {
+	ExtraID   int       `json:"extra_id" readonly:"true"`
+	Name      string    `json:"name" binding:"required,max=50"`
+	Price     int64     `json:"price" binding:"min=0" example:"49900"`
+	Currency  string    `json:"currency" binding:"required,iso4217" example:"EUR"`
+	CreatedAt time.Time `json:"created_at" readonly:"true"`
+	UpdatedAt time.Time `json:"updated_at" readonly:"true"`
+}
+
+// ExtraSortFields lists the fields the extras list can be sorted by.
+var ExtraSortFields = []string{"id", "name", "price"}
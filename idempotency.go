@@ -0,0 +1,21 @@
+package goapi
+
+import "time"
+
+// IdempotentRequest is the server-side record of a request made with an
+// Idempotency-Key, keyed by the user and the key. It keeps the response
+// to answer retries of the request with until ExpiresAt.
+type IdempotentRequest struct {
+	UserID int
+	Key    string
+	// Fingerprint identifies the method, path and body of the request, so
+	// that the key cannot be reused for a different one.
+	Fingerprint string
+	// Status is the status code of the response, or 0 while the request
+	// is still being handled.
+	Status      int
+	ContentType string
+	Location    string
+	Body        []byte
+	ExpiresAt   time.Time
+}
@@ -0,0 +1,59 @@
+package goapi
+
+import (
+	"encoding/base64"
+	"errors"
+	"strconv"
+)
+
+const (
+	DefaultPageLimit = 20
+	MaxPageLimit     = 100
+)
+
+// ListParams controls paging and ordering of the get-all endpoints. Either
+// Offset or the keyset Cursor (the ID of the last item already seen) can be
+// used, never both; a cursor needs the list to be sorted by id.
+type ListParams struct {
+	Limit  int
+	Offset int
+	Cursor int
+	Sort   string
+	Desc   bool
+}
+
+// Deleted says which records a read returns with regard to soft deletion.
+// The zero value leaves soft deleted records out.
+type Deleted int
+
+const (
+	ExcludeDeleted Deleted = iota
+	IncludeDeleted
+	OnlyDeleted
+)
+
+type Page[T any] struct {
+	Items      []T     `json:"items"`
+	NextCursor *string `json:"next_cursor"`
+	Total      int     `json:"total"`
+}
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+func EncodeCursor(id int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(id)))
+}
+
+func DecodeCursor(cursor string) (int, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, ErrInvalidCursor
+	}
+
+	id, err := strconv.Atoi(string(raw))
+	if err != nil || id <= 0 {
+		return 0, ErrInvalidCursor
+	}
+
+	return id, nil
+}
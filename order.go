@@ -0,0 +1,127 @@
+package goapi
+
+import "time"
+
+type OrderStatus string
+
+const (
+	OrderDraft            OrderStatus = "draft"
+	OrderPendingPayment   OrderStatus = "pending_payment"
+	OrderPaid             OrderStatus = "paid"
+	OrderReadyForDelivery OrderStatus = "ready_for_delivery"
+	OrderDelivered        OrderStatus = "delivered"
+	OrderCancelled        OrderStatus = "cancelled"
+	OrderRefunded         OrderStatus = "refunded"
+)
+
+// HoldsVehicles reports whether an order in status keeps the vehicles it
+// reserved. Paid orders have bought theirs, and cancelled and refunded
+// orders gave theirs back, which may have been ordered again since.
+func (s OrderStatus) HoldsVehicles() bool {
+	return s == OrderDraft || s == OrderPendingPayment
+}
+
+// Order is what a user buys in one go. Subtotal is the sum of the totals
+// of its items and Total what is left after Discount. The prices are those
+// at the time the order was placed, in cents of Currency. Orders placed
+// before cars had prices have no currency.
+type Order struct {
+	OrderID   int         `json:"order_id" readonly:"true"`
+	OrderDate string      `json:"order_date"`
+	Status    OrderStatus `json:"status" enums:"draft,pending_payment,paid,ready_for_delivery,delivered,cancelled,refunded"`
+	User      User        `json:"user"`
+	Items     []OrderItem `json:"items"`
+	Currency  string      `json:"currency,omitempty"`
+	Subtotal  int64       `json:"subtotal"`
+	Discount  int64       `json:"discount"`
+	Total     int64       `json:"total"`
+	PromoCode string      `json:"promo_code,omitempty"`
+	UpdatedAt time.Time   `json:"updated_at"`
+	// DeletedAt is set once the order is soft deleted.
+	DeletedAt *time.Time `json:"deleted_at,omitempty" readonly:"true"`
+}
+
+// SumTotals computes the total of every item and of the whole order.
+func (o *Order) SumTotals() {
+	o.Subtotal = 0
+	for i := range o.Items {
+		item := &o.Items[i]
+		item.Total = item.UnitPrice * int64(item.Quantity)
+		o.Subtotal += item.Total
+	}
+	o.Total = o.Subtotal - o.Discount
+}
+
+type OrderItemKind string
+
+const (
+	OrderItemCar   OrderItemKind = "car"
+	OrderItemExtra OrderItemKind = "extra"
+)
+
+// OrderItem is one line of an order. A car line stands for one vehicle, so
+// its quantity is always 1; extras come in any quantity. Name is the name
+// of the car or extra when the order was placed. UnitPrice is ListPrice
+// less discounts, in cents.
+type OrderItem struct {
+	ItemID int           `json:"item_id"`
+	Kind   OrderItemKind `json:"kind" enums:"car,extra"`
+	Car    *Car          `json:"car,omitempty"`
+	// VIN is the vehicle reserved for a car line. Orders placed before
+	// the inventory existed have none.
+	VIN       string `json:"vin,omitempty"`
+	ExtraID   int    `json:"extra_id,omitempty"`
+	Name      string `json:"name"`
+	ListPrice int64  `json:"list_price"`
+	UnitPrice int64  `json:"unit_price"`
+	Quantity  int    `json:"quantity"`
+	Total     int64  `json:"total"`
+}
+
+// OrderSortFields lists the fields the orders list can be sorted by.
+var OrderSortFields = []string{"id", "order_date", "status", "user_id"}
+
+type OrderFilter struct {
+	DateFrom *time.Time
+	DateTo   *time.Time
+	Status   OrderStatus
+	Deleted  Deleted
+}
+
+// OrderInput places an order. UserID defaults to the caller. CarID is a
+// shorthand for a single car in Items.
+type OrderInput struct {
+	UserID    int              `json:"user_id" binding:"omitempty,min=1"`
+	CarID     int              `json:"car_id" binding:"omitempty,min=1"`
+	Items     []OrderItemInput `json:"items" binding:"max=20,dive"`
+	PromoCode string           `json:"promo_code" binding:"omitempty,max=30"`
+}
+
+// OrderItemInput orders either Quantity vehicles of a car or Quantity of an
+// extra. Quantity defaults to 1.
+type OrderItemInput struct {
+	CarID    int `json:"car_id" binding:"omitempty,min=1"`
+	ExtraID  int `json:"extra_id" binding:"omitempty,min=1"`
+	Quantity int `json:"quantity" binding:"omitempty,min=1,max=100"`
+}
+
+// OrderUpdate holds the fields of an order that can be changed once it is
+// placed; nil fields stay as they are.
+type OrderUpdate struct {
+	Status *OrderStatus `json:"status,omitempty" enums:"draft,pending_payment,paid,ready_for_delivery,delivered,cancelled,refunded"`
+}
+
+type OrderStatusInput struct {
+	Status OrderStatus `json:"status" binding:"required,oneof=draft pending_payment paid ready_for_delivery delivered cancelled refunded"`
+	Note   string      `json:"note" binding:"max=500"`
+}
+
+// OrderStatusChange is one entry of the audit trail of an order.
+type OrderStatusChange struct {
+	OrderID   int         `json:"order_id"`
+	From      OrderStatus `json:"from"`
+	To        OrderStatus `json:"to"`
+	ChangedBy int         `json:"changed_by"`
+	ChangedAt time.Time   `json:"changed_at"`
+	Note      string      `json:"note,omitempty"`
+}
@@ -0,0 +1,37 @@
+package goapi
+
+import "time"
+
+type PaymentStatus string
+
+const (
+	PaymentPending    PaymentStatus = "pending"
+	PaymentAuthorized PaymentStatus = "authorized"
+	PaymentCaptured   PaymentStatus = "captured"
+	PaymentFailed     PaymentStatus = "failed"
+	PaymentRefunded   PaymentStatus = "refunded"
+)
+
+// Payment is one attempt to pay for an order through a payment provider.
+// Amount is the total of the order when the attempt was made, in cents of
+// Currency.
+type Payment struct {
+	PaymentID     int           `json:"payment_id"`
+	OrderID       int           `json:"order_id"`
+	Provider      string        `json:"provider"`
+	ProviderRef   string        `json:"provider_ref,omitempty"`
+	Amount        int64         `json:"amount"`
+	Currency      string        `json:"currency"`
+	Status        PaymentStatus `json:"status" enums:"pending,authorized,captured,failed,refunded"`
+	FailureReason string        `json:"failure_reason,omitempty"`
+	// IdempotencyKey is the key the client made the attempt with.
+	IdempotencyKey string    `json:"-"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// PaymentInput pays for an order with a payment method token from the
+// checkout of the provider, such as a tokenized card.
+type PaymentInput struct {
+	Token string `json:"token" binding:"required,max=200" example:"tok_visa"`
+}
@@ -0,0 +1,540 @@
+// Package config loads the application settings.
+//
+// Every setting has a dotted key (for example "http.port") and can be given,
+// from lowest to highest priority, by a built-in default, a YAML or TOML
+// config file, a CARSHOP_* environment variable or a command line flag:
+//
+//	key              http.read_timeout
+//	config file      http: {read_timeout: 10s}
+//	environment      CARSHOP_HTTP_READ_TIMEOUT=10s
+//	command line     -http-read-timeout=10s
+//
+// The config file is taken from the -config flag or the CARSHOP_CONFIG
+// variable and defaults to configs/config.yml when that file exists.
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	envPrefix         = "CARSHOP_"
+	defaultConfigFile = "configs/config.yml"
+
+	minJWTSecretLength     = 32
+	minWebhookSecretLength = 32
+)
+
+type Config struct {
+	Storage  string
+	LogLevel slog.Level
+	HTTP     HTTP
+	DB       DB
+	Auth     Auth
+	Payment  Payment
+	Deletion Deletion
+}
+
+type HTTP struct {
+	Port           string
+	ReadTimeout    time.Duration
+	WriteTimeout   time.Duration
+	MaxHeaderBytes int
+	// ShutdownTimeout bounds how long in-flight requests may run after a
+	// SIGINT or SIGTERM before the server is stopped forcibly.
+	ShutdownTimeout time.Duration
+	// IdempotencyTTL is how long the response to a request made with an
+	// Idempotency-Key is kept to answer retries with.
+	IdempotencyTTL time.Duration
+	// RequireIfMatch makes updates and deletes of users and cars without
+	// an If-Match header fail with 428 instead of overwriting blindly.
+	RequireIfMatch bool
+}
+
+type DB struct {
+	DSN             string
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+}
+
+type Auth struct {
+	// JWTSecret signs the access and refresh tokens with HMAC-SHA256.
+	JWTSecret       string
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+	// AdminEmail and AdminPassword, when set, make sure an admin account
+	// exists at startup so that roles can be handed out.
+	AdminEmail    string
+	AdminPassword string
+}
+
+type Payment struct {
+	// Provider names the payment provider. Only the fake provider for
+	// development and tests is built in so far.
+	Provider string
+	// WebhookSecret checks the signatures of the webhook calls of the
+	// provider.
+	WebhookSecret string
+}
+
+// DeletePolicy is what deleting a user, car or order does.
+type DeletePolicy string
+
+const (
+	// DeleteRestrict deletes it for good, unless something refers to it:
+	// orders to a user or car, payments to an order.
+	DeleteRestrict DeletePolicy = "restrict"
+	// DeleteSoft hides it but keeps it, for the records that refer to it
+	// and to be restored, until it is purged.
+	DeleteSoft DeletePolicy = "soft"
+)
+
+func (p DeletePolicy) validate(key string) error {
+	if p != DeleteRestrict && p != DeleteSoft {
+		return fmt.Errorf("%s must be restrict or soft, got %q", key, p)
+	}
+
+	return nil
+}
+
+type Deletion struct {
+	Users  DeletePolicy
+	Cars   DeletePolicy
+	Orders DeletePolicy
+	// Retention is how long soft deleted records are kept before they are
+	// purged for good. Zero keeps them forever.
+	Retention time.Duration
+	// PurgeInterval is how often the purge looks for records past
+	// Retention.
+	PurgeInterval time.Duration
+}
+
+func defaults() *Config {
+	return &Config{
+		Storage:  "postgres",
+		LogLevel: slog.LevelInfo,
+		HTTP: HTTP{
+			Port:            "8080",
+			ReadTimeout:     10 * time.Second,
+			WriteTimeout:    10 * time.Second,
+			MaxHeaderBytes:  1 << 20,
+			ShutdownTimeout: 15 * time.Second,
+			IdempotencyTTL:  24 * time.Hour,
+		},
+		DB: DB{
+			MaxOpenConns:    10,
+			MaxIdleConns:    5,
+			ConnMaxLifetime: 30 * time.Minute,
+		},
+		Auth: Auth{
+			AccessTokenTTL:  15 * time.Minute,
+			RefreshTokenTTL: 30 * 24 * time.Hour,
+		},
+		Payment: Payment{
+			Provider: "fake",
+		},
+		Deletion: Deletion{
+			Users:         DeleteSoft,
+			Cars:          DeleteSoft,
+			Orders:        DeleteSoft,
+			Retention:     90 * 24 * time.Hour,
+			PurgeInterval: time.Hour,
+		},
+	}
+}
+
+type setting struct {
+	key   string
+	usage string
+	set   func(c *Config, value string) error
+}
+
+var settings = []setting{
+	{"storage", "storage backend: postgres or memory", func(c *Config, v string) error {
+		c.Storage = v
+		return nil
+	}},
+	{"log_level", "log level: debug, info, warn or error", func(c *Config, v string) error {
+		return c.LogLevel.UnmarshalText([]byte(v))
+	}},
+	{"http.port", "HTTP port to listen on", func(c *Config, v string) error {
+		c.HTTP.Port = v
+		return nil
+	}},
+	{"http.read_timeout", "maximum duration for reading a request", func(c *Config, v string) error {
+		return setDuration(&c.HTTP.ReadTimeout, v)
+	}},
+	{"http.write_timeout", "maximum duration for writing a response", func(c *Config, v string) error {
+		return setDuration(&c.HTTP.WriteTimeout, v)
+	}},
+	{"http.max_header_bytes", "maximum size of request headers in bytes", func(c *Config, v string) error {
+		return setInt(&c.HTTP.MaxHeaderBytes, v)
+	}},
+	{"http.shutdown_timeout", "time allowed for in-flight requests to finish on shutdown", func(c *Config, v string) error {
+		return setDuration(&c.HTTP.ShutdownTimeout, v)
+	}},
+	{"http.idempotency_ttl", "how long responses are kept to answer retries with the same Idempotency-Key", func(c *Config, v string) error {
+		return setDuration(&c.HTTP.IdempotencyTTL, v)
+	}},
+	{"http.require_if_match", "require an If-Match header on updates and deletes of users and cars", func(c *Config, v string) error {
+		return setBool(&c.HTTP.RequireIfMatch, v)
+	}},
+	{"db.dsn", "Postgres connection string", func(c *Config, v string) error {
+		c.DB.DSN = v
+		return nil
+	}},
+	{"db.max_open_conns", "maximum number of open database connections", func(c *Config, v string) error {
+		return setInt(&c.DB.MaxOpenConns, v)
+	}},
+	{"db.max_idle_conns", "maximum number of idle database connections", func(c *Config, v string) error {
+		return setInt(&c.DB.MaxIdleConns, v)
+	}},
+	{"db.conn_max_lifetime", "maximum time a database connection may be reused", func(c *Config, v string) error {
+		return setDuration(&c.DB.ConnMaxLifetime, v)
+	}},
+	{"auth.jwt_secret", "secret used to sign JWTs, at least 32 characters", func(c *Config, v string) error {
+		c.Auth.JWTSecret = v
+		return nil
+	}},
+	{"auth.access_token_ttl", "lifetime of access tokens", func(c *Config, v string) error {
+		return setDuration(&c.Auth.AccessTokenTTL, v)
+	}},
+	{"auth.refresh_token_ttl", "lifetime of refresh tokens", func(c *Config, v string) error {
+		return setDuration(&c.Auth.RefreshTokenTTL, v)
+	}},
+	{"auth.admin_email", "email of the admin account ensured at startup", func(c *Config, v string) error {
+		c.Auth.AdminEmail = v
+		return nil
+	}},
+	{"auth.admin_password", "password for the admin account if it has to be created", func(c *Config, v string) error {
+		c.Auth.AdminPassword = v
+		return nil
+	}},
+	{"payment.provider", "payment provider: fake", func(c *Config, v string) error {
+		c.Payment.Provider = v
+		return nil
+	}},
+	{"payment.webhook_secret", "secret the payment provider signs webhooks with, at least 32 characters", func(c *Config, v string) error {
+		c.Payment.WebhookSecret = v
+		return nil
+	}},
+	{"deletion.users", "what deleting a user does: restrict or soft", func(c *Config, v string) error {
+		c.Deletion.Users = DeletePolicy(v)
+		return nil
+	}},
+	{"deletion.cars", "what deleting a car does: restrict or soft", func(c *Config, v string) error {
+		c.Deletion.Cars = DeletePolicy(v)
+		return nil
+	}},
+	{"deletion.orders", "what deleting an order does: restrict or soft", func(c *Config, v string) error {
+		c.Deletion.Orders = DeletePolicy(v)
+		return nil
+	}},
+	{"deletion.retention", "how long soft deleted records are kept before they are purged, 0 for forever", func(c *Config, v string) error {
+		return setDuration(&c.Deletion.Retention, v)
+	}},
+	{"deletion.purge_interval", "how often soft deleted records past the retention are purged", func(c *Config, v string) error {
+		return setDuration(&c.Deletion.PurgeInterval, v)
+	}},
+}
+
+func (s setting) flagName() string {
+	return strings.NewReplacer(".", "-", "_", "-").Replace(s.key)
+}
+
+func (s setting) envName() string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(s.key, ".", "_"))
+}
+
+// Load builds the configuration from the defaults, the config file, the
+// environment and the command line arguments (without the program name)
+// and validates the result. Arguments left after the flags are returned
+// as they are.
+func Load(args []string) (*Config, []string, error) {
+	fs := flag.NewFlagSet("car-shop", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: car-shop [flags] [migrate up|down|status]")
+		fs.PrintDefaults()
+	}
+	configFile := fs.String("config", "", "path to a YAML or TOML config file (env CARSHOP_CONFIG)")
+	for _, s := range settings {
+		fs.String(s.flagName(), "", fmt.Sprintf("%s (env %s)", s.usage, s.envName()))
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	cfg := defaults()
+
+	path, required := *configFile, true
+	if path == "" {
+		path, required = os.Getenv(envPrefix+"CONFIG"), true
+	}
+	if path == "" {
+		path, required = defaultConfigFile, false
+	}
+
+	if err := cfg.loadFile(path, required); err != nil {
+		return nil, nil, err
+	}
+
+	for _, s := range settings {
+		if v, ok := os.LookupEnv(s.envName()); ok {
+			if err := s.set(cfg, v); err != nil {
+				return nil, nil, fmt.Errorf("invalid %s: %w", s.envName(), err)
+			}
+		}
+	}
+
+	var flagErr error
+	fs.Visit(func(f *flag.Flag) {
+		s, ok := lookupFlag(f.Name)
+		if !ok || flagErr != nil {
+			return
+		}
+		if err := s.set(cfg, f.Value.String()); err != nil {
+			flagErr = fmt.Errorf("invalid -%s: %w", f.Name, err)
+		}
+	})
+	if flagErr != nil {
+		return nil, nil, flagErr
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, nil, err
+	}
+
+	return cfg, fs.Args(), nil
+}
+
+func (c *Config) loadFile(path string, required bool) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !required && errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("read config file: %w", err)
+	}
+
+	values := map[string]interface{}{}
+	switch ext := filepath.Ext(path); ext {
+	case ".yml", ".yaml":
+		err = yaml.Unmarshal(data, &values)
+	case ".toml":
+		err = toml.Unmarshal(data, &values)
+	default:
+		return fmt.Errorf("config file %s: unsupported format %q, use .yml, .yaml or .toml", path, ext)
+	}
+	if err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("parse config file %s: %w", path, err)
+	}
+
+	flat := map[string]string{}
+	flatten("", values, flat)
+
+	keys := make([]string, 0, len(flat))
+	for k := range flat {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		s, ok := lookup(key)
+		if !ok {
+			return fmt.Errorf("config file %s: unknown setting %q", path, key)
+		}
+		if err := s.set(c, flat[key]); err != nil {
+			return fmt.Errorf("config file %s: invalid %s: %w", path, key, err)
+		}
+	}
+
+	return nil
+}
+
+func flatten(prefix string, values map[string]interface{}, out map[string]string) {
+	for k, v := range values {
+		key := k
+		if prefix != "" {
+			key = prefix + "." + k
+		}
+
+		if nested, ok := v.(map[string]interface{}); ok {
+			flatten(key, nested, out)
+			continue
+		}
+
+		out[key] = fmt.Sprint(v)
+	}
+}
+
+func lookup(key string) (setting, bool) {
+	for _, s := range settings {
+		if s.key == key {
+			return s, true
+		}
+	}
+
+	return setting{}, false
+}
+
+func lookupFlag(name string) (setting, bool) {
+	for _, s := range settings {
+		if s.flagName() == name {
+			return s, true
+		}
+	}
+
+	return setting{}, false
+}
+
+// Validate reports every invalid setting at once.
+func (c *Config) Validate() error {
+	var errs []error
+
+	switch c.Storage {
+	case "postgres":
+		if c.DB.DSN == "" {
+			errs = append(errs, errors.New("db.dsn is required when storage is postgres, set it with CARSHOP_DB_DSN"))
+		}
+	case "memory":
+	default:
+		errs = append(errs, fmt.Errorf("storage must be postgres or memory, got %q", c.Storage))
+	}
+
+	if port, err := strconv.Atoi(c.HTTP.Port); err != nil || port < 0 || port > 65535 {
+		errs = append(errs, fmt.Errorf("http.port must be a number between 0 and 65535, got %q", c.HTTP.Port))
+	}
+
+	if c.HTTP.ReadTimeout <= 0 {
+		errs = append(errs, errors.New("http.read_timeout must be positive"))
+	}
+
+	if c.HTTP.WriteTimeout <= 0 {
+		errs = append(errs, errors.New("http.write_timeout must be positive"))
+	}
+
+	if c.HTTP.MaxHeaderBytes <= 0 {
+		errs = append(errs, errors.New("http.max_header_bytes must be positive"))
+	}
+
+	if c.HTTP.ShutdownTimeout <= 0 {
+		errs = append(errs, errors.New("http.shutdown_timeout must be positive"))
+	}
+
+	if c.HTTP.IdempotencyTTL <= 0 {
+		errs = append(errs, errors.New("http.idempotency_ttl must be positive"))
+	}
+
+	if c.DB.MaxOpenConns < 0 {
+		errs = append(errs, errors.New("db.max_open_conns must not be negative"))
+	}
+
+	if c.DB.MaxIdleConns < 0 {
+		errs = append(errs, errors.New("db.max_idle_conns must not be negative"))
+	}
+
+	if c.DB.MaxOpenConns > 0 && c.DB.MaxIdleConns > c.DB.MaxOpenConns {
+		errs = append(errs, errors.New("db.max_idle_conns must not exceed db.max_open_conns"))
+	}
+
+	if c.DB.ConnMaxLifetime < 0 {
+		errs = append(errs, errors.New("db.conn_max_lifetime must not be negative"))
+	}
+
+	switch {
+	case c.Auth.JWTSecret == "":
+		errs = append(errs, errors.New("auth.jwt_secret is required, set it with CARSHOP_AUTH_JWT_SECRET"))
+	case len(c.Auth.JWTSecret) < minJWTSecretLength:
+		errs = append(errs, fmt.Errorf("auth.jwt_secret must be at least %d characters long", minJWTSecretLength))
+	}
+
+	if c.Auth.AccessTokenTTL <= 0 {
+		errs = append(errs, errors.New("auth.access_token_ttl must be positive"))
+	}
+
+	if c.Auth.RefreshTokenTTL <= c.Auth.AccessTokenTTL {
+		errs = append(errs, errors.New("auth.refresh_token_ttl must be longer than auth.access_token_ttl"))
+	}
+
+	if c.Payment.Provider != "fake" {
+		errs = append(errs, fmt.Errorf("payment.provider must be fake, got %q", c.Payment.Provider))
+	}
+
+	switch {
+	case c.Payment.WebhookSecret == "":
+		errs = append(errs, errors.New("payment.webhook_secret is required, set it with CARSHOP_PAYMENT_WEBHOOK_SECRET"))
+	case len(c.Payment.WebhookSecret) < minWebhookSecretLength:
+		errs = append(errs, fmt.Errorf("payment.webhook_secret must be at least %d characters long", minWebhookSecretLength))
+	}
+
+	if err := c.Deletion.Users.validate("deletion.users"); err != nil {
+		errs = append(errs, err)
+	}
+
+	if err := c.Deletion.Cars.validate("deletion.cars"); err != nil {
+		errs = append(errs, err)
+	}
+
+	if err := c.Deletion.Orders.validate("deletion.orders"); err != nil {
+		errs = append(errs, err)
+	}
+
+	if c.Deletion.Retention < 0 {
+		errs = append(errs, errors.New("deletion.retention must not be negative"))
+	}
+
+	if c.Deletion.PurgeInterval <= 0 {
+		errs = append(errs, errors.New("deletion.purge_interval must be positive"))
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("invalid configuration:\n%w", err)
+	}
+
+	return nil
+}
+
+func setInt(dst *int, value string) error {
+	v, err := strconv.Atoi(value)
+	if err != nil {
+		return fmt.Errorf("%q is not an integer", value)
+	}
+	*dst = v
+
+	return nil
+}
+
+func setBool(dst *bool, value string) error {
+	v, err := strconv.ParseBool(value)
+	if err != nil {
+		return fmt.Errorf("%q is not true or false", value)
+	}
+	*dst = v
+
+	return nil
+}
+
+func setDuration(dst *time.Duration, value string) error {
+	v, err := time.ParseDuration(value)
+	if err != nil {
+		return fmt.Errorf("%q is not a duration such as 10s or 1m", value)
+	}
+	*dst = v
+
+	return nil
+}
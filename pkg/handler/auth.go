@@ -0,0 +1,107 @@
+package handler
+
+import (
+	"net/http"
+
+	goapi "github.com/Stremilov/car-shop"
+	"github.com/gin-gonic/gin"
+)
+
+// @Summary      Sign up
+// @Description  create a user account with an email and password
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param request body goapi.SignUpInput true "body"
+// @Success      201  {object}  map[string]int
+// @Failure      400,409,422,500  {object}  handler.Problem
+// @Router       /auth/sign-up [post]
+func (h *Handler) signUp(ctx *gin.Context) {
+	var input goapi.SignUpInput
+
+	if !bindJSON(ctx, &input) {
+		return
+	}
+
+	id, err := h.service.Authorization.SignUp(input)
+	if err != nil {
+		newErrorResponse(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, gin.H{"user_id": id})
+}
+
+// @Summary      Sign in
+// @Description  exchange email and password for an access and a refresh token
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param request body goapi.SignInInput true "body"
+// @Success      200  {object}  goapi.Tokens
+// @Failure      400,401,422,500  {object}  handler.Problem
+// @Router       /auth/sign-in [post]
+func (h *Handler) signIn(ctx *gin.Context) {
+	var input goapi.SignInInput
+
+	if !bindJSON(ctx, &input) {
+		return
+	}
+
+	tokens, err := h.service.Authorization.SignIn(input)
+	if err != nil {
+		newErrorResponse(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, tokens)
+}
+
+// @Summary      Refresh tokens
+// @Description  exchange a refresh token for a new token pair; the old refresh token stops working
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param request body goapi.RefreshInput true "body"
+// @Success      200  {object}  goapi.Tokens
+// @Failure      400,401,422,500  {object}  handler.Problem
+// @Router       /auth/refresh [post]
+func (h *Handler) refresh(ctx *gin.Context) {
+	var input goapi.RefreshInput
+
+	if !bindJSON(ctx, &input) {
+		return
+	}
+
+	tokens, err := h.service.Authorization.Refresh(input.RefreshToken)
+	if err != nil {
+		newErrorResponse(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, tokens)
+}
+
+// @Summary      Revoke refresh token
+// @Description  revoke a refresh token, e.g. on sign-out
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param request body goapi.RefreshInput true "body"
+// @Success      204
+// @Failure      400,401,422,500  {object}  handler.Problem
+// @Router       /auth/revoke [post]
+func (h *Handler) revoke(ctx *gin.Context) {
+	var input goapi.RefreshInput
+
+	if !bindJSON(ctx, &input) {
+		return
+	}
+
+	if err := h.service.Authorization.Revoke(input.RefreshToken); err != nil {
+		newErrorResponse(ctx, err)
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
@@ -0,0 +1,27 @@
+package handler_test
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TestAccessTokenFollowsUser uses one access token throughout: the role
+// and the deletion of its user apply to it before it expires.
+func TestAccessTokenFollowsUser(t *testing.T) {
+	s := newShop(t)
+	admin := s.signIn(adminEmail, adminPassword)
+	userID, seller := s.signUp(admin, "seller@example.com", "sales")
+	userPath := "/api/user/" + strconv.Itoa(userID)
+	car := gin.H{"name": "Golf", "power": 150, "type": "hatch", "year": 2020}
+
+	s.must(http.StatusCreated, nil, seller, http.MethodPost, "/api/car/", car)
+
+	s.must(http.StatusOK, nil, admin, http.MethodPatch, userPath, gin.H{"role": "customer"})
+	s.must(http.StatusForbidden, nil, seller, http.MethodPost, "/api/car/", car)
+
+	s.must(http.StatusOK, nil, admin, http.MethodDelete, userPath, nil)
+	s.must(http.StatusUnauthorized, nil, seller, http.MethodGet, userPath, nil)
+}
@@ -1,78 +1,106 @@
 package handler
 
 import (
-	"database/sql"
-	"fmt"
 	"net/http"
 	"strconv"
-	"strings"
 
+	goapi "github.com/Stremilov/car-shop"
 	"github.com/gin-gonic/gin"
 )
 
-type Car struct {
-	CarID int    `json:"car_id"`
-	Name  string `json:"name"`
-	Power string `json:"power"`
-	Type  string `json:"type"`
-	Year  int    `json:"year"`
-}
-
-type CarUpdate struct {
-	Name  string `json:"name"`
-	Power string `json:"power"`
-	Type  string `json:"type"`
-	Year  int    `json:"year"`
-}
-
 // @Summary      Add new car
 // @Description  add new car
 // @Tags         cars
 // @Accept       json
 // @Produce      json
-// @Success      201  {object}  Car
+// @Param request body goapi.Car true "body"
+// @Param        Idempotency-Key header string false "makes the request safe to retry: a retry with the same key and body gets the first response again"
+// @Success      201  {object}  goapi.Car
+// @Header       201  {string}  Location  "URL of the new car"
+// @Failure      400,401,403,422,500  {object}  handler.Problem
+// @Security     ApiKeyAuth
 // @Router       /api/car/ [post]
 func (h *Handler) addCar(c *gin.Context) {
-	var car Car
+	var car goapi.Car
 
-	if err := c.ShouldBindJSON(&car); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+	if !bindJSON(c, &car) {
 		return
 	}
 
-	query := `INSERT INTO cars (name, power, type, year) VALUES ($1, $2, $3, $4)`
-	_, err := db.Exec(query, car.Name, car.Power, car.Type, car.Year)
+	car, err := h.service.Car.Create(car)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to insert data into database"})
+		newErrorResponse(c, err)
 		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{"message": "Car added successfully"})
+	created(c, "/api/car/"+strconv.Itoa(car.CarID), car)
 }
 
 // @Summary      Get all cars
-// @Description  get all cars
+// @Description  get a page of cars, optionally filtered by type, year and power
 // @Tags         cars
 // @Accept       json
 // @Produce      json
-// @Success      200  {object} Car
+// @Param        limit     query  int     false  "page size (default 20, max 100)"
+// @Param        offset    query  int     false  "number of cars to skip"
+// @Param        cursor    query  string  false  "next_cursor of the previous page"
+// @Param        sort      query  string  false  "sort field, prefix with - for descending"  Enums(id, -id, name, -name, power, -power, type, -type, year, -year)
+// @Param        type      query  string  false  "car type"
+// @Param        year_from query  int     false  "earliest year"
+// @Param        year_to   query  int     false  "latest year"
+// @Param        power_min query  number  false  "minimum power, in power_unit"
+// @Param        power_unit query string  false  "unit of power in the filter and the response (default hp)"  Enums(hp, kW)
+// @Param        include_deleted query bool false "list soft deleted cars too (admins only)"
+// @Success      200  {object} goapi.Page[goapi.Car]
+// @Failure      400,401,403,422,500  {object}  handler.Problem
+// @Security     ApiKeyAuth
 // @Router       /api/car/get-all [get]
 func (h *Handler) getAllCars(ctx *gin.Context) {
-	rows, err := db.Query("SELECT name, power, type, year FROM cars")
+	params, err := parseListParams(ctx)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query database"})
+		badRequest(ctx, err.Error())
 		return
 	}
-	defer rows.Close()
 
-	var cars []Car
-	for rows.Next() {
-		var car Car
-		if err := rows.Scan(&car.Name, &car.Power, &car.Type, &car.Year); err != nil {
-			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan row"})
-			return
-		}
-		cars = append(cars, car)
+	filter := goapi.CarFilter{Type: ctx.Query("type")}
+	if filter.YearFrom, err = queryInt(ctx, "year_from"); err != nil {
+		badRequest(ctx, err.Error())
+		return
+	}
+	if filter.YearTo, err = queryInt(ctx, "year_to"); err != nil {
+		badRequest(ctx, err.Error())
+		return
+	}
+	unit, err := queryPowerUnit(ctx)
+	if err != nil {
+		badRequest(ctx, err.Error())
+		return
+	}
+	powerMin, err := queryFloat(ctx, "power_min")
+	if err != nil {
+		badRequest(ctx, err.Error())
+		return
+	}
+	if powerMin != nil {
+		filter.PowerMin = &goapi.Power{Value: *powerMin, Unit: unit}
+	}
+
+	include, ok := includeDeleted(ctx)
+	if !ok {
+		return
+	}
+	if include {
+		filter.Deleted = goapi.IncludeDeleted
+	}
+
+	cars, err := h.service.Car.GetAll(filter, params)
+	if err != nil {
+		newErrorResponse(ctx, err)
+		return
+	}
+
+	for i := range cars.Items {
+		cars.Items[i].Power = cars.Items[i].Power.In(unit)
 	}
 
 	ctx.JSON(http.StatusOK, cars)
@@ -84,67 +112,84 @@ func (h *Handler) getAllCars(ctx *gin.Context) {
 // @Accept       json
 // @Produce      json
 // @Param        carID path string true "car ID"
-// @Success      200  {object}  Car
+// @Param        power_unit query string false "unit of power in the response (default hp)"  Enums(hp, kW)
+// @Param        include_deleted query bool false "find the car even if soft deleted (admins only)"
+// @Success      200  {object}  goapi.Car
+// @Header       200  {string}  ETag  "version of the car, to send back in If-Match"
+// @Failure      400,401,403,404,500  {object}  handler.Problem
+// @Security     ApiKeyAuth
 // @Router       /api/car/{carID} [get]
 func (h *Handler) getCarByID(ctx *gin.Context) {
-	carID := ctx.Param("carID")
-
-	query := `
-	SELECT 
-		cars.name,
-		cars.power,
-		cars.type,
-		cars.year
-	FROM
-		cars
-	WHERE
-		cars.id = $1
-	`
-
-	row := db.QueryRow(query, carID)
-
-	var car Car
-	if err := row.Scan(&car.Name, &car.Power, &car.Type, &car.Year); err != nil {
-		if err == sql.ErrNoRows {
-			ctx.JSON(http.StatusNotFound, gin.H{"error": "Car not found"})
-
-			return
-		}
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to find car"})
+	carID, err := getIDParam(ctx, "carID")
+	if err != nil {
+		badRequest(ctx, "Invalid car ID")
 		return
 	}
 
+	unit, err := queryPowerUnit(ctx)
+	if err != nil {
+		badRequest(ctx, err.Error())
+		return
+	}
+
+	include, ok := includeDeleted(ctx)
+	if !ok {
+		return
+	}
+
+	getCar := h.service.Car.GetByID
+	if include {
+		getCar = h.service.Car.GetByIDWithDeleted
+	}
+
+	car, err := getCar(carID)
+	if err != nil {
+		newErrorResponse(ctx, err)
+		return
+	}
+
+	car.Power = car.Power.In(unit)
+	setETag(ctx, car.Version)
 	ctx.JSON(http.StatusOK, car)
 
 }
 
 // @Summary      Delete car by id
-// @Description  delete car by user id
+// @Description  delete a car the way the deletion policy of the server says: for good unless it was ordered (409 listing the order_ids in details) or has vehicles, or softly, keeping it for its orders and to be restored until it is purged. Admins can delete the car with its vehicles and orders with force=true. The orders go as a whole, with their lines of other cars and extras, and the vehicles of other cars they reserved go back in stock; orders with payments cannot be deleted, which is a 409
 // @Tags         cars
 // @Accept       json
 // @Produce      json
 // @Param        carID path string true "Car ID"
-// @Success      200  {object}  Car
+// @Param        force query bool   false "delete the vehicles of the car and every order of it, whole, too (admins only)"
+// @Param        If-Match header string false "ETag of the car as read, the delete fails with 412 if it changed since or does not exist"
+// @Success      200
+// @Failure      400,401,403,404,409,412,428,500  {object}  handler.Problem
+// @Security     ApiKeyAuth
 // @Router       /api/car/{carID} [delete]
 func (h *Handler) deleteCarByID(ctx *gin.Context) {
-	carID := ctx.Param("carID")
-
-	query := `DELETE FROM cars WHERE id = $1`
-
-	result, err := db.Exec(query, carID)
+	carID, err := getIDParam(ctx, "carID")
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		badRequest(ctx, "Invalid car ID")
 		return
 	}
 
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+	force, ok := forceRequested(ctx)
+	if !ok {
+		return
+	}
+
+	version, ok := h.ifMatch(ctx)
+	if !ok {
 		return
 	}
 
-	if rowsAffected == 0 {
-		ctx.JSON(http.StatusNotFound, gin.H{"error": "Car not found"})
+	deleteCar := h.service.Car.Delete
+	if force {
+		deleteCar = h.service.Car.ForceDelete
+	}
+
+	if err := deleteCar(carID, version); err != nil {
+		conditionalError(ctx, err)
 		return
 	}
 
@@ -153,61 +198,154 @@ func (h *Handler) deleteCarByID(ctx *gin.Context) {
 }
 
 // @Summary      Update car info by id
-// @Description  update car info by user id
+// @Description  update a car with a JSON merge patch (application/merge-patch+json, or plain application/json) or a JSON patch (application/json-patch+json) of the fields in the body. The fields cannot be cleared, a patch of the power unit alone converts the power, and the patched car is validated as a whole
 // @Tags         cars
-// @Accept       json
+// @Accept       json,application/merge-patch+json,application/json-patch+json
 // @Produce      json
 // @Param        carID path string true "Car ID"
-// @Param request body Car true "body"
-// @Success      201  {object}  Car
-// @Router       /api/car/{userID} [patch]
+// @Param        power_unit query string false "unit of power the patch applies to and of the response (default hp)"  Enums(hp, kW)
+// @Param        If-Match header string false "ETag of the car as read, the update fails with 412 if it changed since or does not exist"
+// @Param request body goapi.CarUpdate true "the fields that can be patched"
+// @Success      200  {object}  goapi.Car
+// @Header       200  {string}  ETag  "version of the updated car"
+// @Failure      400,401,403,404,409,412,415,422,428,500  {object}  handler.Problem
+// @Security     ApiKeyAuth
+// @Router       /api/car/{carID} [patch]
 func (h *Handler) updateCarInfoByID(ctx *gin.Context) {
-	carID := ctx.Param("carID")
+	carID, err := getIDParam(ctx, "carID")
+	if err != nil {
+		badRequest(ctx, "Invalid car ID")
+		return
+	}
 
-	var carUpdate CarUpdate
-	if err := ctx.ShouldBindJSON(&carUpdate); err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+	unit, err := queryPowerUnit(ctx)
+	if err != nil {
+		badRequest(ctx, err.Error())
 		return
 	}
 
-	values := []interface{}{}
-	setClauses := []string{}
+	version, ok := h.ifMatch(ctx)
+	if !ok {
+		return
+	}
 
-	if carUpdate.Name != "" {
-		setClauses = append(setClauses, "name = $1")
-		values = append(values, carUpdate.Name)
+	p, ok := bindPatch(ctx)
+	if !ok {
+		return
 	}
 
-	if carUpdate.Power != "" {
-		setClauses = append(setClauses, "power = $"+strconv.Itoa(len(values)+1))
-		values = append(values, carUpdate.Power)
+	car, err := h.service.Car.GetByID(carID)
+	if err != nil {
+		conditionalError(ctx, err)
+		return
 	}
 
-	if carUpdate.Type != "" {
-		setClauses = append(setClauses, "type = $"+strconv.Itoa(len(values)+1))
-		values = append(values, carUpdate.Type)
+	car.Power = car.Power.In(unit)
+	carUpdate, err := h.service.Car.ApplyPatch(car, p)
+	if err != nil {
+		newErrorResponse(ctx, err)
+		return
 	}
 
-	if carUpdate.Year != 0 {
-		setClauses = append(setClauses, "year = $"+strconv.Itoa(len(values)+1))
-		values = append(values, carUpdate.Year)
+	// A patch that changes nothing, such as one that only tests, leaves
+	// the car as is.
+	if carUpdate == (goapi.CarUpdate{}) {
+		if checkVersion(ctx, version, car.Version) {
+			setETag(ctx, car.Version)
+			ctx.JSON(http.StatusOK, car)
+		}
+		return
 	}
 
-	if len(setClauses) == 0 {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "No fields to update"})
+	// Without If-Match the patch still must not overwrite changes made
+	// since the car was read to apply it; such a change fails it with 409.
+	if version == 0 {
+		version = car.Version
+	}
+
+	car, err = h.service.Car.Update(carID, carUpdate, version)
+	if err != nil {
+		conditionalError(ctx, err)
 		return
 	}
 
-	query := fmt.Sprintf("UPDATE cars SET %s WHERE id = $%d;",
-		strings.Join(setClauses, ", "), len(values)+1)
+	car.Power = car.Power.In(unit)
+	setETag(ctx, car.Version)
+	ctx.JSON(http.StatusOK, car)
+}
 
-	values = append(values, carID)
+// @Summary      Get deleted cars
+// @Description  get a page of the soft deleted cars, which are purged for good with their vehicles once they are past the retention period and nobody ordered them
+// @Tags         cars
+// @Accept       json
+// @Produce      json
+// @Param        limit     query  int     false  "page size (default 20, max 100)"
+// @Param        offset    query  int     false  "number of cars to skip"
+// @Param        cursor    query  string  false  "next_cursor of the previous page"
+// @Param        sort      query  string  false  "sort field, prefix with - for descending"  Enums(id, -id, name, -name, power, -power, type, -type, year, -year)
+// @Param        power_unit query string  false  "unit of power in the response (default hp)"  Enums(hp, kW)
+// @Success      200  {object} goapi.Page[goapi.Car]
+// @Failure      400,401,403,422,500  {object}  handler.Problem
+// @Security     ApiKeyAuth
+// @Router       /api/car/trash [get]
+func (h *Handler) getDeletedCars(ctx *gin.Context) {
+	params, err := parseListParams(ctx)
+	if err != nil {
+		badRequest(ctx, err.Error())
+		return
+	}
 
-	_, err := db.Exec(query, values...)
+	unit, err := queryPowerUnit(ctx)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update data"})
+		badRequest(ctx, err.Error())
 		return
 	}
 
-	ctx.JSON(http.StatusOK, gin.H{"message": "Data updated successfully"})
+	cars, err := h.service.Car.GetAll(goapi.CarFilter{Deleted: goapi.OnlyDeleted}, params)
+	if err != nil {
+		newErrorResponse(ctx, err)
+		return
+	}
+
+	for i := range cars.Items {
+		cars.Items[i].Power = cars.Items[i].Power.In(unit)
+	}
+
+	ctx.JSON(http.StatusOK, cars)
+}
+
+// @Summary      Restore car
+// @Description  bring back a soft deleted car
+// @Tags         cars
+// @Accept       json
+// @Produce      json
+// @Param        carID path string true "Car ID"
+// @Param        power_unit query string false "unit of power in the response (default hp)"  Enums(hp, kW)
+// @Success      200  {object}  goapi.Car
+// @Header       200  {string}  ETag  "version of the restored car"
+// @Failure      400,401,403,404,409,500  {object}  handler.Problem
+// @Security     ApiKeyAuth
+// @Router       /api/car/{carID}/restore [post]
+func (h *Handler) restoreCar(ctx *gin.Context) {
+	carID, err := getIDParam(ctx, "carID")
+	if err != nil {
+		badRequest(ctx, "Invalid car ID")
+		return
+	}
+
+	unit, err := queryPowerUnit(ctx)
+	if err != nil {
+		badRequest(ctx, err.Error())
+		return
+	}
+
+	car, err := h.service.Car.Restore(carID)
+	if err != nil {
+		newErrorResponse(ctx, err)
+		return
+	}
+
+	car.Power = car.Power.In(unit)
+	setETag(ctx, car.Version)
+	ctx.JSON(http.StatusOK, car)
 }
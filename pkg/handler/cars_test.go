@@ -0,0 +1,34 @@
+package handler_test
+
+import (
+	"net/http"
+	"testing"
+
+	goapi "github.com/Stremilov/car-shop"
+)
+
+func TestFilterCarsByPower(t *testing.T) {
+	s := newShop(t)
+	admin := s.signIn(adminEmail, adminPassword)
+	s.addCar(admin)
+
+	for _, tt := range []struct {
+		query string
+		want  int
+	}{
+		{"power_min=149.5", 1},
+		{"power_min=150.5", 0},
+		{"power_min=111.8&power_unit=kW", 1},
+		{"power_min=111.9&power_unit=kW", 0},
+	} {
+		var page goapi.Page[goapi.Car]
+		s.must(http.StatusOK, &page, admin, http.MethodGet, "/api/car/get-all?"+tt.query, nil)
+		if page.Total != tt.want {
+			t.Errorf("%s: got %d cars, want %d", tt.query, page.Total, tt.want)
+		}
+	}
+
+	if w := s.do(admin, http.MethodGet, "/api/car/get-all?power_min=NaN", nil); w.Code != http.StatusBadRequest {
+		t.Errorf("power_min=NaN: got %d, want 400", w.Code)
+	}
+}
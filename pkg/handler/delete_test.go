@@ -0,0 +1,645 @@
+package handler_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Stremilov/car-shop/pkg/config"
+	"github.com/Stremilov/car-shop/pkg/handler"
+	"github.com/Stremilov/car-shop/pkg/repository"
+	"github.com/Stremilov/car-shop/pkg/service"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	adminEmail    = "admin@example.com"
+	adminPassword = "admin-password"
+	webhookSecret = "webhook-secret-of-the-fake-provider"
+)
+
+// shop is the whole application on in-memory storage, driven through its
+// HTTP API. The deletions on the Postgres repositories are tested in
+// package repository, against a test database.
+type shop struct {
+	t        *testing.T
+	router   *gin.Engine
+	services *service.Service
+}
+
+func newShop(t *testing.T, args ...string) *shop {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	cfg, _, err := config.Load(append([]string{"-storage=memory", "-auth-jwt-secret=" + strings.Repeat("x", 32), "-payment-webhook-secret=" + webhookSecret}, args...))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	services := service.NewService(repository.NewMemoryRepository(), cfg)
+	if err := services.Authorization.EnsureAdmin(adminEmail, adminPassword); err != nil {
+		t.Fatal(err)
+	}
+
+	return &shop{t: t, router: handler.NewHandler(services, cfg.HTTP).InitRoutesAndDB(), services: services}
+}
+
+// do sends a request with body encoded as JSON, if not nil, on behalf of
+// the holder of token, if not empty.
+func (s *shop) do(token, method, path string, body interface{}) *httptest.ResponseRecorder {
+	s.t.Helper()
+
+	return s.doWith(nil, token, method, path, body)
+}
+
+// doWith is do with the extra request headers header.
+func (s *shop) doWith(header http.Header, token, method, path string, body interface{}) *httptest.ResponseRecorder {
+	s.t.Helper()
+
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			s.t.Fatal(err)
+		}
+	}
+
+	req := httptest.NewRequest(method, path, &buf)
+	req.Header.Set("Content-Type", "application/json")
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+
+	return w
+}
+
+// must is do failing the test unless the response has status want. It
+// decodes the response body into out, if not nil.
+func (s *shop) must(want int, out interface{}, token, method, path string, body interface{}) {
+	s.t.Helper()
+
+	w := s.do(token, method, path, body)
+	if w.Code != want {
+		s.t.Fatalf("%s %s: got %d, want %d: %s", method, path, w.Code, want, w.Body)
+	}
+
+	if out != nil {
+		if err := json.Unmarshal(w.Body.Bytes(), out); err != nil {
+			s.t.Fatalf("%s %s: %v", method, path, err)
+		}
+	}
+}
+
+func (s *shop) signIn(email, password string) string {
+	s.t.Helper()
+
+	var tokens struct {
+		AccessToken string `json:"access_token"`
+	}
+	s.must(http.StatusOK, &tokens, "", http.MethodPost, "/auth/sign-in", gin.H{"email": email, "password": password})
+
+	return tokens.AccessToken
+}
+
+// signUp creates a user with role and returns their ID and access token.
+func (s *shop) signUp(admin, email, role string) (int, string) {
+	s.t.Helper()
+
+	var user struct {
+		UserID int `json:"user_id"`
+	}
+	s.must(http.StatusCreated, &user, "", http.MethodPost, "/auth/sign-up",
+		gin.H{"first_name": "Test", "last_name": "User", "age": 30, "email": email, "password": "password"})
+
+	if role != "customer" {
+		s.must(http.StatusOK, nil, admin, http.MethodPatch, "/api/user/"+strconv.Itoa(user.UserID), gin.H{"role": role})
+	}
+
+	return user.UserID, s.signIn(email, "password")
+}
+
+// addCar adds a priced car with vehicles in stock and returns its ID.
+func (s *shop) addCar(admin string, vins ...string) int {
+	s.t.Helper()
+
+	var car struct {
+		CarID int `json:"car_id"`
+	}
+	s.must(http.StatusCreated, &car, admin, http.MethodPost, "/api/car/",
+		gin.H{"name": "Golf", "power": 150, "type": "hatch", "year": 2020})
+
+	carPath := "/api/car/" + strconv.Itoa(car.CarID)
+	s.must(http.StatusCreated, nil, admin, http.MethodPost, carPath+"/prices", gin.H{"amount": 2000000, "currency": "EUR"})
+
+	for _, vin := range vins {
+		s.must(http.StatusCreated, nil, admin, http.MethodPost, "/api/inventory/", gin.H{"car_id": car.CarID, "vin": vin})
+	}
+
+	return car.CarID
+}
+
+func (s *shop) order(token string, carID int) int {
+	s.t.Helper()
+
+	var order struct {
+		OrderID int `json:"order_id"`
+	}
+	s.must(http.StatusCreated, &order, token, http.MethodPost, "/api/orders/", gin.H{"car_id": carID})
+
+	return order.OrderID
+}
+
+func (s *shop) inStock(admin string, carID int) int {
+	s.t.Helper()
+
+	var stock []struct {
+		InStock int `json:"in_stock"`
+	}
+	s.must(http.StatusOK, &stock, admin, http.MethodGet, "/api/inventory/stock?car_id="+strconv.Itoa(carID), nil)
+	if len(stock) == 0 {
+		return 0
+	}
+
+	return stock[0].InStock
+}
+
+// blockingOrders returns the order IDs a 409 response lists as being in the
+// way.
+func blockingOrders(t *testing.T, w *httptest.ResponseRecorder) []int {
+	t.Helper()
+
+	var problem struct {
+		Details struct {
+			OrderIDs []int `json:"order_ids"`
+		} `json:"details"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &problem); err != nil {
+		t.Fatal(err)
+	}
+
+	return problem.Details.OrderIDs
+}
+
+var vins = []string{"1M8GDM9AXKP042788", "1FTFW1ET5DFC10312", "5YJSA1E26HF000337"}
+
+func TestDeleteUserRestrict(t *testing.T) {
+	s := newShop(t, "-deletion-users=restrict")
+	admin := s.signIn(adminEmail, adminPassword)
+	carID := s.addCar(admin, vins...)
+
+	buyerID, buyer := s.signUp(admin, "buyer@example.com", "customer")
+	first, second := s.order(buyer, carID), s.order(buyer, carID)
+
+	w := s.do(admin, http.MethodDelete, "/api/user/"+strconv.Itoa(buyerID), nil)
+	if w.Code != http.StatusConflict {
+		t.Fatalf("deleting a user with orders: got %d, want 409: %s", w.Code, w.Body)
+	}
+	if got := blockingOrders(t, w); !slices.Equal(got, []int{first, second}) {
+		t.Errorf("blocking orders: got %v, want %v", got, []int{first, second})
+	}
+	s.must(http.StatusOK, nil, admin, http.MethodGet, "/api/user/"+strconv.Itoa(buyerID), nil)
+
+	idleID, _ := s.signUp(admin, "idle@example.com", "customer")
+	s.must(http.StatusOK, nil, admin, http.MethodDelete, "/api/user/"+strconv.Itoa(idleID), nil)
+	s.must(http.StatusNotFound, nil, admin, http.MethodGet, "/api/user/"+strconv.Itoa(idleID), nil)
+	s.must(http.StatusNotFound, nil, admin, http.MethodDelete, "/api/user/"+strconv.Itoa(idleID), nil)
+}
+
+func TestDeleteUserSoft(t *testing.T) {
+	s := newShop(t, "-deletion-users=soft")
+	admin := s.signIn(adminEmail, adminPassword)
+	carID := s.addCar(admin, vins...)
+
+	buyerID, buyer := s.signUp(admin, "buyer@example.com", "customer")
+	orderID := s.order(buyer, carID)
+
+	userPath := "/api/user/" + strconv.Itoa(buyerID)
+	s.must(http.StatusOK, nil, admin, http.MethodDelete, userPath, nil)
+	s.must(http.StatusNotFound, nil, admin, http.MethodGet, userPath, nil)
+	s.must(http.StatusNotFound, nil, admin, http.MethodDelete, userPath, nil)
+
+	var users struct {
+		Total int `json:"total"`
+	}
+	s.must(http.StatusOK, &users, admin, http.MethodGet, "/api/user/get-all", nil)
+	if users.Total != 1 {
+		t.Errorf("users listed after soft delete: got %d, want only the admin", users.Total)
+	}
+
+	var order struct {
+		User struct {
+			UserID    int     `json:"user_id"`
+			DeletedAt *string `json:"deleted_at"`
+		} `json:"user"`
+	}
+	s.must(http.StatusOK, &order, admin, http.MethodGet, "/api/orders/order/"+strconv.Itoa(orderID), nil)
+	if order.User.UserID != buyerID || order.User.DeletedAt == nil {
+		t.Errorf("order of a soft deleted user: got user %+v, want user %d marked deleted", order.User, buyerID)
+	}
+
+	s.must(http.StatusUnauthorized, nil, "", http.MethodPost, "/auth/sign-in",
+		gin.H{"email": "buyer@example.com", "password": "password"})
+}
+
+func TestForceDeleteUser(t *testing.T) {
+	s := newShop(t, "-deletion-users=soft")
+	admin := s.signIn(adminEmail, adminPassword)
+	carID := s.addCar(admin, vins...)
+
+	buyerID, buyer := s.signUp(admin, "buyer@example.com", "customer")
+	orderID := s.order(buyer, carID)
+	_, sales := s.signUp(admin, "sales@example.com", "sales")
+
+	userPath := "/api/user/" + strconv.Itoa(buyerID)
+	s.must(http.StatusBadRequest, nil, admin, http.MethodDelete, userPath+"?force=maybe", nil)
+	s.must(http.StatusForbidden, nil, sales, http.MethodDelete, userPath+"?force=true", nil)
+
+	if got := s.inStock(admin, carID); got != len(vins)-1 {
+		t.Fatalf("in stock after ordering: got %d, want %d", got, len(vins)-1)
+	}
+
+	s.must(http.StatusOK, nil, admin, http.MethodDelete, userPath+"?force=true", nil)
+	s.must(http.StatusNotFound, nil, admin, http.MethodGet, userPath, nil)
+	s.must(http.StatusNotFound, nil, admin, http.MethodGet, "/api/orders/order/"+strconv.Itoa(orderID), nil)
+
+	if got := s.inStock(admin, carID); got != len(vins) {
+		t.Errorf("in stock after deleting the order: got %d, want %d", got, len(vins))
+	}
+}
+
+func TestForceDeleteKeepsPaidOrders(t *testing.T) {
+	s := newShop(t)
+	admin := s.signIn(adminEmail, adminPassword)
+	carID := s.addCar(admin, vins...)
+
+	buyerID, buyer := s.signUp(admin, "buyer@example.com", "customer")
+	orderPath := "/api/orders/order/" + strconv.Itoa(s.order(buyer, carID))
+	s.must(http.StatusOK, nil, buyer, http.MethodPatch, strings.Replace(orderPath, "/order/", "/", 1)+"/status",
+		gin.H{"status": "pending_payment"})
+
+	w := s.do(buyer, http.MethodPost, orderPath+"/payments", gin.H{"token": "tok_visa"})
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("paying without an Idempotency-Key: got %d, want 400", w.Code)
+	}
+	req := httptest.NewRequest(http.MethodPost, orderPath+"/payments", strings.NewReader(`{"token":"tok_visa"}`))
+	req.Header.Set("Authorization", "Bearer "+buyer)
+	req.Header.Set("Idempotency-Key", "pay-1")
+	w = httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("paying: got %d, want 201: %s", w.Code, w.Body)
+	}
+
+	s.must(http.StatusConflict, nil, admin, http.MethodDelete, "/api/user/"+strconv.Itoa(buyerID)+"?force=true", nil)
+	s.must(http.StatusConflict, nil, admin, http.MethodDelete, "/api/car/"+strconv.Itoa(carID)+"?force=true", nil)
+	s.must(http.StatusOK, nil, admin, http.MethodGet, orderPath, nil)
+}
+
+func TestDeleteCarRestrict(t *testing.T) {
+	s := newShop(t, "-deletion-cars=restrict")
+	admin := s.signIn(adminEmail, adminPassword)
+	_, buyer := s.signUp(admin, "buyer@example.com", "customer")
+
+	orderedID := s.addCar(admin, vins[0])
+	orderID := s.order(buyer, orderedID)
+
+	w := s.do(admin, http.MethodDelete, "/api/car/"+strconv.Itoa(orderedID), nil)
+	if w.Code != http.StatusConflict {
+		t.Fatalf("deleting an ordered car: got %d, want 409: %s", w.Code, w.Body)
+	}
+	if got := blockingOrders(t, w); !slices.Equal(got, []int{orderID}) {
+		t.Errorf("blocking orders: got %v, want %v", got, []int{orderID})
+	}
+
+	stockedID := s.addCar(admin, vins[1])
+	s.must(http.StatusConflict, nil, admin, http.MethodDelete, "/api/car/"+strconv.Itoa(stockedID), nil)
+
+	unusedID := s.addCar(admin)
+	s.must(http.StatusOK, nil, admin, http.MethodDelete, "/api/car/"+strconv.Itoa(unusedID), nil)
+	s.must(http.StatusNotFound, nil, admin, http.MethodGet, "/api/car/"+strconv.Itoa(unusedID), nil)
+}
+
+func TestDeleteCarSoft(t *testing.T) {
+	s := newShop(t, "-deletion-cars=soft")
+	admin := s.signIn(adminEmail, adminPassword)
+	_, buyer := s.signUp(admin, "buyer@example.com", "customer")
+
+	carID := s.addCar(admin, vins...)
+	orderID := s.order(buyer, carID)
+
+	carPath := "/api/car/" + strconv.Itoa(carID)
+	s.must(http.StatusOK, nil, admin, http.MethodDelete, carPath, nil)
+	s.must(http.StatusNotFound, nil, admin, http.MethodGet, carPath, nil)
+	s.must(http.StatusUnprocessableEntity, nil, buyer, http.MethodPost, "/api/orders/", gin.H{"car_id": carID})
+
+	var cars struct {
+		Total int `json:"total"`
+	}
+	s.must(http.StatusOK, &cars, admin, http.MethodGet, "/api/car/get-all", nil)
+	if cars.Total != 0 {
+		t.Errorf("cars listed after soft delete: got %d, want 0", cars.Total)
+	}
+
+	var order struct {
+		Items []struct {
+			Car struct {
+				CarID     int     `json:"car_id"`
+				DeletedAt *string `json:"deleted_at"`
+			} `json:"car"`
+		} `json:"items"`
+	}
+	s.must(http.StatusOK, &order, buyer, http.MethodGet, "/api/orders/order/"+strconv.Itoa(orderID), nil)
+	if len(order.Items) != 1 || order.Items[0].Car.CarID != carID || order.Items[0].Car.DeletedAt == nil {
+		t.Errorf("order of a soft deleted car: got %+v, want car %d marked deleted", order.Items, carID)
+	}
+}
+
+func TestForceDeleteCar(t *testing.T) {
+	s := newShop(t, "-deletion-cars=restrict")
+	admin := s.signIn(adminEmail, adminPassword)
+	_, buyer := s.signUp(admin, "buyer@example.com", "customer")
+
+	carID := s.addCar(admin, vins[:2]...)
+	otherCarID := s.addCar(admin, vins[2])
+	orderID := s.order(buyer, carID)
+
+	// An order with another car goes as a whole.
+	var mixed struct {
+		OrderID int `json:"order_id"`
+	}
+	s.must(http.StatusCreated, &mixed, buyer, http.MethodPost, "/api/orders/",
+		gin.H{"items": []gin.H{{"car_id": carID}, {"car_id": otherCarID}}})
+
+	carPath := "/api/car/" + strconv.Itoa(carID)
+	s.must(http.StatusOK, nil, admin, http.MethodDelete, carPath+"?force=true", nil)
+	s.must(http.StatusNotFound, nil, admin, http.MethodGet, carPath, nil)
+	s.must(http.StatusNotFound, nil, admin, http.MethodGet, "/api/orders/order/"+strconv.Itoa(orderID), nil)
+	s.must(http.StatusNotFound, nil, admin, http.MethodGet, "/api/orders/order/"+strconv.Itoa(mixed.OrderID), nil)
+
+	var vehicles struct {
+		Total int `json:"total"`
+	}
+	s.must(http.StatusOK, &vehicles, admin, http.MethodGet, "/api/inventory/get-all", nil)
+	if vehicles.Total != 1 {
+		t.Errorf("vehicles left after force deleting their car: got %d, want the one of the other car", vehicles.Total)
+	}
+	if got := s.inStock(admin, otherCarID); got != 1 {
+		t.Errorf("vehicles of the other car in stock: got %d, want 1", got)
+	}
+}
+
+// total returns the total of the page at path.
+func (s *shop) total(token, path string) int {
+	s.t.Helper()
+
+	var page struct {
+		Total int `json:"total"`
+	}
+	s.must(http.StatusOK, &page, token, http.MethodGet, path, nil)
+
+	return page.Total
+}
+
+func TestSoftDeleteAndRestoreOrder(t *testing.T) {
+	s := newShop(t)
+	admin := s.signIn(adminEmail, adminPassword)
+	carID := s.addCar(admin, vins...)
+
+	_, buyer := s.signUp(admin, "buyer@example.com", "customer")
+	orderID := s.order(buyer, carID)
+	id := strconv.Itoa(orderID)
+
+	s.must(http.StatusOK, nil, buyer, http.MethodDelete, "/api/orders/"+id, nil)
+	if got := s.inStock(admin, carID); got != len(vins) {
+		t.Errorf("in stock after deleting the order: got %d, want %d", got, len(vins))
+	}
+	s.must(http.StatusNotFound, nil, admin, http.MethodGet, "/api/orders/order/"+id, nil)
+	s.must(http.StatusForbidden, nil, buyer, http.MethodGet, "/api/orders/order/"+id+"?include_deleted=true", nil)
+
+	var order struct {
+		DeletedAt *string `json:"deleted_at"`
+	}
+	s.must(http.StatusOK, &order, admin, http.MethodGet, "/api/orders/order/"+id+"?include_deleted=true", nil)
+	if order.DeletedAt == nil {
+		t.Error("soft deleted order read with include_deleted: deleted_at is not set")
+	}
+
+	if got := s.total(admin, "/api/orders/get-all"); got != 0 {
+		t.Errorf("orders listed: got %d, want 0", got)
+	}
+	if got := s.total(admin, "/api/orders/get-all?include_deleted=true"); got != 1 {
+		t.Errorf("orders listed with include_deleted: got %d, want 1", got)
+	}
+	if got := s.total(admin, "/api/orders/trash"); got != 1 {
+		t.Errorf("orders in the trash: got %d, want 1", got)
+	}
+	s.must(http.StatusForbidden, nil, buyer, http.MethodGet, "/api/orders/trash", nil)
+	s.must(http.StatusForbidden, nil, buyer, http.MethodPost, "/api/orders/"+id+"/restore", nil)
+
+	var restored struct {
+		DeletedAt *string `json:"deleted_at"`
+	}
+	s.must(http.StatusOK, &restored, admin, http.MethodPost, "/api/orders/"+id+"/restore", nil)
+	if restored.DeletedAt != nil {
+		t.Error("restored order: deleted_at is still set")
+	}
+	if got := s.inStock(admin, carID); got != len(vins)-1 {
+		t.Errorf("in stock after restoring the order: got %d, want %d", got, len(vins)-1)
+	}
+	s.must(http.StatusOK, nil, buyer, http.MethodGet, "/api/orders/order/"+id, nil)
+	s.must(http.StatusConflict, nil, admin, http.MethodPost, "/api/orders/"+id+"/restore", nil)
+	s.must(http.StatusNotFound, nil, admin, http.MethodPost, "/api/orders/999/restore", nil)
+}
+
+// TestDeleteCancelledOrderKeepsVehicle deletes a cancelled order, softly
+// and then with its customer, after another order got the vehicle it gave
+// back, which must leave that order its vehicle.
+func TestDeleteCancelledOrderKeepsVehicle(t *testing.T) {
+	s := newShop(t)
+	admin := s.signIn(adminEmail, adminPassword)
+	carID := s.addCar(admin, vins[0])
+
+	firstID, first := s.signUp(admin, "first@example.com", "customer")
+	_, second := s.signUp(admin, "second@example.com", "customer")
+
+	cancelled := strconv.Itoa(s.order(first, carID))
+	s.must(http.StatusOK, nil, first, http.MethodPatch, "/api/orders/"+cancelled+"/status", gin.H{"status": "cancelled"})
+	held := strconv.Itoa(s.order(second, carID))
+
+	s.must(http.StatusOK, nil, admin, http.MethodDelete, "/api/orders/"+cancelled, nil)
+	if got := s.inStock(admin, carID); got != 0 {
+		t.Errorf("in stock after soft deleting the cancelled order: got %d, want 0", got)
+	}
+
+	s.must(http.StatusOK, nil, admin, http.MethodPost, "/api/orders/"+cancelled+"/restore", nil)
+	s.must(http.StatusOK, nil, admin, http.MethodDelete, "/api/user/"+strconv.Itoa(firstID)+"?force=true", nil)
+	if got := s.inStock(admin, carID); got != 0 {
+		t.Errorf("in stock after force deleting the customer of the cancelled order: got %d, want 0", got)
+	}
+
+	s.must(http.StatusOK, nil, second, http.MethodGet, "/api/orders/order/"+held, nil)
+	s.must(http.StatusConflict, nil, second, http.MethodPost, "/api/orders/", gin.H{"car_id": carID})
+}
+
+// TestForceDeleteSoftDeletedOrder force deletes the customer of a soft
+// deleted draft order, which gave its vehicle back when it was deleted,
+// after another order got that vehicle.
+func TestForceDeleteSoftDeletedOrder(t *testing.T) {
+	s := newShop(t)
+	admin := s.signIn(adminEmail, adminPassword)
+	carID := s.addCar(admin, vins[0])
+
+	firstID, first := s.signUp(admin, "first@example.com", "customer")
+	_, second := s.signUp(admin, "second@example.com", "customer")
+	_, third := s.signUp(admin, "third@example.com", "customer")
+
+	s.must(http.StatusOK, nil, first, http.MethodDelete, "/api/orders/"+strconv.Itoa(s.order(first, carID)), nil)
+	held := strconv.Itoa(s.order(second, carID))
+
+	s.must(http.StatusOK, nil, admin, http.MethodDelete, "/api/user/"+strconv.Itoa(firstID)+"?force=true", nil)
+	if got := s.inStock(admin, carID); got != 0 {
+		t.Errorf("in stock after force deleting the customer of the deleted order: got %d, want 0", got)
+	}
+
+	s.must(http.StatusOK, nil, second, http.MethodGet, "/api/orders/order/"+held, nil)
+	s.must(http.StatusConflict, nil, third, http.MethodPost, "/api/orders/", gin.H{"car_id": carID})
+}
+
+func TestRestoreOrderOutOfStock(t *testing.T) {
+	s := newShop(t)
+	admin := s.signIn(adminEmail, adminPassword)
+	carID := s.addCar(admin, vins[0])
+
+	_, first := s.signUp(admin, "first@example.com", "customer")
+	_, second := s.signUp(admin, "second@example.com", "customer")
+
+	orderID := strconv.Itoa(s.order(first, carID))
+	s.must(http.StatusOK, nil, first, http.MethodDelete, "/api/orders/"+orderID, nil)
+	s.order(second, carID)
+
+	s.must(http.StatusConflict, nil, admin, http.MethodPost, "/api/orders/"+orderID+"/restore", nil)
+	s.must(http.StatusNotFound, nil, admin, http.MethodGet, "/api/orders/order/"+orderID, nil)
+}
+
+func TestCustomerDeletesOrder(t *testing.T) {
+	s := newShop(t)
+	admin := s.signIn(adminEmail, adminPassword)
+	carID := s.addCar(admin, vins...)
+
+	_, buyer := s.signUp(admin, "buyer@example.com", "customer")
+	_, other := s.signUp(admin, "other@example.com", "customer")
+
+	paid := "/api/orders/" + strconv.Itoa(s.order(buyer, carID))
+	s.must(http.StatusOK, nil, admin, http.MethodPatch, paid+"/status", gin.H{"status": "pending_payment"})
+	s.must(http.StatusOK, nil, admin, http.MethodPatch, paid+"/status", gin.H{"status": "paid"})
+	s.must(http.StatusForbidden, nil, buyer, http.MethodDelete, paid, nil)
+	s.must(http.StatusOK, nil, admin, http.MethodDelete, paid, nil)
+
+	cancelled := "/api/orders/" + strconv.Itoa(s.order(buyer, carID))
+	s.must(http.StatusOK, nil, buyer, http.MethodPatch, cancelled+"/status", gin.H{"status": "cancelled"})
+	s.must(http.StatusForbidden, nil, other, http.MethodDelete, cancelled, nil)
+	s.must(http.StatusOK, nil, buyer, http.MethodDelete, cancelled, nil)
+
+	draft := "/api/orders/" + strconv.Itoa(s.order(buyer, carID))
+	s.must(http.StatusForbidden, nil, other, http.MethodGet, "/api/orders/order/"+strings.TrimPrefix(draft, "/api/orders/")+"/history", nil)
+	s.must(http.StatusForbidden, nil, other, http.MethodPatch, draft+"/status", gin.H{"status": "cancelled"})
+	s.must(http.StatusOK, nil, buyer, http.MethodDelete, draft, nil)
+}
+
+func TestRestoreUserAndCar(t *testing.T) {
+	s := newShop(t)
+	admin := s.signIn(adminEmail, adminPassword)
+	carID := s.addCar(admin)
+	buyerID, _ := s.signUp(admin, "buyer@example.com", "customer")
+
+	userPath, carPath := "/api/user/"+strconv.Itoa(buyerID), "/api/car/"+strconv.Itoa(carID)
+	s.must(http.StatusConflict, nil, admin, http.MethodPost, userPath+"/restore", nil)
+	s.must(http.StatusOK, nil, admin, http.MethodDelete, userPath, nil)
+	s.must(http.StatusOK, nil, admin, http.MethodDelete, carPath, nil)
+
+	if got := s.total(admin, "/api/user/trash"); got != 1 {
+		t.Errorf("users in the trash: got %d, want 1", got)
+	}
+	if got := s.total(admin, "/api/user/get-all?include_deleted=true"); got != 2 {
+		t.Errorf("users listed with include_deleted: got %d, want 2", got)
+	}
+	if got := s.total(admin, "/api/car/trash"); got != 1 {
+		t.Errorf("cars in the trash: got %d, want 1", got)
+	}
+	s.must(http.StatusOK, nil, admin, http.MethodGet, carPath+"?include_deleted=true", nil)
+	s.must(http.StatusBadRequest, nil, admin, http.MethodGet, carPath+"?include_deleted=maybe", nil)
+
+	s.must(http.StatusOK, nil, admin, http.MethodPost, userPath+"/restore", nil)
+	s.must(http.StatusOK, nil, admin, http.MethodPost, carPath+"/restore", nil)
+	s.must(http.StatusOK, nil, admin, http.MethodGet, userPath, nil)
+	s.must(http.StatusOK, nil, admin, http.MethodGet, carPath, nil)
+	s.signIn("buyer@example.com", "password")
+
+	if got := s.total(admin, "/api/user/trash"); got != 0 {
+		t.Errorf("users in the trash after restoring: got %d, want 0", got)
+	}
+}
+
+func TestPurge(t *testing.T) {
+	s := newShop(t, "-deletion-retention=24h")
+	admin := s.signIn(adminEmail, adminPassword)
+	orderedID := s.addCar(admin, vins[0])
+	unusedID := s.addCar(admin, vins[1])
+
+	buyerID, buyer := s.signUp(admin, "buyer@example.com", "customer")
+	idleID, _ := s.signUp(admin, "idle@example.com", "customer")
+	orderID := s.order(buyer, orderedID)
+
+	for _, path := range []string{
+		"/api/user/" + strconv.Itoa(buyerID),
+		"/api/user/" + strconv.Itoa(idleID),
+		"/api/car/" + strconv.Itoa(orderedID),
+		"/api/car/" + strconv.Itoa(unusedID),
+	} {
+		s.must(http.StatusOK, nil, admin, http.MethodDelete, path, nil)
+	}
+
+	purged, err := s.services.Trash.Purge(time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if purged != (service.Purged{}) {
+		t.Errorf("purged within the retention: got %+v, want nothing", purged)
+	}
+
+	// The order keeps its buyer and car until it is deleted itself.
+	purged, err = s.services.Trash.Purge(time.Now().Add(25 * time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (service.Purged{Users: 1, Cars: 1}); purged != want {
+		t.Errorf("purged past the retention: got %+v, want %+v", purged, want)
+	}
+	s.must(http.StatusNotFound, nil, admin, http.MethodPost, "/api/user/"+strconv.Itoa(idleID)+"/restore", nil)
+	s.must(http.StatusOK, nil, admin, http.MethodGet, "/api/orders/order/"+strconv.Itoa(orderID), nil)
+
+	s.must(http.StatusOK, nil, admin, http.MethodDelete, "/api/orders/"+strconv.Itoa(orderID), nil)
+	purged, err = s.services.Trash.Purge(time.Now().Add(25 * time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (service.Purged{Users: 1, Cars: 1, Orders: 1}); purged != want {
+		t.Errorf("purged after deleting the order: got %+v, want %+v", purged, want)
+	}
+	for _, path := range []string{"/api/user/trash", "/api/car/trash", "/api/orders/trash"} {
+		if got := s.total(admin, path); got != 0 {
+			t.Errorf("%s after purging: got %d, want 0", path, got)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Stremilov/car-shop/pkg/service"
+	"github.com/gin-gonic/gin"
+)
+
+// setETag sets the ETag of a user or car, which is its version.
+func setETag(ctx *gin.Context, version int) {
+	ctx.Header("ETag", `"`+strconv.Itoa(version)+`"`)
+}
+
+// checkVersion answers with 412 and reports false unless version, as ifMatch
+// returns it, matches current.
+func checkVersion(ctx *gin.Context, version, current int) bool {
+	if version != 0 && version != current {
+		writeProblem(ctx, http.StatusPreconditionFailed, codePreconditionFailed,
+			fmt.Sprintf("The record has changed since version %d", version), nil)
+		return false
+	}
+
+	return true
+}
+
+// conditionalError answers a failed update or delete like newErrorResponse,
+// except that If-Match fails with 412 on a record that does not exist,
+// since it has no version to match, even for *. A version mismatch without
+// If-Match is a write made while the handler read and patched the record,
+// which is a 409 the client can retry, not a precondition it did not set.
+func conditionalError(ctx *gin.Context, err error) {
+	ifMatch := ctx.GetHeader("If-Match") != ""
+	switch kind := service.KindOf(err); {
+	case kind == service.KindNotFound && ifMatch:
+		writeProblem(ctx, http.StatusPreconditionFailed, codePreconditionFailed,
+			"If-Match does not match any version of the record: "+err.Error(), nil)
+		return
+	case kind == service.KindPreconditionFailed && !ifMatch:
+		writeProblem(ctx, http.StatusConflict, codeConflict,
+			"The record changed while the update was applied, retry it: "+err.Error(), nil)
+		return
+	}
+
+	newErrorResponse(ctx, err)
+}
+
+// ifMatch returns the version the If-Match header of an update or delete
+// asks for, or 0 for any version if it is * or, unless required, missing.
+// Otherwise it answers with 428 if the header is missing, 400 if it lists
+// several entity tags and 412 if it cannot match any version, and reports
+// false.
+func (h *Handler) ifMatch(ctx *gin.Context) (int, bool) {
+	header := strings.TrimSpace(ctx.GetHeader("If-Match"))
+	switch {
+	case header == "" && h.requireIfMatch:
+		writeProblem(ctx, http.StatusPreconditionRequired, codePreconditionRequired,
+			"If-Match is required, send the ETag of the record as read", nil)
+		return 0, false
+	case header == "" || header == "*":
+		return 0, true
+	case strings.Contains(header, ","):
+		badRequest(ctx, "If-Match must be a single entity tag or *")
+		return 0, false
+	}
+
+	// Weak tags never match for If-Match, and versions start at 1.
+	version, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(header, `"`), `"`))
+	if err != nil || version < 1 || !strings.HasPrefix(header, `"`) || !strings.HasSuffix(header, `"`) {
+		writeProblem(ctx, http.StatusPreconditionFailed, codePreconditionFailed,
+			"If-Match does not match any version of the record", nil)
+		return 0, false
+	}
+
+	return version, true
+}
@@ -0,0 +1,121 @@
+package handler_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	goapi "github.com/Stremilov/car-shop"
+	"github.com/Stremilov/car-shop/pkg/handler"
+	"github.com/Stremilov/car-shop/pkg/service"
+	"github.com/gin-gonic/gin"
+)
+
+func TestIfMatch(t *testing.T) {
+	s := newShop(t)
+	admin := s.signIn(adminEmail, adminPassword)
+	carPath := "/api/car/" + strconv.Itoa(s.addCar(admin))
+
+	etag := s.do(admin, http.MethodGet, carPath, nil).Header().Get("ETag")
+	if etag != `"1"` {
+		t.Fatalf("ETag of a new car: got %s, want \"1\"", etag)
+	}
+
+	ifMatch := func(etag string) http.Header { return http.Header{"If-Match": {etag}} }
+
+	w := s.doWith(ifMatch(etag), admin, http.MethodPatch, carPath, gin.H{"name": "Renamed"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("update at the current version: got %d, want 200: %s", w.Code, w.Body)
+	}
+	if got := w.Header().Get("ETag"); got != `"2"` {
+		t.Errorf("ETag after the update: got %s, want \"2\"", got)
+	}
+
+	for _, tt := range []struct {
+		name   string
+		method string
+		path   string
+		etag   string
+		want   int
+	}{
+		{"stale update", http.MethodPatch, carPath, etag, http.StatusPreconditionFailed},
+		{"stale delete", http.MethodDelete, carPath, etag, http.StatusPreconditionFailed},
+		{"weak tag", http.MethodPatch, carPath, `W/"2"`, http.StatusPreconditionFailed},
+		{"several tags", http.MethodPatch, carPath, `"1", "2"`, http.StatusBadRequest},
+		{"missing car", http.MethodPatch, "/api/car/999", `"1"`, http.StatusPreconditionFailed},
+		{"missing car, any version", http.MethodDelete, "/api/car/999", "*", http.StatusPreconditionFailed},
+		{"missing user", http.MethodDelete, "/api/user/999", `"1"`, http.StatusPreconditionFailed},
+		{"any version", http.MethodPatch, carPath, "*", http.StatusOK},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			w := s.doWith(ifMatch(tt.etag), admin, tt.method, tt.path, gin.H{"name": "Changed"})
+			if w.Code != tt.want {
+				t.Errorf("got %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+		})
+	}
+
+	s.must(http.StatusNotFound, nil, admin, http.MethodPatch, "/api/user/999", gin.H{"age": 30})
+	s.must(http.StatusNotFound, nil, admin, http.MethodDelete, "/api/car/999", nil)
+	s.must(http.StatusOK, nil, admin, http.MethodDelete, carPath, nil)
+}
+
+func TestIfMatchRequired(t *testing.T) {
+	s := newShop(t, "-http-require-if-match=true")
+	admin := s.signIn(adminEmail, adminPassword)
+	userID, _ := s.signUp(admin, "buyer@example.com", "customer")
+	userPath := "/api/user/" + strconv.Itoa(userID)
+
+	s.must(http.StatusPreconditionRequired, nil, admin, http.MethodPatch, userPath, gin.H{"age": 30})
+	s.must(http.StatusPreconditionRequired, nil, admin, http.MethodDelete, userPath, nil)
+
+	etag := s.do(admin, http.MethodGet, userPath, nil).Header().Get("ETag")
+	w := s.doWith(http.Header{"If-Match": {etag}}, admin, http.MethodPatch, userPath, gin.H{"age": 30})
+	if w.Code != http.StatusOK {
+		t.Fatalf("update with If-Match: got %d, want 200: %s", w.Code, w.Body)
+	}
+
+	w = s.doWith(http.Header{"If-Match": {w.Header().Get("ETag")}}, admin, http.MethodDelete, userPath, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("delete with the ETag of the update: got %d, want 200: %s", w.Code, w.Body)
+	}
+}
+
+// TestConcurrentUpdate answers the version mismatch of an update that lost
+// a race with another write, as a patch without If-Match does when the
+// user changes between the read it patches and its write.
+func TestConcurrentUpdate(t *testing.T) {
+	s := newShop(t)
+	admin := s.signIn(adminEmail, adminPassword)
+	userID, _ := s.signUp(admin, "buyer@example.com", "customer")
+
+	age := 30
+	_, lost := s.services.User.Update(userID, goapi.UserUpdate{Age: &age}, 2)
+	if service.KindOf(lost) != service.KindPreconditionFailed {
+		t.Fatalf("update at a stale version: got %v, want a version mismatch", lost)
+	}
+
+	for _, tt := range []struct {
+		name    string
+		ifMatch string
+		want    int
+	}{
+		{"without If-Match", "", http.StatusConflict},
+		{"with If-Match", `"2"`, http.StatusPreconditionFailed},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			ctx, _ := gin.CreateTestContext(w)
+			ctx.Request = httptest.NewRequest(http.MethodPatch, "/", nil)
+			if tt.ifMatch != "" {
+				ctx.Request.Header.Set("If-Match", tt.ifMatch)
+			}
+
+			handler.ConditionalError(ctx, lost)
+			if w.Code != tt.want {
+				t.Errorf("got %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+		})
+	}
+}
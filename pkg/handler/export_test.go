@@ -0,0 +1,18 @@
+package handler
+
+import "github.com/gin-gonic/gin"
+
+// IdentityCtx is where the handlers find the identity of the caller.
+const IdentityCtx = identityCtx
+
+// ConditionalError exports conditionalError for tests of the errors of
+// writes that race with others, which requests alone cannot time.
+func ConditionalError(ctx *gin.Context, err error) {
+	conditionalError(ctx, err)
+}
+
+// Idempotent exports the idempotent middleware for tests that put it in
+// front of handlers of their own.
+func (h *Handler) Idempotent(ctx *gin.Context) {
+	h.idempotent(ctx)
+}
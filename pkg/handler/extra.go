@@ -0,0 +1,92 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	goapi "github.com/Stremilov/car-shop"
+	"github.com/gin-gonic/gin"
+)
+
+// @Summary      Add extra
+// @Description  add an accessory or service that can be ordered along with cars; price is in cents
+// @Tags         extras
+// @Accept       json
+// @Produce      json
+// @Param request body goapi.Extra true "body"
+// @Param        Idempotency-Key header string false "makes the request safe to retry: a retry with the same key and body gets the first response again"
+// @Success      201  {object}  goapi.Extra
+// @Header       201  {string}  Location  "URL of the new extra"
+// @Failure      400,401,403,409,422,500  {object}  handler.Problem
+// @Security     ApiKeyAuth
+// @Router       /api/extras/ [post]
+func (h *Handler) addExtra(ctx *gin.Context) {
+	var input goapi.Extra
+
+	if !bindJSON(ctx, &input) {
+		return
+	}
+
+	extra, err := h.service.Extra.Create(input)
+	if err != nil {
+		newErrorResponse(ctx, err)
+		return
+	}
+
+	created(ctx, "/api/extras/"+strconv.Itoa(extra.ExtraID), extra)
+}
+
+// @Summary      Get all extras
+// @Description  get a page of the extras that can be ordered
+// @Tags         extras
+// @Accept       json
+// @Produce      json
+// @Param        limit     query  int     false  "page size (default 20, max 100)"
+// @Param        offset    query  int     false  "number of extras to skip"
+// @Param        cursor    query  string  false  "next_cursor of the previous page"
+// @Param        sort      query  string  false  "sort field, prefix with - for descending"  Enums(id, -id, name, -name, price, -price)
+// @Success      200  {object} goapi.Page[goapi.Extra]
+// @Failure      400,401,403,422,500  {object}  handler.Problem
+// @Security     ApiKeyAuth
+// @Router       /api/extras/get-all [get]
+func (h *Handler) getAllExtras(ctx *gin.Context) {
+	params, err := parseListParams(ctx)
+	if err != nil {
+		badRequest(ctx, err.Error())
+		return
+	}
+
+	extras, err := h.service.Extra.GetAll(params)
+	if err != nil {
+		newErrorResponse(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, extras)
+}
+
+// @Summary      Get extra by id
+// @Description  get extra by id
+// @Tags         extras
+// @Accept       json
+// @Produce      json
+// @Param        extraID path string true "Extra ID"
+// @Success      200  {object}  goapi.Extra
+// @Failure      400,401,403,404,500  {object}  handler.Problem
+// @Security     ApiKeyAuth
+// @Router       /api/extras/{extraID} [get]
+func (h *Handler) getExtraByID(ctx *gin.Context) {
+	extraID, err := getIDParam(ctx, "extraID")
+	if err != nil {
+		badRequest(ctx, "Invalid extra ID")
+		return
+	}
+
+	extra, err := h.service.Extra.GetByID(extraID)
+	if err != nil {
+		newErrorResponse(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, extra)
+}
@@ -1,7 +1,13 @@
 package handler
 
 import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	goapi "github.com/Stremilov/car-shop"
 	_ "github.com/Stremilov/car-shop/docs"
+	"github.com/Stremilov/car-shop/pkg/config"
 	"github.com/Stremilov/car-shop/pkg/service"
 	"github.com/gin-gonic/gin"
 	swaggerFiles "github.com/swaggo/files"
@@ -9,46 +15,160 @@ import (
 )
 
 type Handler struct {
-	service *service.Service
+	service        *service.Service
+	requireIfMatch bool
 }
 
-func NewHandler(service *service.Service) *Handler {
-	return &Handler{service: service}
+func NewHandler(service *service.Service, cfg config.HTTP) *Handler {
+	return &Handler{service: service, requireIfMatch: cfg.RequireIfMatch}
 }
 
 func (h *Handler) InitRoutesAndDB() *gin.Engine {
-	initDB()
 	router := gin.New()
+	router.HandleMethodNotAllowed = true
+	router.Use(requestID, gin.CustomRecovery(recovery))
+	router.NoRoute(func(ctx *gin.Context) {
+		writeProblem(ctx, http.StatusNotFound, codeNotFound, "No such endpoint", nil)
+	})
+	router.NoMethod(func(ctx *gin.Context) {
+		writeProblem(ctx, http.StatusMethodNotAllowed, codeMethodNotAllowed,
+			fmt.Sprintf("Method %s is not allowed here", ctx.Request.Method), nil)
+	})
+
 	router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 
-	api := router.Group("/api")
+	auth := router.Group("/auth")
+	{
+		auth.POST("/sign-up", h.signUp)
+		auth.POST("/sign-in", h.signIn)
+		auth.POST("/refresh", h.refresh)
+		auth.POST("/revoke", h.revoke)
+	}
+
+	// The payment provider signs its webhooks instead of signing in.
+	router.POST("/payments/webhook", h.paymentWebhook)
+
+	// Create endpoints take an Idempotency-Key header to be safe to retry,
+	// see idempotent. Soft deleted users, cars and orders are only for
+	// admins, through ?include_deleted=true and the trash and restore
+	// endpoints.
+	api := router.Group("/api", h.userIdentity)
 	{
+		// Users may read and update their own profile; everything else
+		// is for admins. The self checks live in the handlers.
 		users := api.Group("/user")
 		{
-			users.POST("/", h.addUser)
-			users.GET("/get-all", h.getAllUsers)
+			users.POST("/", requirePermission(goapi.PermManageUsers), h.idempotent, h.addUser)
+			users.GET("/get-all", requirePermission(goapi.PermManageUsers), h.getAllUsers)
+			users.GET("/trash", requirePermission(goapi.PermManageDeleted), h.getDeletedUsers)
 			users.GET("/:userID", h.getUserByID)
 			users.PATCH("/:userID", h.updateUserInfoByID)
-			users.DELETE("/:userID", h.deleteUserByID)
+			users.DELETE("/:userID", requirePermission(goapi.PermManageUsers), h.deleteUserByID)
+			users.POST("/:userID/restore", requirePermission(goapi.PermManageDeleted), h.restoreUser)
 		}
 
 		cars := api.Group("/car")
 		{
-			cars.POST("/", h.addCar)
-			cars.GET("/:carID", h.getCarByID)
-			cars.GET("/get-all", h.getAllCars)
-			cars.PATCH(":carID", h.updateCarInfoByID)
-			cars.DELETE("/:carID", h.deleteCarByID)
+			cars.POST("/", requirePermission(goapi.PermManageCars), h.idempotent, h.addCar)
+			cars.GET("/:carID", requirePermission(goapi.PermReadCars), h.getCarByID)
+			cars.GET("/get-all", requirePermission(goapi.PermReadCars), h.getAllCars)
+			cars.GET("/trash", requirePermission(goapi.PermManageDeleted), h.getDeletedCars)
+			cars.PATCH(":carID", requirePermission(goapi.PermManageCars), h.updateCarInfoByID)
+			cars.DELETE("/:carID", requirePermission(goapi.PermManageCars), h.deleteCarByID)
+			cars.POST("/:carID/restore", requirePermission(goapi.PermManageDeleted), h.restoreCar)
+			cars.POST("/:carID/prices", requirePermission(goapi.PermManagePricing), h.idempotent, h.addCarPrice)
+			cars.GET("/:carID/prices", requirePermission(goapi.PermManagePricing), h.getCarPrices)
+		}
+
+		discounts := api.Group("/discounts")
+		{
+			discounts.POST("/", requirePermission(goapi.PermManagePricing), h.idempotent, h.addDiscount)
+			discounts.GET("/get-all", requirePermission(goapi.PermManagePricing), h.getAllDiscounts)
+		}
+
+		extras := api.Group("/extras")
+		{
+			extras.POST("/", requirePermission(goapi.PermManageCars), h.idempotent, h.addExtra)
+			extras.GET("/get-all", requirePermission(goapi.PermReadCars), h.getAllExtras)
+			extras.GET("/:extraID", requirePermission(goapi.PermReadCars), h.getExtraByID)
+		}
+
+		payments := api.Group("/payments")
+		{
+			payments.POST("/:paymentID/capture", requirePermission(goapi.PermManageOrders), h.capturePayment)
+			payments.POST("/:paymentID/refund", requirePermission(goapi.PermManageOrders), h.refundPayment)
+		}
+
+		// Everyone may see how many vehicles are left; the vehicles
+		// themselves are for the staff.
+		inventory := api.Group("/inventory")
+		{
+			inventory.POST("/", requirePermission(goapi.PermManageCars), h.idempotent, h.addVehicle)
+			inventory.GET("/get-all", requirePermission(goapi.PermManageCars), h.getAllVehicles)
+			inventory.GET("/stock", requirePermission(goapi.PermReadCars), h.getStock)
+			inventory.GET("/:vehicleID", requirePermission(goapi.PermManageCars), h.getVehicleByID)
+			inventory.PATCH("/:vehicleID/status", requirePermission(goapi.PermManageCars), h.setVehicleStatus)
 		}
 
+		// Customers only see and manage their own orders; the handlers
+		// check ownership unless the caller may manage all orders.
 		orders := api.Group("/orders")
 		{
-			orders.POST("/", h.createOrder)
-			orders.GET("/get-all", h.getAllOrders)
+			orders.POST("/", requirePermission(goapi.PermCreateOrders), h.idempotent, h.createOrder)
+			orders.GET("/get-all", requirePermission(goapi.PermManageOrders), h.getAllOrders)
+			orders.GET("/trash", requirePermission(goapi.PermManageDeleted), h.getDeletedOrders)
 			orders.GET("/:userID", h.getOrdersByUserID)
+			orders.GET("/order/:orderID", h.getOrderByID)
+			orders.GET("/order/:orderID/history", h.getOrderHistory)
+			// Payments keep their own idempotency keys, which never
+			// expire, since moving money must not be repeated.
+			orders.POST("/order/:orderID/payments", requirePermission(goapi.PermCreateOrders), h.payOrder)
+			orders.GET("/order/:orderID/payments", h.getOrderPayments)
+			orders.PATCH("/:orderID", h.patchOrder)
+			orders.PATCH("/:orderID/status", h.setOrderStatus)
 			orders.DELETE("/:orderID", h.deleteOrderByID)
+			orders.POST("/:orderID/restore", requirePermission(goapi.PermManageDeleted), h.restoreOrder)
 		}
 	}
 
 	return router
 }
+
+func getIDParam(ctx *gin.Context, name string) (int, error) {
+	return strconv.Atoi(ctx.Param(name))
+}
+
+// forceRequested reports whether a delete was asked to cascade with
+// ?force=true.
+func forceRequested(ctx *gin.Context) (force, ok bool) {
+	return permittedFlag(ctx, "force", goapi.PermForceDelete)
+}
+
+// includeDeleted reports whether a read was asked to return soft deleted
+// records too with ?include_deleted=true.
+func includeDeleted(ctx *gin.Context) (include, ok bool) {
+	return permittedFlag(ctx, "include_deleted", goapi.PermManageDeleted)
+}
+
+// permittedFlag reads the boolean query parameter name, which only callers
+// with p may set. If it is malformed or the caller may not set it, it
+// answers the request and returns false for ok.
+func permittedFlag(ctx *gin.Context, name string, p goapi.Permission) (set, ok bool) {
+	value := ctx.Query(name)
+	if value == "" {
+		return false, true
+	}
+
+	set, err := strconv.ParseBool(value)
+	if err != nil {
+		badRequest(ctx, name+" must be true or false")
+		return false, false
+	}
+
+	if identity := getIdentity(ctx); set && !identity.Role.Can(p) {
+		forbiddenResponse(ctx, identity, p)
+		return false, false
+	}
+
+	return set, true
+}
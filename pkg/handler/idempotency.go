@@ -0,0 +1,114 @@
+package handler
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// idempotencyKeyHeader carries the key a client retries a request with.
+	idempotencyKeyHeader = "Idempotency-Key"
+	// idempotentReplayedHeader marks a response replayed for a retry.
+	idempotentReplayedHeader = "Idempotent-Replayed"
+)
+
+// idempotent makes a create endpoint safe to retry. The response to the
+// first request with an Idempotency-Key is kept and replayed for retries
+// with the same key and payload; reusing the key for a different payload
+// is a 422. Requests without the header are handled as usual.
+//
+// Server errors and conflicts are not kept, since a retry may well succeed,
+// so the key can be used again after them, and neither are requests that
+// panic or whose response could not be stored.
+func (h *Handler) idempotent(ctx *gin.Context) {
+	key := ctx.GetHeader(idempotencyKeyHeader)
+	if key == "" {
+		return
+	}
+
+	body, err := io.ReadAll(ctx.Request.Body)
+	if err != nil {
+		badRequest(ctx, "Could not read the request body")
+		return
+	}
+	ctx.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+	request, isNew, err := h.service.Idempotency.Begin(getIdentity(ctx).UserID, key, fingerprint(ctx.Request, body))
+	if err != nil {
+		newErrorResponse(ctx, err)
+		return
+	}
+
+	if !isNew {
+		if request.Location != "" {
+			ctx.Header("Location", request.Location)
+		}
+		ctx.Header(idempotentReplayedHeader, "true")
+		ctx.Data(request.Status, request.ContentType, request.Body)
+		ctx.Abort()
+		return
+	}
+
+	// The key is released unless the response is kept for it, so that a
+	// handler that panics does not leave it taken until it expires.
+	completed := false
+	defer func() {
+		if completed {
+			return
+		}
+		if err := h.service.Idempotency.Abandon(request); err != nil {
+			slog.Error("Failed to release idempotency key", "request_id", ctx.GetString(requestIDCtx), "error", err)
+		}
+	}()
+
+	recorder := &responseRecorder{ResponseWriter: ctx.Writer}
+	ctx.Writer = recorder
+	ctx.Next()
+
+	status := recorder.Status()
+	if status >= http.StatusInternalServerError || status == http.StatusConflict {
+		return
+	}
+
+	request.Status = status
+	request.ContentType = recorder.Header().Get("Content-Type")
+	request.Location = recorder.Header().Get("Location")
+	request.Body = recorder.body.Bytes()
+
+	if err := h.service.Idempotency.Complete(request); err != nil {
+		slog.Error("Failed to store idempotent response", "request_id", ctx.GetString(requestIDCtx), "error", err)
+		return
+	}
+	completed = true
+}
+
+// fingerprint identifies a request by its method, path and body.
+func fingerprint(r *http.Request, body []byte) string {
+	hash := sha256.New()
+	io.WriteString(hash, r.Method+" "+r.URL.Path+"\n")
+	hash.Write(body)
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// responseRecorder keeps a copy of the response body it writes.
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *responseRecorder) WriteString(s string) (int, error) {
+	r.body.WriteString(s)
+	return r.ResponseWriter.WriteString(s)
+}
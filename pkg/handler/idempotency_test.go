@@ -0,0 +1,115 @@
+package handler_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	goapi "github.com/Stremilov/car-shop"
+	"github.com/Stremilov/car-shop/pkg/config"
+	"github.com/Stremilov/car-shop/pkg/handler"
+	"github.com/gin-gonic/gin"
+)
+
+func TestIdempotentCreate(t *testing.T) {
+	s := newShop(t)
+	admin := s.signIn(adminEmail, adminPassword)
+	carID := s.addCar(admin, vins[:2]...)
+	otherCarID := s.addCar(admin, vins[2])
+	_, buyer := s.signUp(admin, "buyer@example.com", "customer")
+
+	key := http.Header{"Idempotency-Key": {"order-1"}}
+	orderID := func(w *httptest.ResponseRecorder) int {
+		var order struct {
+			OrderID int `json:"order_id"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &order); err != nil {
+			t.Fatal(err)
+		}
+		return order.OrderID
+	}
+
+	first := s.doWith(key, buyer, http.MethodPost, "/api/orders/", gin.H{"car_id": carID})
+	if first.Code != http.StatusCreated || first.Header().Get("Idempotent-Replayed") != "" {
+		t.Fatalf("first request: got %d, replayed %q: %s", first.Code, first.Header().Get("Idempotent-Replayed"), first.Body)
+	}
+
+	retry := s.doWith(key, buyer, http.MethodPost, "/api/orders/", gin.H{"car_id": carID})
+	if retry.Code != http.StatusCreated || retry.Header().Get("Idempotent-Replayed") != "true" {
+		t.Errorf("retry: got %d, replayed %q, want 201 replayed", retry.Code, retry.Header().Get("Idempotent-Replayed"))
+	}
+	if orderID(retry) != orderID(first) || retry.Header().Get("Location") != first.Header().Get("Location") {
+		t.Errorf("retry: got order %d at %q, want order %d at %q",
+			orderID(retry), retry.Header().Get("Location"), orderID(first), first.Header().Get("Location"))
+	}
+	if got := s.inStock(admin, carID); got != 1 {
+		t.Errorf("got %d vehicles in stock, want 1", got)
+	}
+
+	if w := s.doWith(key, buyer, http.MethodPost, "/api/orders/", gin.H{"car_id": otherCarID}); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("the key with another body: got %d, want 422: %s", w.Code, w.Body)
+	}
+	if got := s.inStock(admin, otherCarID); got != 1 {
+		t.Errorf("got %d vehicles of the other car in stock, want 1", got)
+	}
+
+	// Keys belong to their user.
+	_, other := s.signUp(admin, "other@example.com", "customer")
+	if w := s.doWith(key, other, http.MethodPost, "/api/orders/", gin.H{"car_id": carID}); w.Code != http.StatusCreated || orderID(w) == orderID(first) {
+		t.Errorf("the key of another user: got %d: %s, want a new order", w.Code, w.Body)
+	}
+}
+
+// TestIdempotentHandlerFails puts the middleware in front of a handler
+// that retries the request while it is handled and then panics.
+func TestIdempotentHandlerFails(t *testing.T) {
+	s := newShop(t)
+	admin := s.signIn(adminEmail, adminPassword)
+	userID, _ := s.signUp(admin, "buyer@example.com", "customer")
+
+	h := handler.NewHandler(s.services, config.HTTP{})
+	router := gin.New()
+	router.Use(gin.CustomRecoveryWithWriter(io.Discard, func(ctx *gin.Context, _ any) {
+		ctx.AbortWithStatus(http.StatusInternalServerError)
+	}))
+	router.Use(func(ctx *gin.Context) {
+		ctx.Set(handler.IdentityCtx, goapi.Identity{UserID: userID, Role: goapi.RoleCustomer})
+	})
+
+	send := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/things", strings.NewReader(`{"name":"thing"}`))
+		req.Header.Set("Idempotency-Key", "thing-1")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	var inFlight, calls int
+	router.POST("/things", h.Idempotent, func(ctx *gin.Context) {
+		calls++
+		if calls == 1 {
+			inFlight = send().Code
+			panic("handler failed")
+		}
+		ctx.JSON(http.StatusCreated, gin.H{"id": calls})
+	})
+
+	if w := send(); w.Code != http.StatusInternalServerError {
+		t.Fatalf("panicking handler: got %d, want 500", w.Code)
+	}
+	if inFlight != http.StatusConflict {
+		t.Errorf("retry while in flight: got %d, want 409", inFlight)
+	}
+
+	if w := send(); w.Code != http.StatusCreated || w.Header().Get("Idempotent-Replayed") != "" {
+		t.Errorf("retry after the panic: got %d, replayed %q, want 201 handled again",
+			w.Code, w.Header().Get("Idempotent-Replayed"))
+	}
+	if w := send(); w.Code != http.StatusCreated || w.Header().Get("Idempotent-Replayed") != "true" || calls != 2 {
+		t.Errorf("second retry: got %d, replayed %q after %d calls, want 201 replayed after 2",
+			w.Code, w.Header().Get("Idempotent-Replayed"), calls)
+	}
+}
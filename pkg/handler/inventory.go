@@ -0,0 +1,158 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	goapi "github.com/Stremilov/car-shop"
+	"github.com/gin-gonic/gin"
+)
+
+// @Summary      Add vehicle
+// @Description  add a vehicle of a car model to the inventory
+// @Tags         inventory
+// @Accept       json
+// @Produce      json
+// @Param request body goapi.Vehicle true "body"
+// @Param        Idempotency-Key header string false "makes the request safe to retry: a retry with the same key and body gets the first response again"
+// @Success      201  {object}  goapi.Vehicle
+// @Header       201  {string}  Location  "URL of the new vehicle"
+// @Failure      400,401,403,409,422,500  {object}  handler.Problem
+// @Security     ApiKeyAuth
+// @Router       /api/inventory/ [post]
+func (h *Handler) addVehicle(ctx *gin.Context) {
+	var input goapi.Vehicle
+
+	if !bindJSON(ctx, &input) {
+		return
+	}
+
+	vehicle, err := h.service.Inventory.Create(input)
+	if err != nil {
+		newErrorResponse(ctx, err)
+		return
+	}
+
+	created(ctx, "/api/inventory/"+strconv.Itoa(vehicle.VehicleID), vehicle)
+}
+
+// @Summary      Get all vehicles
+// @Description  get a page of vehicles, optionally of one car model or in one status
+// @Tags         inventory
+// @Accept       json
+// @Produce      json
+// @Param        limit     query  int     false  "page size (default 20, max 100)"
+// @Param        offset    query  int     false  "number of vehicles to skip"
+// @Param        cursor    query  string  false  "next_cursor of the previous page"
+// @Param        sort      query  string  false  "sort field, prefix with - for descending"  Enums(id, -id, car_id, -car_id, vin, -vin, status, -status)
+// @Param        car_id    query  int     false  "car model"
+// @Param        status    query  string  false  "vehicle status"  Enums(in_stock, reserved, sold, in_transit)
+// @Success      200  {object} goapi.Page[goapi.Vehicle]
+// @Failure      400,401,403,422,500  {object}  handler.Problem
+// @Security     ApiKeyAuth
+// @Router       /api/inventory/get-all [get]
+func (h *Handler) getAllVehicles(ctx *gin.Context) {
+	params, err := parseListParams(ctx)
+	if err != nil {
+		badRequest(ctx, err.Error())
+		return
+	}
+
+	filter := goapi.VehicleFilter{Status: goapi.VehicleStatus(ctx.Query("status"))}
+	if filter.CarID, err = queryInt(ctx, "car_id"); err != nil {
+		badRequest(ctx, err.Error())
+		return
+	}
+
+	vehicles, err := h.service.Inventory.GetAll(filter, params)
+	if err != nil {
+		newErrorResponse(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, vehicles)
+}
+
+// @Summary      Get vehicle by id
+// @Description  get vehicle by id
+// @Tags         inventory
+// @Accept       json
+// @Produce      json
+// @Param        vehicleID path string true "Vehicle ID"
+// @Success      200  {object}  goapi.Vehicle
+// @Failure      400,401,403,404,500  {object}  handler.Problem
+// @Security     ApiKeyAuth
+// @Router       /api/inventory/{vehicleID} [get]
+func (h *Handler) getVehicleByID(ctx *gin.Context) {
+	vehicleID, err := getIDParam(ctx, "vehicleID")
+	if err != nil {
+		badRequest(ctx, "Invalid vehicle ID")
+		return
+	}
+
+	vehicle, err := h.service.Inventory.GetByID(vehicleID)
+	if err != nil {
+		newErrorResponse(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, vehicle)
+}
+
+// @Summary      Set vehicle status
+// @Description  move a vehicle between in stock and in transit; reserved and sold follow its order
+// @Tags         inventory
+// @Accept       json
+// @Produce      json
+// @Param        vehicleID path string true "Vehicle ID"
+// @Param request body goapi.VehicleStatusInput true "body"
+// @Success      200  {object}  goapi.Vehicle
+// @Failure      400,401,403,404,409,422,500  {object}  handler.Problem
+// @Security     ApiKeyAuth
+// @Router       /api/inventory/{vehicleID}/status [patch]
+func (h *Handler) setVehicleStatus(ctx *gin.Context) {
+	vehicleID, err := getIDParam(ctx, "vehicleID")
+	if err != nil {
+		badRequest(ctx, "Invalid vehicle ID")
+		return
+	}
+
+	var input goapi.VehicleStatusInput
+	if !bindJSON(ctx, &input) {
+		return
+	}
+
+	vehicle, err := h.service.Inventory.SetStatus(vehicleID, input.Status)
+	if err != nil {
+		newErrorResponse(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, vehicle)
+}
+
+// @Summary      Get stock
+// @Description  count the vehicles of every car model, or of one, by status
+// @Tags         inventory
+// @Accept       json
+// @Produce      json
+// @Param        car_id    query  int     false  "car model"
+// @Success      200  {array}   goapi.Stock
+// @Failure      400,401,403,404,500  {object}  handler.Problem
+// @Security     ApiKeyAuth
+// @Router       /api/inventory/stock [get]
+func (h *Handler) getStock(ctx *gin.Context) {
+	carID, err := queryInt(ctx, "car_id")
+	if err != nil {
+		badRequest(ctx, err.Error())
+		return
+	}
+
+	stock, err := h.service.Inventory.GetStock(carID)
+	if err != nil {
+		newErrorResponse(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, stock)
+}
@@ -0,0 +1,109 @@
+package handler
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	goapi "github.com/Stremilov/car-shop"
+	"github.com/gin-gonic/gin"
+)
+
+// parseListParams reads limit, offset, cursor and sort from the query
+// string. A leading "-" in sort selects descending order.
+func parseListParams(ctx *gin.Context) (goapi.ListParams, error) {
+	var params goapi.ListParams
+
+	limit, err := queryInt(ctx, "limit")
+	if err != nil {
+		return params, err
+	}
+	if limit != nil {
+		params.Limit = *limit
+	}
+
+	offset, err := queryInt(ctx, "offset")
+	if err != nil {
+		return params, err
+	}
+	if offset != nil {
+		params.Offset = *offset
+	}
+
+	if cursor := ctx.Query("cursor"); cursor != "" {
+		params.Cursor, err = goapi.DecodeCursor(cursor)
+		if err != nil {
+			return params, err
+		}
+	}
+
+	sort := ctx.Query("sort")
+	params.Sort = strings.TrimPrefix(sort, "-")
+	params.Desc = strings.HasPrefix(sort, "-")
+
+	return params, nil
+}
+
+func queryInt(ctx *gin.Context, name string) (*int, error) {
+	value, ok := ctx.GetQuery(name)
+	if !ok || value == "" {
+		return nil, nil
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be an integer", name)
+	}
+
+	return &n, nil
+}
+
+func queryFloat(ctx *gin.Context, name string) (*float64, error) {
+	value, ok := ctx.GetQuery(name)
+	if !ok || value == "" {
+		return nil, nil
+	}
+
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+		return nil, fmt.Errorf("%s must be a number", name)
+	}
+
+	return &f, nil
+}
+
+// queryPowerUnit reads the unit power is given in, both in filters and in
+// the response.
+func queryPowerUnit(ctx *gin.Context) (goapi.PowerUnit, error) {
+	value := ctx.Query("power_unit")
+	if value == "" {
+		return goapi.DefaultPowerUnit, nil
+	}
+
+	return goapi.ParsePowerUnit(value)
+}
+
+// queryTime accepts both RFC 3339 timestamps and plain dates. With endOfDay
+// a plain date stands for the last instant of that day, so that it can be
+// used as an inclusive upper bound.
+func queryTime(ctx *gin.Context, name string, endOfDay bool) (*time.Time, error) {
+	value, ok := ctx.GetQuery(name)
+	if !ok || value == "" {
+		return nil, nil
+	}
+
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return &t, nil
+	}
+
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		if endOfDay {
+			t = t.Add(24*time.Hour - time.Nanosecond)
+		}
+		return &t, nil
+	}
+
+	return nil, fmt.Errorf("%s must be a date (2006-01-02) or an RFC 3339 timestamp", name)
+}
@@ -0,0 +1,80 @@
+package handler
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+
+	goapi "github.com/Stremilov/car-shop"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	authorizationHeader = "Authorization"
+	requestIDHeader     = "X-Request-ID"
+	identityCtx         = "identity"
+	requestIDCtx        = "requestID"
+)
+
+// userIdentity rejects requests without a valid bearer access token and
+// stores the identity of the caller in the context.
+func (h *Handler) userIdentity(ctx *gin.Context) {
+	header := ctx.GetHeader(authorizationHeader)
+	scheme, token, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		unauthorizedResponse(ctx, "Missing or malformed bearer token")
+		return
+	}
+
+	identity, err := h.service.Authorization.ParseAccessToken(token)
+	if err != nil {
+		newErrorResponse(ctx, err)
+		return
+	}
+
+	ctx.Set(identityCtx, identity)
+}
+
+// requirePermission lets the request through only if the caller's role
+// grants p.
+func requirePermission(p goapi.Permission) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if identity := getIdentity(ctx); !identity.Role.Can(p) {
+			forbiddenResponse(ctx, identity, p)
+		}
+	}
+}
+
+// getIdentity returns the caller stored by userIdentity. Routes are only
+// reachable through it, so a missing identity is a wiring bug.
+func getIdentity(ctx *gin.Context) goapi.Identity {
+	return ctx.MustGet(identityCtx).(goapi.Identity)
+}
+
+func forbiddenResponse(ctx *gin.Context, identity goapi.Identity, p goapi.Permission) {
+	writeProblem(ctx, http.StatusForbidden, codeForbidden,
+		fmt.Sprintf("Role %q is not allowed to perform this action", identity.Role),
+		gin.H{"role": identity.Role, "permission": p})
+}
+
+// requestID takes the request ID from the X-Request-ID header, or makes one
+// up, and echoes it back so clients can quote it when reporting errors.
+func requestID(ctx *gin.Context) {
+	id := ctx.GetHeader(requestIDHeader)
+	if id == "" || len(id) > 128 {
+		var b [8]byte
+		_, _ = rand.Read(b[:])
+		id = hex.EncodeToString(b[:])
+	}
+
+	ctx.Set(requestIDCtx, id)
+	ctx.Header(requestIDHeader, id)
+}
+
+// recovery turns a panic in a handler into a 500 problem instead of a
+// dropped connection.
+func recovery(ctx *gin.Context, recovered any) {
+	newErrorResponse(ctx, fmt.Errorf("panic: %v", recovered))
+}
@@ -2,139 +2,341 @@ package handler
 
 import (
 	"net/http"
+	"slices"
+	"strconv"
 
+	goapi "github.com/Stremilov/car-shop"
 	"github.com/gin-gonic/gin"
 )
 
-type Order struct {
-	OrderID   int    `json:"order_id"`
-	OrderDate string `json:"order_date"`
-	User      User   `json:"user"`
-	Car       Car    `json:"car"`
-}
-
-type OrderByUserID struct {
-	OrderID   int    `json:"order_id"`
-	OrderDate string `json:"order_date"`
-	User      User   `json:"user"`
-	Car       []Car  `json:"car"`
-}
-
-type OrderInput struct {
-	UserID int `json:"user_id"`
-	CarID  int `json:"car_id"`
-}
-
 // @Summary      Create order
-// @Description  create order
+// @Description  create an order of cars and extras, given as items or, for a single car, as car_id. A vehicle in stock is reserved for every car ordered; 409 if there are not enough left. The order is priced at the current list prices less the best automatic discounts or promo_code, and keeps those prices
 // @Tags         orders
 // @Accept       json
 // @Produce      json
-// @Param request body OrderInput true "body"
-// @Success      201  {object}  OrderInput
+// @Param request body goapi.OrderInput true "body"
+// @Param        Idempotency-Key header string false "makes the request safe to retry: a retry with the same key and body gets the first response again"
+// @Success      201  {object}  goapi.Order
+// @Header       201  {string}  Location  "URL of the new order"
+// @Failure      400,401,403,409,422,500  {object}  handler.Problem
+// @Security     ApiKeyAuth
 // @Router       /api/orders/ [post]
 func (h *Handler) createOrder(ctx *gin.Context) {
-	var orderInput OrderInput
+	var orderInput goapi.OrderInput
 
-	if err := ctx.ShouldBindJSON(&orderInput); err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"err": "Invalid request"})
+	if !bindJSON(ctx, &orderInput) {
 		return
 	}
 
-	query := `INSERT INTO orders (user_id, car_id) VALUES ($1, $2)`
-	_, err := db.Exec(query, orderInput.UserID, orderInput.CarID)
-	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"err": "Failed to insert into database"})
+	identity := getIdentity(ctx)
+	if orderInput.UserID == 0 {
+		orderInput.UserID = identity.UserID
+	}
 
+	if !identity.CanAccessUser(orderInput.UserID, goapi.PermManageOrders) {
+		forbiddenResponse(ctx, identity, goapi.PermManageOrders)
 		return
 	}
 
-	ctx.JSON(http.StatusOK, orderInput)
+	order, err := h.service.Order.Create(orderInput)
+	if err != nil {
+		newErrorResponse(ctx, err)
+		return
+	}
 
+	created(ctx, "/api/orders/order/"+strconv.Itoa(order.OrderID), order)
 }
 
 // @Summary      Get all orders
-// @Description  get all orders
+// @Description  get a page of orders, optionally within an order date range
 // @Tags         orders
 // @Accept       json
 // @Produce      json
-// @Success      200  {object}  Order
+// @Param        limit     query  int     false  "page size (default 20, max 100)"
+// @Param        offset    query  int     false  "number of orders to skip"
+// @Param        cursor    query  string  false  "next_cursor of the previous page"
+// @Param        sort      query  string  false  "sort field, prefix with - for descending"  Enums(id, -id, order_date, -order_date, status, -status, user_id, -user_id)
+// @Param        date_from query  string  false  "earliest order date (2006-01-02 or RFC 3339)"
+// @Param        date_to   query  string  false  "latest order date (2006-01-02 or RFC 3339)"
+// @Param        status    query  string  false  "order status"  Enums(draft, pending_payment, paid, ready_for_delivery, delivered, cancelled, refunded)
+// @Param        power_unit query string  false  "unit of car power in the response (default hp)"  Enums(hp, kW)
+// @Param        include_deleted query bool false "list soft deleted orders too (admins only)"
+// @Success      200  {object}  goapi.Page[goapi.Order]
+// @Failure      400,401,403,422,500  {object}  handler.Problem
+// @Security     ApiKeyAuth
 // @Router       /api/orders/get-all [get]
 func (h *Handler) getAllOrders(ctx *gin.Context) {
-	query := `
-    SELECT 
-        orders.id AS order_id,
-        orders.order_date,
-        people.id AS user_id,
-        people.first_name,
-        people.last_name,
-        people.age,
-        cars.id AS car_id,
-        cars.name AS car_name,
-        cars.power,
-        cars.type,
-        cars.year
-    FROM 
-        orders
-    JOIN 
-        people ON orders.user_id = people.id
-    JOIN 
-        cars ON orders.car_id = cars.id;
-    `
-
-	rows, err := db.Query(query)
-	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"err": "Failed to query database"})
-		return
-	}
-	defer rows.Close()
-
-	var orders []Order
-	for rows.Next() {
-		var o Order
-		if err := rows.Scan(
-			&o.OrderID, &o.OrderDate,
-			&o.User.UserID, &o.User.FirstName, &o.User.LastName, &o.User.Age,
-			&o.Car.CarID, &o.Car.Name, &o.Car.Power, &o.Car.Type, &o.Car.Year,
-		); err != nil {
-			ctx.JSON(http.StatusInternalServerError, gin.H{"err": "Failed to scan row"})
+	params, err := parseListParams(ctx)
+	if err != nil {
+		badRequest(ctx, err.Error())
+		return
+	}
 
-			return
-		}
-		orders = append(orders, o)
+	filter := goapi.OrderFilter{Status: goapi.OrderStatus(ctx.Query("status"))}
+	if filter.DateFrom, err = queryTime(ctx, "date_from", false); err != nil {
+		badRequest(ctx, err.Error())
+		return
+	}
+	if filter.DateTo, err = queryTime(ctx, "date_to", true); err != nil {
+		badRequest(ctx, err.Error())
+		return
+	}
+	unit, err := queryPowerUnit(ctx)
+	if err != nil {
+		badRequest(ctx, err.Error())
+		return
 	}
 
+	include, ok := includeDeleted(ctx)
+	if !ok {
+		return
+	}
+	if include {
+		filter.Deleted = goapi.IncludeDeleted
+	}
+
+	orders, err := h.service.Order.GetAll(filter, params)
+	if err != nil {
+		newErrorResponse(ctx, err)
+		return
+	}
+
+	convertOrderPower(orders.Items, unit)
+
 	ctx.JSON(http.StatusOK, orders)
 
 }
 
-// @Summary      Delete order by id
-// @Description  delete order by user id
+// @Summary      Get order by id
+// @Description  get order by id
 // @Tags         orders
 // @Accept       json
 // @Produce      json
 // @Param        orderID path string true "Order ID"
-// @Success      200  {object}  Order
-// @Router       /api/orders/{orderID} [delete]
-func (h *Handler) deleteOrderByID(ctx *gin.Context) {
-	orderID := ctx.Param("orderID")
+// @Param        power_unit query string false "unit of car power in the response (default hp)"  Enums(hp, kW)
+// @Param        include_deleted query bool false "find the order even if soft deleted (admins only)"
+// @Success      200  {object}  goapi.Order
+// @Failure      400,401,403,404,500  {object}  handler.Problem
+// @Security     ApiKeyAuth
+// @Router       /api/orders/order/{orderID} [get]
+func (h *Handler) getOrderByID(ctx *gin.Context) {
+	orderID, err := getIDParam(ctx, "orderID")
+	if err != nil {
+		badRequest(ctx, "Invalid order ID")
+		return
+	}
+
+	unit, err := queryPowerUnit(ctx)
+	if err != nil {
+		badRequest(ctx, err.Error())
+		return
+	}
+
+	include, ok := includeDeleted(ctx)
+	if !ok {
+		return
+	}
+
+	getOrder := h.service.Order.GetByID
+	if include {
+		getOrder = h.service.Order.GetByIDWithDeleted
+	}
+
+	order, err := getOrder(orderID)
+	if err != nil {
+		newErrorResponse(ctx, err)
+		return
+	}
+
+	identity := getIdentity(ctx)
+	if !identity.CanAccessUser(order.User.UserID, goapi.PermManageOrders) {
+		forbiddenResponse(ctx, identity, goapi.PermManageOrders)
+		return
+	}
+
+	convertOrderPower([]goapi.Order{order}, unit)
+	ctx.JSON(http.StatusOK, order)
+}
+
+// selfServiceStatuses are the statuses customers may move their own
+// orders to: checking out and cancelling. Everything else is up to staff.
+var selfServiceStatuses = []goapi.OrderStatus{goapi.OrderPendingPayment, goapi.OrderCancelled}
 
-	query := `DELETE FROM orders WHERE id = $1`
+// selfServiceDeletable are the statuses in which customers may delete
+// their own orders: before paying for them or once cancelled. Orders that
+// were paid for are only deleted by staff, and nobody deletes an order
+// while a payment of it is pending.
+var selfServiceDeletable = []goapi.OrderStatus{goapi.OrderDraft, goapi.OrderPendingPayment, goapi.OrderCancelled}
 
-	result, err := db.Exec(query, orderID)
+// @Summary      Set order status
+// @Description  move an order along its lifecycle; customers may only check out or cancel their own orders
+// @Tags         orders
+// @Accept       json
+// @Produce      json
+// @Param        orderID path string true "Order ID"
+// @Param request body goapi.OrderStatusInput true "body"
+// @Success      200  {object}  goapi.Order
+// @Failure      400,401,403,404,409,422,500  {object}  handler.Problem
+// @Security     ApiKeyAuth
+// @Router       /api/orders/{orderID}/status [patch]
+func (h *Handler) setOrderStatus(ctx *gin.Context) {
+	orderID, err := getIDParam(ctx, "orderID")
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		badRequest(ctx, "Invalid order ID")
 		return
 	}
 
-	rowsAffected, err := result.RowsAffected()
+	var input goapi.OrderStatusInput
+	if !bindJSON(ctx, &input) {
+		return
+	}
+
+	if !h.canAccessOrder(ctx, orderID) {
+		return
+	}
+
+	identity := getIdentity(ctx)
+	if !identity.Role.Can(goapi.PermManageOrders) && !slices.Contains(selfServiceStatuses, input.Status) {
+		forbiddenResponse(ctx, identity, goapi.PermManageOrders)
+		return
+	}
+
+	order, err := h.service.Order.SetStatus(orderID, input.Status, identity.UserID, input.Note)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		newErrorResponse(ctx, err)
 		return
 	}
 
-	if rowsAffected == 0 {
-		ctx.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+	ctx.JSON(http.StatusOK, order)
+}
+
+// @Summary      Update order
+// @Description  update an order with a JSON merge patch (application/merge-patch+json, or plain application/json) or a JSON patch (application/json-patch+json) of the fields in the body. Only the status can change once an order is placed, along its lifecycle; customers may only check out or cancel their own orders
+// @Tags         orders
+// @Accept       json,application/merge-patch+json,application/json-patch+json
+// @Produce      json
+// @Param        orderID path string true "Order ID"
+// @Param request body goapi.OrderUpdate true "the fields that can be patched"
+// @Success      200  {object}  goapi.Order
+// @Failure      400,401,403,404,409,415,422,500  {object}  handler.Problem
+// @Security     ApiKeyAuth
+// @Router       /api/orders/{orderID} [patch]
+func (h *Handler) patchOrder(ctx *gin.Context) {
+	orderID, err := getIDParam(ctx, "orderID")
+	if err != nil {
+		badRequest(ctx, "Invalid order ID")
+		return
+	}
+
+	p, ok := bindPatch(ctx)
+	if !ok {
+		return
+	}
+
+	order, err := h.service.Order.GetByID(orderID)
+	if err != nil {
+		newErrorResponse(ctx, err)
+		return
+	}
+
+	identity := getIdentity(ctx)
+	if !identity.CanAccessUser(order.User.UserID, goapi.PermManageOrders) {
+		forbiddenResponse(ctx, identity, goapi.PermManageOrders)
+		return
+	}
+
+	update, err := h.service.Order.ApplyPatch(order, p)
+	if err != nil {
+		newErrorResponse(ctx, err)
+		return
+	}
+
+	if update.Status == nil {
+		ctx.JSON(http.StatusOK, order)
+		return
+	}
+
+	if !identity.Role.Can(goapi.PermManageOrders) && !slices.Contains(selfServiceStatuses, *update.Status) {
+		forbiddenResponse(ctx, identity, goapi.PermManageOrders)
+		return
+	}
+
+	order, err = h.service.Order.SetStatus(orderID, *update.Status, identity.UserID, "")
+	if err != nil {
+		newErrorResponse(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, order)
+}
+
+// @Summary      Get order history
+// @Description  get the status changes of an order, oldest first
+// @Tags         orders
+// @Accept       json
+// @Produce      json
+// @Param        orderID path string true "Order ID"
+// @Success      200  {array}   goapi.OrderStatusChange
+// @Failure      400,401,403,404,500  {object}  handler.Problem
+// @Security     ApiKeyAuth
+// @Router       /api/orders/order/{orderID}/history [get]
+func (h *Handler) getOrderHistory(ctx *gin.Context) {
+	orderID, err := getIDParam(ctx, "orderID")
+	if err != nil {
+		badRequest(ctx, "Invalid order ID")
+		return
+	}
+
+	if !h.canAccessOrder(ctx, orderID) {
+		return
+	}
+
+	history, err := h.service.Order.GetHistory(orderID)
+	if err != nil {
+		newErrorResponse(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, history)
+}
+
+// @Summary      Delete order by id
+// @Description  delete an order the way the deletion policy of the server says: for good unless it has payments, or softly, keeping it to be restored until it is purged, unless a payment of it is pending, authorized or captured (409). Either way the vehicles it still holds go back in stock. Customers may only delete their own orders that are not paid for yet or cancelled
+// @Tags         orders
+// @Accept       json
+// @Produce      json
+// @Param        orderID path string true "Order ID"
+// @Success      200
+// @Failure      400,401,403,404,409,500  {object}  handler.Problem
+// @Security     ApiKeyAuth
+// @Router       /api/orders/{orderID} [delete]
+func (h *Handler) deleteOrderByID(ctx *gin.Context) {
+	orderID, err := getIDParam(ctx, "orderID")
+	if err != nil {
+		badRequest(ctx, "Invalid order ID")
+		return
+	}
+
+	if !h.canAccessOrder(ctx, orderID) {
+		return
+	}
+
+	identity := getIdentity(ctx)
+	if !identity.Role.Can(goapi.PermManageOrders) {
+		order, err := h.service.Order.GetByID(orderID)
+		if err != nil {
+			newErrorResponse(ctx, err)
+			return
+		}
+
+		if !slices.Contains(selfServiceDeletable, order.Status) {
+			forbiddenResponse(ctx, identity, goapi.PermManageOrders)
+			return
+		}
+	}
+
+	if err := h.service.Order.Delete(orderID); err != nil {
+		newErrorResponse(ctx, err)
 		return
 	}
 
@@ -142,72 +344,131 @@ func (h *Handler) deleteOrderByID(ctx *gin.Context) {
 
 }
 
-// @Summary      Get order by user id
-// @Description  get order by user id
+// @Summary      Get orders by user id
+// @Description  get the orders of a user with their items, oldest first
 // @Tags         orders
 // @Accept       json
 // @Produce      json
 // @Param        userID path string true "User ID"
-// @Success      200  {object}  Order
+// @Param        power_unit query string false "unit of car power in the response (default hp)"  Enums(hp, kW)
+// @Success      200  {array}   goapi.Order
+// @Failure      400,401,403,404,500  {object}  handler.Problem
+// @Security     ApiKeyAuth
 // @Router       /api/orders/{userID} [get]
 func (h *Handler) getOrdersByUserID(ctx *gin.Context) {
-	userID := ctx.Param("userID")
-	if userID == "" {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "userID is required"})
-		return
-	}
-
-	query := `
-    SELECT 
-        orders.id AS order_id,
-        orders.order_date,
-        people.id AS user_id,
-        people.first_name,
-        people.last_name,
-        people.age,
-        cars.id AS car_id,
-        cars.name AS car_name,
-        cars.power,
-        cars.type,
-        cars.year
-    FROM 
-        orders
-    JOIN 
-        people ON orders.user_id = people.id
-    JOIN 
-        cars ON orders.car_id = cars.id
-    WHERE 
-        orders.user_id = $1;
-    `
-
-	rows, err := db.Query(query, userID)
-	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, err)
-		return
-	}
-	defer rows.Close()
-
-	var orders []Order
-	for rows.Next() {
-		var order Order
-		if err := rows.Scan(&order.OrderID, &order.OrderDate,
-			&order.User.UserID, &order.User.FirstName, &order.User.LastName, &order.User.Age,
-			&order.Car.CarID, &order.Car.Name, &order.Car.Power, &order.Car.Type, &order.Car.Year); err != nil {
-			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to scan row"})
-			return
-		}
-		orders = append(orders, order)
+	userID, err := getIDParam(ctx, "userID")
+	if err != nil {
+		badRequest(ctx, "Invalid user ID")
+		return
 	}
 
-	if err := rows.Err(); err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error occurred during row iteration"})
+	unit, err := queryPowerUnit(ctx)
+	if err != nil {
+		badRequest(ctx, err.Error())
 		return
 	}
 
-	if len(orders) == 0 {
-		ctx.JSON(http.StatusNotFound, gin.H{"error": "No orders found for this user"})
+	identity := getIdentity(ctx)
+	if !identity.CanAccessUser(userID, goapi.PermManageOrders) {
+		forbiddenResponse(ctx, identity, goapi.PermManageOrders)
 		return
 	}
 
+	orders, err := h.service.Order.GetByUserID(userID)
+	if err != nil {
+		newErrorResponse(ctx, err)
+		return
+	}
+
+	// A user without orders is not an error, just an empty list.
+	if orders == nil {
+		orders = []goapi.Order{}
+	}
+
+	convertOrderPower(orders, unit)
+
+	ctx.JSON(http.StatusOK, orders)
+}
+
+// @Summary      Get deleted orders
+// @Description  get a page of the soft deleted orders, which are purged for good once they are past the retention period and have no payments
+// @Tags         orders
+// @Accept       json
+// @Produce      json
+// @Param        limit     query  int     false  "page size (default 20, max 100)"
+// @Param        offset    query  int     false  "number of orders to skip"
+// @Param        cursor    query  string  false  "next_cursor of the previous page"
+// @Param        sort      query  string  false  "sort field, prefix with - for descending"  Enums(id, -id, order_date, -order_date, status, -status, user_id, -user_id)
+// @Param        power_unit query string  false  "unit of car power in the response (default hp)"  Enums(hp, kW)
+// @Success      200  {object}  goapi.Page[goapi.Order]
+// @Failure      400,401,403,422,500  {object}  handler.Problem
+// @Security     ApiKeyAuth
+// @Router       /api/orders/trash [get]
+func (h *Handler) getDeletedOrders(ctx *gin.Context) {
+	params, err := parseListParams(ctx)
+	if err != nil {
+		badRequest(ctx, err.Error())
+		return
+	}
+
+	unit, err := queryPowerUnit(ctx)
+	if err != nil {
+		badRequest(ctx, err.Error())
+		return
+	}
+
+	orders, err := h.service.Order.GetAll(goapi.OrderFilter{Deleted: goapi.OnlyDeleted}, params)
+	if err != nil {
+		newErrorResponse(ctx, err)
+		return
+	}
+
+	convertOrderPower(orders.Items, unit)
+
 	ctx.JSON(http.StatusOK, orders)
 }
+
+// @Summary      Restore order
+// @Description  bring back a soft deleted order. An order that was not paid for yet reserves its vehicles again; 409 if one of them was ordered or sold in the meantime
+// @Tags         orders
+// @Accept       json
+// @Produce      json
+// @Param        orderID path string true "Order ID"
+// @Param        power_unit query string false "unit of car power in the response (default hp)"  Enums(hp, kW)
+// @Success      200  {object}  goapi.Order
+// @Failure      400,401,403,404,409,500  {object}  handler.Problem
+// @Security     ApiKeyAuth
+// @Router       /api/orders/{orderID}/restore [post]
+func (h *Handler) restoreOrder(ctx *gin.Context) {
+	orderID, err := getIDParam(ctx, "orderID")
+	if err != nil {
+		badRequest(ctx, "Invalid order ID")
+		return
+	}
+
+	unit, err := queryPowerUnit(ctx)
+	if err != nil {
+		badRequest(ctx, err.Error())
+		return
+	}
+
+	order, err := h.service.Order.Restore(orderID)
+	if err != nil {
+		newErrorResponse(ctx, err)
+		return
+	}
+
+	convertOrderPower([]goapi.Order{order}, unit)
+	ctx.JSON(http.StatusOK, order)
+}
+
+// convertOrderPower shows the power of the ordered cars in unit.
+func convertOrderPower(orders []goapi.Order, unit goapi.PowerUnit) {
+	for _, order := range orders {
+		for _, item := range order.Items {
+			if item.Car != nil {
+				item.Car.Power = item.Car.Power.In(unit)
+			}
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package handler_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// patchAs sends a PATCH of body as contentType and returns the status code
+// and the decoded response body.
+func (s *shop) patchAs(contentType, token, path string, body interface{}) (int, map[string]interface{}) {
+	s.t.Helper()
+
+	w := s.doWith(http.Header{"Content-Type": {contentType}}, token, http.MethodPatch, path, body)
+
+	var out map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+		s.t.Fatalf("PATCH %s: %v: %s", path, err, w.Body)
+	}
+
+	return w.Code, out
+}
+
+func TestPatchUser(t *testing.T) {
+	s := newShop(t)
+	admin := s.signIn(adminEmail, adminPassword)
+	userID, buyer := s.signUp(admin, "buyer@example.com", "customer")
+	userPath := "/api/user/" + strconv.Itoa(userID)
+
+	const mergePatch, jsonPatch = "application/merge-patch+json", "application/json-patch+json"
+
+	code, user := s.patchAs(mergePatch, buyer, userPath, gin.H{"age": 0, "last_name": "Renamed"})
+	if code != http.StatusOK || user["age"] != 0.0 || user["last_name"] != "Renamed" {
+		t.Errorf("merge patch to age 0: got %d %v", code, user)
+	}
+
+	code, user = s.patchAs(jsonPatch, buyer, userPath, []gin.H{
+		{"op": "test", "path": "/last_name", "value": "Renamed"},
+		{"op": "replace", "path": "/age", "value": 41},
+		{"op": "copy", "from": "/last_name", "path": "/first_name"},
+	})
+	if code != http.StatusOK || user["age"] != 41.0 || user["first_name"] != "Renamed" {
+		t.Errorf("JSON patch: got %d %v", code, user)
+	}
+
+	code, user = s.patchAs(jsonPatch, buyer, userPath, []gin.H{{"op": "test", "path": "/age", "value": 41}})
+	if code != http.StatusOK || user["version"] != 3.0 {
+		t.Errorf("JSON patch changing nothing: got %d %v, want version 3 kept", code, user)
+	}
+
+	for _, tt := range []struct {
+		name        string
+		token       string
+		contentType string
+		body        interface{}
+		want        int
+	}{
+		{"null", buyer, mergePatch, gin.H{"first_name": nil}, http.StatusUnprocessableEntity},
+		{"removed", buyer, jsonPatch, []gin.H{{"op": "remove", "path": "/last_name"}}, http.StatusUnprocessableEntity},
+		{"read only", buyer, mergePatch, gin.H{"user_id": 7}, http.StatusUnprocessableEntity},
+		{"wrong type", buyer, mergePatch, gin.H{"age": "old"}, http.StatusUnprocessableEntity},
+		{"invalid after patch", buyer, jsonPatch, []gin.H{{"op": "replace", "path": "/age", "value": 200}}, http.StatusUnprocessableEntity},
+		{"failed test", buyer, jsonPatch, []gin.H{{"op": "test", "path": "/age", "value": 40}}, http.StatusConflict},
+		{"missing path", buyer, jsonPatch, []gin.H{{"op": "replace", "path": "/email", "value": "x"}}, http.StatusConflict},
+		{"not a patch", buyer, jsonPatch, gin.H{"age": 40}, http.StatusBadRequest},
+		{"own role", buyer, jsonPatch, []gin.H{{"op": "replace", "path": "/role", "value": "admin"}}, http.StatusForbidden},
+		{"unsupported type", buyer, "text/plain", gin.H{"age": 40}, http.StatusUnsupportedMediaType},
+		{"role by admin", admin, mergePatch, gin.H{"role": "sales"}, http.StatusOK},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if code, body := s.patchAs(tt.contentType, tt.token, userPath, tt.body); code != tt.want {
+				t.Errorf("got %d, want %d: %v", code, tt.want, body)
+			}
+		})
+	}
+
+	var got struct {
+		FirstName string `json:"first_name"`
+		Age       int    `json:"age"`
+	}
+	s.must(http.StatusOK, &got, admin, http.MethodGet, userPath, nil)
+	if got.FirstName != "Renamed" || got.Age != 41 {
+		t.Errorf("user after the failed patches: got %+v, want first_name Renamed and age 41", got)
+	}
+
+	// The optional fields are cleared to what a user created without them
+	// has.
+	if code, user = s.patchAs(jsonPatch, buyer, userPath, []gin.H{{"op": "remove", "path": "/age"}}); code != http.StatusOK || user["age"] != 0.0 {
+		t.Errorf("removing the age: got %d %v, want age 0", code, user)
+	}
+	if code, user = s.patchAs(mergePatch, admin, userPath, gin.H{"role": nil}); code != http.StatusOK || user["role"] != "customer" {
+		t.Errorf("clearing the role: got %d %v, want role customer", code, user)
+	}
+}
+
+func TestPatchCar(t *testing.T) {
+	s := newShop(t)
+	admin := s.signIn(adminEmail, adminPassword)
+	carPath := "/api/car/" + strconv.Itoa(s.addCar(admin))
+
+	code, car := s.patchAs("application/json-patch+json", admin, carPath+"?power_unit=kW", []gin.H{
+		{"op": "replace", "path": "/power/value", "value": 100},
+		{"op": "replace", "path": "/year", "value": 2021},
+	})
+	if code != http.StatusOK || car["year"] != 2021.0 || car["power"].(map[string]interface{})["value"] != 100.0 {
+		t.Errorf("JSON patch in kW: got %d %v", code, car)
+	}
+
+	// A patch of the unit alone converts the power.
+	for _, body := range []interface{}{
+		gin.H{"power": gin.H{"unit": "hp"}},
+		[]gin.H{{"op": "replace", "path": "/power/unit", "value": "hp"}},
+	} {
+		contentType := "application/merge-patch+json"
+		if _, ok := body.([]gin.H); ok {
+			contentType = "application/json-patch+json"
+		}
+		if code, car = s.patchAs(contentType, admin, carPath+"?power_unit=kW", body); code != http.StatusOK {
+			t.Errorf("patching the unit: got %d %v", code, car)
+		}
+		var got struct {
+			Power struct {
+				Value float64 `json:"value"`
+			} `json:"power"`
+		}
+		s.must(http.StatusOK, &got, admin, http.MethodGet, carPath+"?power_unit=kW", nil)
+		if got.Power.Value != 100 {
+			t.Errorf("power after patching the unit with %s: got %v kW, want 100", contentType, got.Power.Value)
+		}
+	}
+
+	if code, car = s.patchAs("application/merge-patch+json", admin, carPath, gin.H{"power": nil}); code != http.StatusUnprocessableEntity {
+		t.Errorf("clearing the power: got %d %v, want 422", code, car)
+	}
+	if code, car = s.patchAs("application/json", admin, carPath, gin.H{"name": ""}); code != http.StatusUnprocessableEntity {
+		t.Errorf("clearing the name: got %d %v, want 422", code, car)
+	}
+	if code, car = s.patchAs("application/json", admin, carPath, gin.H{"price": gin.H{"amount": 1}}); code != http.StatusUnprocessableEntity {
+		t.Errorf("patching the price: got %d %v, want 422", code, car)
+	}
+
+	w := s.doWith(http.Header{"Content-Type": {"application/xml"}}, admin, http.MethodPatch, carPath, nil)
+	if w.Code != http.StatusUnsupportedMediaType || w.Header().Get("Accept-Patch") == "" {
+		t.Errorf("unsupported type: got %d with Accept-Patch %q", w.Code, w.Header().Get("Accept-Patch"))
+	}
+}
+
+func TestPatchOrder(t *testing.T) {
+	s := newShop(t)
+	admin := s.signIn(adminEmail, adminPassword)
+	carID := s.addCar(admin, vins[0])
+	_, buyer := s.signUp(admin, "buyer@example.com", "customer")
+	_, other := s.signUp(admin, "other@example.com", "customer")
+	orderPath := "/api/orders/" + strconv.Itoa(s.order(buyer, carID))
+
+	const mergePatch = "application/merge-patch+json"
+
+	if code, order := s.patchAs(mergePatch, other, orderPath, gin.H{"status": "cancelled"}); code != http.StatusForbidden {
+		t.Errorf("patching someone else's order: got %d %v, want 403", code, order)
+	}
+	if code, order := s.patchAs(mergePatch, buyer, orderPath, gin.H{"status": "paid"}); code != http.StatusForbidden {
+		t.Errorf("customer marking their order paid: got %d %v, want 403", code, order)
+	}
+	if code, order := s.patchAs(mergePatch, buyer, orderPath, gin.H{"total": 0}); code != http.StatusUnprocessableEntity {
+		t.Errorf("patching the total: got %d %v, want 422", code, order)
+	}
+	if code, order := s.patchAs(mergePatch, admin, orderPath, gin.H{"status": "lost"}); code != http.StatusUnprocessableEntity {
+		t.Errorf("unknown status: got %d %v, want 422", code, order)
+	}
+	if code, order := s.patchAs(mergePatch, admin, orderPath, gin.H{"status": "delivered"}); code != http.StatusConflict {
+		t.Errorf("skipping ahead: got %d %v, want 409", code, order)
+	}
+
+	code, order := s.patchAs("application/json-patch+json", buyer, orderPath, []gin.H{
+		{"op": "test", "path": "/status", "value": "draft"},
+		{"op": "replace", "path": "/status", "value": "pending_payment"},
+	})
+	if code != http.StatusOK || order["status"] != "pending_payment" {
+		t.Errorf("checking out: got %d %v", code, order)
+	}
+}
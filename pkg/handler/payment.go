@@ -0,0 +1,207 @@
+package handler
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+
+	goapi "github.com/Stremilov/car-shop"
+	"github.com/Stremilov/car-shop/pkg/payment"
+	"github.com/gin-gonic/gin"
+)
+
+// maxWebhookBytes is how big a webhook body may be.
+const maxWebhookBytes = 64 << 10
+
+// @Summary      Pay for order
+// @Description  charge the total of an order pending payment to a payment method token; the order is paid once the money is captured, which for some payment methods happens later through a webhook. A retry with the same Idempotency-Key returns the first payment with 200 instead of charging again. A declined payment is created as failed and may be retried with a new key
+// @Tags         payments
+// @Accept       json
+// @Produce      json
+// @Param        orderID path string true "Order ID"
+// @Param        Idempotency-Key header string true "unique key of the payment attempt, at most 100 characters"
+// @Param request body goapi.PaymentInput true "body"
+// @Success      200  {object}  goapi.Payment  "replay of an earlier attempt with the same key"
+// @Success      201  {object}  goapi.Payment
+// @Header       201  {string}  Location  "URL of the payments of the order"
+// @Failure      400,401,403,404,409,422,500  {object}  handler.Problem
+// @Security     ApiKeyAuth
+// @Router       /api/orders/order/{orderID}/payments [post]
+func (h *Handler) payOrder(ctx *gin.Context) {
+	orderID, err := getIDParam(ctx, "orderID")
+	if err != nil {
+		badRequest(ctx, "Invalid order ID")
+		return
+	}
+
+	key := ctx.GetHeader(idempotencyKeyHeader)
+	if key == "" {
+		badRequest(ctx, "The Idempotency-Key header is required")
+		return
+	}
+
+	var input goapi.PaymentInput
+	if !bindJSON(ctx, &input) {
+		return
+	}
+
+	if !h.canAccessOrder(ctx, orderID) {
+		return
+	}
+
+	p, isNew, err := h.service.Payment.Pay(orderID, key, input, getIdentity(ctx).UserID)
+	if err != nil {
+		newErrorResponse(ctx, err)
+		return
+	}
+
+	if !isNew {
+		ctx.JSON(http.StatusOK, p)
+		return
+	}
+
+	created(ctx, ctx.Request.URL.Path, p)
+}
+
+// @Summary      Get order payments
+// @Description  get the payment attempts of an order, oldest first
+// @Tags         payments
+// @Accept       json
+// @Produce      json
+// @Param        orderID path string true "Order ID"
+// @Success      200  {array}   goapi.Payment
+// @Failure      400,401,403,404,500  {object}  handler.Problem
+// @Security     ApiKeyAuth
+// @Router       /api/orders/order/{orderID}/payments [get]
+func (h *Handler) getOrderPayments(ctx *gin.Context) {
+	orderID, err := getIDParam(ctx, "orderID")
+	if err != nil {
+		badRequest(ctx, "Invalid order ID")
+		return
+	}
+
+	if !h.canAccessOrder(ctx, orderID) {
+		return
+	}
+
+	payments, err := h.service.Payment.GetByOrderID(orderID)
+	if err != nil {
+		newErrorResponse(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, payments)
+}
+
+// @Summary      Capture payment
+// @Description  retry taking the money of an authorized payment and mark its order as paid
+// @Tags         payments
+// @Accept       json
+// @Produce      json
+// @Param        paymentID path string true "Payment ID"
+// @Success      200  {object}  goapi.Payment
+// @Failure      400,401,403,404,409,500  {object}  handler.Problem
+// @Security     ApiKeyAuth
+// @Router       /api/payments/{paymentID}/capture [post]
+func (h *Handler) capturePayment(ctx *gin.Context) {
+	paymentID, err := getIDParam(ctx, "paymentID")
+	if err != nil {
+		badRequest(ctx, "Invalid payment ID")
+		return
+	}
+
+	p, err := h.service.Payment.Capture(paymentID, getIdentity(ctx).UserID)
+	if err != nil {
+		newErrorResponse(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, p)
+}
+
+// @Summary      Refund payment
+// @Description  pay a captured payment back and mark its order as refunded
+// @Tags         payments
+// @Accept       json
+// @Produce      json
+// @Param        paymentID path string true "Payment ID"
+// @Success      200  {object}  goapi.Payment
+// @Failure      400,401,403,404,409,500  {object}  handler.Problem
+// @Security     ApiKeyAuth
+// @Router       /api/payments/{paymentID}/refund [post]
+func (h *Handler) refundPayment(ctx *gin.Context) {
+	paymentID, err := getIDParam(ctx, "paymentID")
+	if err != nil {
+		badRequest(ctx, "Invalid payment ID")
+		return
+	}
+
+	p, err := h.service.Payment.Refund(paymentID, getIdentity(ctx).UserID)
+	if err != nil {
+		newErrorResponse(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, p)
+}
+
+// @Summary      Payment webhook
+// @Description  receive a status change of a payment from the payment provider. The body must be signed with the webhook secret in the X-Payment-Signature header, as the hex HMAC-SHA256 of the body. Events may be delivered more than once
+// @Tags         payments
+// @Accept       json
+// @Produce      json
+// @Param        X-Payment-Signature header string true "hex HMAC-SHA256 of the body"
+// @Param request body payment.Event true "body"
+// @Success      200  {object}  goapi.Payment
+// @Failure      400,401,404,409,422,500  {object}  handler.Problem
+// @Router       /payments/webhook [post]
+func (h *Handler) paymentWebhook(ctx *gin.Context) {
+	body, err := io.ReadAll(io.LimitReader(ctx.Request.Body, maxWebhookBytes))
+	if err != nil {
+		badRequest(ctx, "Could not read the request body")
+		return
+	}
+
+	// The provider authenticates with the signature, not a token, so
+	// there is no WWW-Authenticate challenge.
+	if !h.service.Payment.VerifyWebhook(body, ctx.GetHeader(payment.SignatureHeader)) {
+		writeProblem(ctx, http.StatusUnauthorized, codeUnauthorized, "Invalid webhook signature", nil)
+		return
+	}
+
+	var event payment.Event
+	if err := json.Unmarshal(body, &event); err != nil {
+		badRequest(ctx, "Malformed webhook event")
+		return
+	}
+
+	p, err := h.service.Payment.HandleEvent(event)
+	if err != nil {
+		newErrorResponse(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, p)
+}
+
+// canAccessOrder checks that the caller may act on the order orderID and
+// answers the request if not.
+func (h *Handler) canAccessOrder(ctx *gin.Context, orderID int) bool {
+	identity := getIdentity(ctx)
+	if identity.Role.Can(goapi.PermManageOrders) {
+		return true
+	}
+
+	order, err := h.service.Order.GetByID(orderID)
+	if err != nil {
+		newErrorResponse(ctx, err)
+		return false
+	}
+
+	if order.User.UserID != identity.UserID {
+		forbiddenResponse(ctx, identity, goapi.PermManageOrders)
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,178 @@
+package handler_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/Stremilov/car-shop/pkg/payment"
+	"github.com/gin-gonic/gin"
+)
+
+type paymentResponse struct {
+	PaymentID   int    `json:"payment_id"`
+	ProviderRef string `json:"provider_ref"`
+	Status      string `json:"status"`
+}
+
+// pay pays for the order orderID with card on behalf of the holder of
+// token, with the idempotency key key, and fails the test unless the
+// response has status want. It returns the payment, if one was answered.
+func (s *shop) pay(want int, token string, orderID int, key, card string) paymentResponse {
+	s.t.Helper()
+
+	path := "/api/orders/order/" + strconv.Itoa(orderID) + "/payments"
+	w := s.doWith(http.Header{"Idempotency-Key": {key}}, token, http.MethodPost, path, gin.H{"token": card})
+	if w.Code != want {
+		s.t.Fatalf("POST %s: got %d, want %d: %s", path, w.Code, want, w.Body)
+	}
+
+	var p paymentResponse
+	if w.Code >= http.StatusMultipleChoices {
+		return p
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+		s.t.Fatal(err)
+	}
+
+	return p
+}
+
+// webhook sends body to the payment webhook with signature.
+func (s *shop) webhook(body []byte, signature string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/payments/webhook", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if signature != "" {
+		req.Header.Set(payment.SignatureHeader, signature)
+	}
+
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+
+	return w
+}
+
+func (s *shop) orderStatus(token string, orderID int) string {
+	s.t.Helper()
+
+	var order struct {
+		Status string `json:"status"`
+	}
+	s.must(http.StatusOK, &order, token, http.MethodGet, "/api/orders/order/"+strconv.Itoa(orderID), nil)
+
+	return order.Status
+}
+
+func TestPayOrder(t *testing.T) {
+	s := newShop(t)
+	admin := s.signIn(adminEmail, adminPassword)
+	carID := s.addCar(admin, vins...)
+	_, buyer := s.signUp(admin, "buyer@example.com", "customer")
+
+	orderID := s.order(buyer, carID)
+	s.must(http.StatusOK, nil, buyer, http.MethodPatch, "/api/orders/"+strconv.Itoa(orderID)+"/status", gin.H{"status": "pending_payment"})
+
+	declined := s.pay(http.StatusCreated, buyer, orderID, "key-1", payment.TokenDeclined)
+	if declined.Status != "failed" {
+		t.Fatalf("declined card: got status %s, want failed", declined.Status)
+	}
+
+	first := s.pay(http.StatusCreated, buyer, orderID, "key-2", "tok_visa")
+	retry := s.pay(http.StatusOK, buyer, orderID, "key-2", "tok_visa")
+	if first.Status != "captured" || retry != first {
+		t.Errorf("got %+v and then %+v, want the same captured payment", first, retry)
+	}
+
+	s.pay(http.StatusConflict, buyer, orderID, "key-3", "tok_visa")
+
+	if status := s.orderStatus(buyer, orderID); status != "paid" {
+		t.Errorf("got order status %s, want paid", status)
+	}
+}
+
+func TestPaymentWebhook(t *testing.T) {
+	s := newShop(t)
+	admin := s.signIn(adminEmail, adminPassword)
+	carID := s.addCar(admin, vins...)
+	_, buyer := s.signUp(admin, "buyer@example.com", "customer")
+
+	orderID := s.order(buyer, carID)
+	s.must(http.StatusOK, nil, buyer, http.MethodPatch, "/api/orders/"+strconv.Itoa(orderID)+"/status", gin.H{"status": "pending_payment"})
+
+	p := s.pay(http.StatusCreated, buyer, orderID, "key-1", payment.TokenPending)
+	if p.Status != "pending" {
+		t.Fatalf("got status %s, want pending", p.Status)
+	}
+
+	event := func(eventType string) []byte {
+		body, err := json.Marshal(payment.Event{ID: "evt_" + eventType, Type: eventType, PaymentRef: p.ProviderRef})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return body
+	}
+	authorized := event("payment.authorized")
+
+	tests := []struct {
+		name       string
+		body       []byte
+		signature  string
+		want       int
+		wantStatus string
+	}{
+		{"unsigned", authorized, "", http.StatusUnauthorized, "pending"},
+		{"signed with another secret", authorized, payment.Sign("another-secret", authorized), http.StatusUnauthorized, "pending"},
+		{"signature of another body", authorized, payment.Sign(webhookSecret, event("payment.failed")), http.StatusUnauthorized, "pending"},
+		{"malformed", []byte("{"), payment.Sign(webhookSecret, []byte("{")), http.StatusBadRequest, "pending"},
+		{"authorized", authorized, payment.Sign(webhookSecret, authorized), http.StatusOK, "captured"},
+		{"redelivered", authorized, payment.Sign(webhookSecret, authorized), http.StatusOK, "captured"},
+		{"failed after capture", event("payment.failed"), payment.Sign(webhookSecret, event("payment.failed")), http.StatusConflict, "captured"},
+	}
+
+	for _, tt := range tests {
+		if w := s.webhook(tt.body, tt.signature); w.Code != tt.want {
+			t.Errorf("%s: got %d, want %d: %s", tt.name, w.Code, tt.want, w.Body)
+		}
+
+		var payments []paymentResponse
+		s.must(http.StatusOK, &payments, buyer, http.MethodGet, "/api/orders/order/"+strconv.Itoa(orderID)+"/payments", nil)
+		if len(payments) != 1 || payments[0].Status != tt.wantStatus {
+			t.Errorf("%s: got payments %+v, want one %s", tt.name, payments, tt.wantStatus)
+		}
+	}
+
+	if status := s.orderStatus(buyer, orderID); status != "paid" {
+		t.Errorf("got order status %s, want paid", status)
+	}
+}
+
+func TestDeleteOrderWithPendingPayment(t *testing.T) {
+	s := newShop(t)
+	admin := s.signIn(adminEmail, adminPassword)
+	carID := s.addCar(admin, vins...)
+	_, buyer := s.signUp(admin, "buyer@example.com", "customer")
+
+	orderID := s.order(buyer, carID)
+	orderPath := "/api/orders/" + strconv.Itoa(orderID)
+	s.must(http.StatusOK, nil, buyer, http.MethodPatch, orderPath+"/status", gin.H{"status": "pending_payment"})
+	p := s.pay(http.StatusCreated, buyer, orderID, "key-1", payment.TokenPending)
+
+	s.must(http.StatusConflict, nil, buyer, http.MethodDelete, orderPath, nil)
+	s.must(http.StatusConflict, nil, admin, http.MethodDelete, orderPath, nil)
+
+	body, err := json.Marshal(payment.Event{ID: "evt_1", Type: "payment.authorized", PaymentRef: p.ProviderRef})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w := s.webhook(body, payment.Sign(webhookSecret, body)); w.Code != http.StatusOK {
+		t.Fatalf("webhook after the refused deletes: got %d, want 200: %s", w.Code, w.Body)
+	}
+	if status := s.orderStatus(buyer, orderID); status != "paid" {
+		t.Errorf("got order status %s, want paid", status)
+	}
+
+	s.must(http.StatusConflict, nil, admin, http.MethodDelete, orderPath, nil)
+}
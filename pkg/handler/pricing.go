@@ -0,0 +1,124 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	goapi "github.com/Stremilov/car-shop"
+	"github.com/gin-gonic/gin"
+)
+
+// @Summary      Add car price
+// @Description  schedule a list price of a car, in cents, taking effect at effective_from (default now); orders keep the prices they were placed at
+// @Tags         pricing
+// @Accept       json
+// @Produce      json
+// @Param        carID path string true "Car ID"
+// @Param request body goapi.CarPrice true "body"
+// @Param        Idempotency-Key header string false "makes the request safe to retry: a retry with the same key and body gets the first response again"
+// @Success      201  {object}  goapi.CarPrice
+// @Header       201  {string}  Location  "URL of the price schedule of the car"
+// @Failure      400,401,403,404,409,422,500  {object}  handler.Problem
+// @Security     ApiKeyAuth
+// @Router       /api/car/{carID}/prices [post]
+func (h *Handler) addCarPrice(ctx *gin.Context) {
+	carID, err := getIDParam(ctx, "carID")
+	if err != nil {
+		badRequest(ctx, "Invalid car ID")
+		return
+	}
+
+	var input goapi.CarPrice
+	if !bindJSON(ctx, &input) {
+		return
+	}
+
+	price, err := h.service.Pricing.AddCarPrice(carID, input)
+	if err != nil {
+		newErrorResponse(ctx, err)
+		return
+	}
+
+	created(ctx, "/api/car/"+strconv.Itoa(carID)+"/prices", price)
+}
+
+// @Summary      Get car prices
+// @Description  get the price schedule of a car, past and future prices included, by the time they take effect
+// @Tags         pricing
+// @Accept       json
+// @Produce      json
+// @Param        carID path string true "Car ID"
+// @Success      200  {array}   goapi.CarPrice
+// @Failure      400,401,403,404,500  {object}  handler.Problem
+// @Security     ApiKeyAuth
+// @Router       /api/car/{carID}/prices [get]
+func (h *Handler) getCarPrices(ctx *gin.Context) {
+	carID, err := getIDParam(ctx, "carID")
+	if err != nil {
+		badRequest(ctx, "Invalid car ID")
+		return
+	}
+
+	prices, err := h.service.Pricing.GetCarPrices(carID)
+	if err != nil {
+		newErrorResponse(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, prices)
+}
+
+// @Summary      Add discount
+// @Description  add a percent or fixed discount off every vehicle of car_id or, without one, off whole orders. With a code it is a promo code that only applies when given with an order
+// @Tags         pricing
+// @Accept       json
+// @Produce      json
+// @Param request body goapi.Discount true "body"
+// @Param        Idempotency-Key header string false "makes the request safe to retry: a retry with the same key and body gets the first response again"
+// @Success      201  {object}  goapi.Discount
+// @Failure      400,401,403,409,422,500  {object}  handler.Problem
+// @Security     ApiKeyAuth
+// @Router       /api/discounts/ [post]
+func (h *Handler) addDiscount(ctx *gin.Context) {
+	var input goapi.Discount
+	if !bindJSON(ctx, &input) {
+		return
+	}
+
+	discount, err := h.service.Pricing.CreateDiscount(input)
+	if err != nil {
+		newErrorResponse(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, discount)
+}
+
+// @Summary      Get all discounts
+// @Description  get a page of discounts and promo codes
+// @Tags         pricing
+// @Accept       json
+// @Produce      json
+// @Param        limit     query  int     false  "page size (default 20, max 100)"
+// @Param        offset    query  int     false  "number of discounts to skip"
+// @Param        cursor    query  string  false  "next_cursor of the previous page"
+// @Param        sort      query  string  false  "sort field, prefix with - for descending"  Enums(id, -id, code, -code, valid_from, -valid_from, valid_to, -valid_to)
+// @Success      200  {object} goapi.Page[goapi.Discount]
+// @Failure      400,401,403,422,500  {object}  handler.Problem
+// @Security     ApiKeyAuth
+// @Router       /api/discounts/get-all [get]
+func (h *Handler) getAllDiscounts(ctx *gin.Context) {
+	params, err := parseListParams(ctx)
+	if err != nil {
+		badRequest(ctx, err.Error())
+		return
+	}
+
+	discounts, err := h.service.Pricing.GetAllDiscounts(params)
+	if err != nil {
+		newErrorResponse(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, discounts)
+}
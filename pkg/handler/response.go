@@ -0,0 +1,113 @@
+package handler
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/Stremilov/car-shop/pkg/service"
+	"github.com/gin-gonic/gin"
+)
+
+const problemContentType = "application/problem+json"
+
+// Problem codes, one per kind of failure.
+const (
+	codeBadRequest           = "bad_request"
+	codeValidation           = "validation_failed"
+	codeUnauthorized         = "unauthorized"
+	codeForbidden            = "forbidden"
+	codeNotFound             = "not_found"
+	codeMethodNotAllowed     = "method_not_allowed"
+	codeUnsupportedMediaType = "unsupported_media_type"
+	codeConflict             = "conflict"
+	codePreconditionFailed   = "precondition_failed"
+	codePreconditionRequired = "precondition_required"
+	codeInternal             = "internal_error"
+)
+
+// Problem is the body of every error response: an RFC 7807 problem details
+// object extended with a machine readable code, optional details and the
+// ID of the request for log correlation.
+type Problem struct {
+	Type      string      `json:"type" example:"urn:car-shop:problem:not_found"`
+	Title     string      `json:"title" example:"Not Found"`
+	Status    int         `json:"status" example:"404"`
+	Detail    string      `json:"detail" example:"car 7 not found"`
+	Instance  string      `json:"instance" example:"/api/car/7"`
+	Code      string      `json:"code" example:"not_found"`
+	Details   interface{} `json:"details,omitempty" swaggertype:"object"`
+	RequestID string      `json:"request_id,omitempty" example:"3f2b9c1e4d5a6b7c"`
+}
+
+// writeProblem aborts the request with a problem response.
+func writeProblem(ctx *gin.Context, status int, code, detail string, details interface{}) {
+	problem := Problem{
+		Type:      "urn:car-shop:problem:" + code,
+		Title:     http.StatusText(status),
+		Status:    status,
+		Detail:    detail,
+		Instance:  ctx.Request.URL.Path,
+		Code:      code,
+		Details:   details,
+		RequestID: ctx.GetString(requestIDCtx),
+	}
+
+	ctx.Abort()
+	ctx.Render(status, problemRender{problem})
+}
+
+// created answers a POST with 201, the new entity and its location.
+func created(ctx *gin.Context, location string, entity interface{}) {
+	ctx.Header("Location", location)
+	ctx.JSON(http.StatusCreated, entity)
+}
+
+// newErrorResponse maps err to a problem response. Domain errors from the
+// service layer keep their message; anything else is logged and hidden
+// behind a 500.
+func newErrorResponse(ctx *gin.Context, err error) {
+	switch service.KindOf(err) {
+	case service.KindInvalid:
+		writeProblem(ctx, http.StatusUnprocessableEntity, codeValidation, err.Error(), serviceFields(err))
+	case service.KindNotFound:
+		writeProblem(ctx, http.StatusNotFound, codeNotFound, err.Error(), nil)
+	case service.KindConflict:
+		writeProblem(ctx, http.StatusConflict, codeConflict, err.Error(), serviceDetails(err))
+	case service.KindPreconditionFailed:
+		writeProblem(ctx, http.StatusPreconditionFailed, codePreconditionFailed, err.Error(), nil)
+	case service.KindUnauthorized:
+		unauthorizedResponse(ctx, err.Error())
+	default:
+		slog.Error("Request failed",
+			"method", ctx.Request.Method,
+			"path", ctx.Request.URL.Path,
+			"request_id", ctx.GetString(requestIDCtx),
+			"error", err)
+		writeProblem(ctx, http.StatusInternalServerError, codeInternal, "Internal server error", nil)
+	}
+}
+
+// badRequest reports a request that could not be parsed at all, as opposed
+// to one that parsed but failed validation.
+func badRequest(ctx *gin.Context, detail string) {
+	writeProblem(ctx, http.StatusBadRequest, codeBadRequest, detail, nil)
+}
+
+func unauthorizedResponse(ctx *gin.Context, detail string) {
+	ctx.Header("WWW-Authenticate", `Bearer realm="car-shop"`)
+	writeProblem(ctx, http.StatusUnauthorized, codeUnauthorized, detail, nil)
+}
+
+type problemRender struct {
+	problem Problem
+}
+
+func (r problemRender) Render(w http.ResponseWriter) error {
+	r.WriteContentType(w)
+	return json.NewEncoder(w).Encode(r.problem)
+}
+
+func (r problemRender) WriteContentType(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", problemContentType)
+}
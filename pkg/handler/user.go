@@ -1,138 +1,170 @@
 package handler
 
 import (
-	"database/sql"
-	"fmt"
 	"net/http"
 	"strconv"
-	"strings"
 
+	goapi "github.com/Stremilov/car-shop"
 	"github.com/gin-gonic/gin"
 )
 
-type User struct {
-	UserID    int    `json:"user_id"`
-	FirstName string `json:"first_name"`
-	LastName  string `json:"last_name"`
-	Age       int    `json:"age"`
-}
-
-type UserUpdate struct {
-	FirstName *string `json:"first_name,omitempty"`
-	LastName  *string `json:"last_name,omitempty"`
-	Age       *int    `json:"age,omitempty"`
-}
-
 // @Summary      Add new user
 // @Description  add user to the database
 // @Tags         users
 // @Accept       json
 // @Produce      json
-// @Param request body User true "body"
-// @Success      201  {object}  User
+// @Param request body goapi.User true "body"
+// @Param        Idempotency-Key header string false "makes the request safe to retry: a retry with the same key and body gets the first response again"
+// @Success      201  {object}  goapi.User
+// @Header       201  {string}  Location  "URL of the new user"
+// @Failure      400,401,403,409,422,500  {object}  handler.Problem
+// @Security     ApiKeyAuth
 // @Router       /api/user/ [post]
 func (h *Handler) addUser(ctx *gin.Context) {
-	var p User
+	var p goapi.User
 
-	if err := ctx.ShouldBindJSON(&p); err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+	if !bindJSON(ctx, &p) {
 		return
 	}
 
-	query := "INSERT INTO people (first_name, last_name, age) VALUES ($1, $2, $3)"
-	_, err := db.Exec(query, p.FirstName, p.LastName, p.Age)
+	user, err := h.service.User.Create(p)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to insert data into database"})
+		newErrorResponse(ctx, err)
 		return
 	}
 
-	ctx.JSON(http.StatusCreated, gin.H{"message": "Person added successfully"})
-
+	created(ctx, "/api/user/"+strconv.Itoa(user.UserID), user)
 }
 
 // @Summary      Get all users
-// @Description  get all users from database
+// @Description  get a page of users, optionally filtered by age
 // @Tags         users
 // @Accept       json
 // @Produce      json
-// @Success      200  {object}  User
+// @Param        limit   query  int     false  "page size (default 20, max 100)"
+// @Param        offset  query  int     false  "number of users to skip"
+// @Param        cursor  query  string  false  "next_cursor of the previous page"
+// @Param        sort    query  string  false  "sort field, prefix with - for descending"  Enums(id, -id, first_name, -first_name, last_name, -last_name, age, -age, role, -role)
+// @Param        age_min query  int     false  "minimum age"
+// @Param        age_max query  int     false  "maximum age"
+// @Param        role    query  string  false  "role"  Enums(customer, sales, admin)
+// @Param        include_deleted query bool false "list soft deleted users too (admins only)"
+// @Success      200  {object}  goapi.Page[goapi.User]
+// @Failure      400,401,403,422,500  {object}  handler.Problem
+// @Security     ApiKeyAuth
 // @Router       /api/user/get-all [get]
 func (h *Handler) getAllUsers(ctx *gin.Context) {
-	rows, err := db.Query("SELECT first_name, last_name, age FROM people")
+	params, err := parseListParams(ctx)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query database"})
+		badRequest(ctx, err.Error())
 		return
 	}
-	defer rows.Close()
 
-	var people []User
-	for rows.Next() {
-		var p User
-		if err := rows.Scan(&p.FirstName, &p.LastName, &p.Age); err != nil {
-			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan row"})
-			return
-		}
-		people = append(people, p)
+	var filter goapi.UserFilter
+	if filter.AgeMin, err = queryInt(ctx, "age_min"); err != nil {
+		badRequest(ctx, err.Error())
+		return
+	}
+	if filter.AgeMax, err = queryInt(ctx, "age_max"); err != nil {
+		badRequest(ctx, err.Error())
+		return
+	}
+	filter.Role = goapi.Role(ctx.Query("role"))
+
+	include, ok := includeDeleted(ctx)
+	if !ok {
+		return
+	}
+	if include {
+		filter.Deleted = goapi.IncludeDeleted
+	}
+
+	people, err := h.service.User.GetAll(filter, params)
+	if err != nil {
+		newErrorResponse(ctx, err)
+		return
 	}
 
 	ctx.JSON(http.StatusOK, people)
 }
 
 // @Summary      Update user info by id
-// @Description  update user info by user id
+// @Description  update a user with a JSON merge patch (application/merge-patch+json, or plain application/json) or a JSON patch (application/json-patch+json) of the fields in the body. Clearing the age, with null or a remove, sets it to 0 and clearing the role makes the user a customer; the names cannot be cleared. The patched user is validated as a whole
 // @Tags         users
-// @Accept       json
+// @Accept       json,application/merge-patch+json,application/json-patch+json
 // @Produce      json
 // @Param        userID path string true "User ID"
-// @Param request body User true "body"
-// @Success      201  {object}  User
+// @Param        If-Match header string false "ETag of the user as read, the update fails with 412 if they changed since or do not exist"
+// @Param request body goapi.UserUpdate true "the fields that can be patched"
+// @Success      200  {object}  goapi.User
+// @Header       200  {string}  ETag  "version of the updated user"
+// @Failure      400,401,403,404,409,412,415,422,428,500  {object}  handler.Problem
+// @Security     ApiKeyAuth
 // @Router       /api/user/{userID} [patch]
 func (h *Handler) updateUserInfoByID(ctx *gin.Context) {
-	userID := ctx.Param("userID")
-
-	var userUpdate UserUpdate
+	userID, err := getIDParam(ctx, "userID")
+	if err != nil {
+		badRequest(ctx, "Invalid user ID")
+		return
+	}
 
-	if err := ctx.ShouldBindJSON(&userUpdate); err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+	identity := getIdentity(ctx)
+	if !identity.CanAccessUser(userID, goapi.PermManageUsers) {
+		forbiddenResponse(ctx, identity, goapi.PermManageUsers)
 		return
 	}
 
-	values := []interface{}{}
-	setClauses := []string{}
+	version, ok := h.ifMatch(ctx)
+	if !ok {
+		return
+	}
 
-	if userUpdate.FirstName != nil {
-		setClauses = append(setClauses, "first_name = $1")
-		values = append(values, *userUpdate.FirstName)
+	p, ok := bindPatch(ctx)
+	if !ok {
+		return
 	}
 
-	if userUpdate.LastName != nil {
-		setClauses = append(setClauses, "last_name = $"+strconv.Itoa(len(values)+1))
-		values = append(values, *userUpdate.LastName)
+	user, err := h.service.User.GetByID(userID)
+	if err != nil {
+		conditionalError(ctx, err)
+		return
 	}
 
-	if userUpdate.Age != nil {
-		setClauses = append(setClauses, "age = $"+strconv.Itoa(len(values)+1))
-		values = append(values, *userUpdate.Age)
+	userUpdate, err := h.service.User.ApplyPatch(user, p)
+	if err != nil {
+		newErrorResponse(ctx, err)
+		return
 	}
 
-	if len(setClauses) == 0 {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "No fields to update"})
+	if userUpdate.Role != nil && !identity.Role.Can(goapi.PermManageUsers) {
+		forbiddenResponse(ctx, identity, goapi.PermManageUsers)
 		return
 	}
 
-	query := fmt.Sprintf("UPDATE people SET %s WHERE id = $%d;",
-		strings.Join(setClauses, ", "), len(values)+1)
+	// A patch that changes nothing, such as one that only tests, leaves
+	// the user as is.
+	if userUpdate == (goapi.UserUpdate{}) {
+		if checkVersion(ctx, version, user.Version) {
+			setETag(ctx, user.Version)
+			ctx.JSON(http.StatusOK, user)
+		}
+		return
+	}
 
-	values = append(values, userID)
+	// Without If-Match the patch still must not overwrite changes made
+	// since the user was read to apply it; such a change fails it with 409.
+	if version == 0 {
+		version = user.Version
+	}
 
-	_, err := db.Exec(query, values...)
+	user, err = h.service.User.Update(userID, userUpdate, version)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid request payload"})
+		conditionalError(ctx, err)
 		return
 	}
 
-	ctx.JSON(http.StatusOK, gin.H{"message": "Data updated successfully"})
-
+	setETag(ctx, user.Version)
+	ctx.JSON(http.StatusOK, user)
 }
 
 // @Summary      Get user info by id
@@ -141,68 +173,141 @@ func (h *Handler) updateUserInfoByID(ctx *gin.Context) {
 // @Accept       json
 // @Produce      json
 // @Param        userID path string true "User ID"
-// @Success      200  {object}  User
+// @Param        include_deleted query bool false "find the user even if soft deleted (admins only)"
+// @Success      200  {object}  goapi.User
+// @Header       200  {string}  ETag  "version of the user, to send back in If-Match"
+// @Failure      400,401,403,404,500  {object}  handler.Problem
+// @Security     ApiKeyAuth
 // @Router       /api/user/{userID} [get]
 func (h *Handler) getUserByID(ctx *gin.Context) {
-	userID := ctx.Param("userID")
-
-	query := `
-	SELECT 
-		people.first_name,
-		people.last_name,
-		people.age
-	FROM 
-		people
-	WHERE 
-		people.id = $1
-	`
-
-	row := db.QueryRow(query, userID)
-
-	var user User
-	if err := row.Scan(&user.FirstName, &user.LastName, &user.Age); err != nil {
-		if err == sql.ErrNoRows {
-			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid request"})
-			return
-		}
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan row"})
+	userID, err := getIDParam(ctx, "userID")
+	if err != nil {
+		badRequest(ctx, "Invalid user ID")
+		return
+	}
 
+	identity := getIdentity(ctx)
+	if !identity.CanAccessUser(userID, goapi.PermManageUsers) {
+		forbiddenResponse(ctx, identity, goapi.PermManageUsers)
 		return
 	}
 
+	include, ok := includeDeleted(ctx)
+	if !ok {
+		return
+	}
+
+	getUser := h.service.User.GetByID
+	if include {
+		getUser = h.service.User.GetByIDWithDeleted
+	}
+
+	user, err := getUser(userID)
+	if err != nil {
+		newErrorResponse(ctx, err)
+		return
+	}
+
+	setETag(ctx, user.Version)
 	ctx.JSON(http.StatusOK, user)
 }
 
 // @Summary      Delete user info by id
-// @Description  delete user info by user id
+// @Description  delete a user the way the deletion policy of the server says: for good unless they have orders (409 listing the order_ids in details), or softly, keeping them for their orders and to be restored until they are purged. Admins can delete the user with their orders with force=true
 // @Tags         users
 // @Accept       json
 // @Produce      json
 // @Param        userID path string true "User ID"
-// @Success      200  {object}  User
+// @Param        force  query bool   false "delete the orders of the user too (admins only)"
+// @Param        If-Match header string false "ETag of the user as read, the delete fails with 412 if they changed since or do not exist"
+// @Success      200
+// @Failure      400,401,403,404,409,412,428,500  {object}  handler.Problem
+// @Security     ApiKeyAuth
 // @Router       /api/user/{userID} [delete]
 func (h *Handler) deleteUserByID(ctx *gin.Context) {
-	userID := ctx.Param("userID")
+	userID, err := getIDParam(ctx, "userID")
+	if err != nil {
+		badRequest(ctx, "Invalid user ID")
+		return
+	}
+
+	force, ok := forceRequested(ctx)
+	if !ok {
+		return
+	}
+
+	version, ok := h.ifMatch(ctx)
+	if !ok {
+		return
+	}
+
+	deleteUser := h.service.User.Delete
+	if force {
+		deleteUser = h.service.User.ForceDelete
+	}
+
+	if err := deleteUser(userID, version); err != nil {
+		conditionalError(ctx, err)
+		return
+	}
 
-	query := `DELETE FROM people WHERE id = $1`
+	ctx.Status(http.StatusOK)
 
-	result, err := db.Exec(query, userID)
+}
+
+// @Summary      Get deleted users
+// @Description  get a page of the soft deleted users, which are purged for good once they are past the retention period and have no orders
+// @Tags         users
+// @Accept       json
+// @Produce      json
+// @Param        limit   query  int     false  "page size (default 20, max 100)"
+// @Param        offset  query  int     false  "number of users to skip"
+// @Param        cursor  query  string  false  "next_cursor of the previous page"
+// @Param        sort    query  string  false  "sort field, prefix with - for descending"  Enums(id, -id, first_name, -first_name, last_name, -last_name, age, -age, role, -role)
+// @Success      200  {object}  goapi.Page[goapi.User]
+// @Failure      400,401,403,422,500  {object}  handler.Problem
+// @Security     ApiKeyAuth
+// @Router       /api/user/trash [get]
+func (h *Handler) getDeletedUsers(ctx *gin.Context) {
+	params, err := parseListParams(ctx)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		badRequest(ctx, err.Error())
 		return
 	}
 
-	rowsAffected, err := result.RowsAffected()
+	people, err := h.service.User.GetAll(goapi.UserFilter{Deleted: goapi.OnlyDeleted}, params)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		newErrorResponse(ctx, err)
 		return
 	}
 
-	if rowsAffected == 0 {
-		ctx.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+	ctx.JSON(http.StatusOK, people)
+}
+
+// @Summary      Restore user
+// @Description  bring back a soft deleted user. They have to sign in again
+// @Tags         users
+// @Accept       json
+// @Produce      json
+// @Param        userID path string true "User ID"
+// @Success      200  {object}  goapi.User
+// @Header       200  {string}  ETag  "version of the restored user"
+// @Failure      400,401,403,404,409,500  {object}  handler.Problem
+// @Security     ApiKeyAuth
+// @Router       /api/user/{userID}/restore [post]
+func (h *Handler) restoreUser(ctx *gin.Context) {
+	userID, err := getIDParam(ctx, "userID")
+	if err != nil {
+		badRequest(ctx, "Invalid user ID")
 		return
 	}
 
-	ctx.Status(http.StatusOK)
+	user, err := h.service.User.Restore(userID)
+	if err != nil {
+		newErrorResponse(ctx, err)
+		return
+	}
 
+	setETag(ctx, user.Version)
+	ctx.JSON(http.StatusOK, user)
 }
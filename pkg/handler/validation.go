@@ -0,0 +1,172 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	goapi "github.com/Stremilov/car-shop"
+	"github.com/Stremilov/car-shop/pkg/patch"
+	"github.com/Stremilov/car-shop/pkg/service"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// FieldError reports one input field that failed validation.
+type FieldError struct {
+	Field  string `json:"field" example:"age"`
+	Reason string `json:"reason" example:"age must be at most 150"`
+}
+
+func init() {
+	v, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		return
+	}
+
+	// Report fields under their JSON names, as the client sent them.
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			return ""
+		}
+
+		return name
+	})
+
+	// notfuture rejects years after the next one, so that next year's
+	// models can already be listed.
+	_ = v.RegisterValidation("notfuture", func(fl validator.FieldLevel) bool {
+		return fl.Field().Int() <= int64(time.Now().Year()+1)
+	})
+
+	_ = v.RegisterValidation("vin", func(fl validator.FieldLevel) bool {
+		return goapi.ValidVIN(fl.Field().String())
+	})
+}
+
+// bindJSON decodes the request body into obj and checks its binding rules.
+// A body that cannot be decoded is a 400; one that breaks the rules is a
+// 422 listing every failing field. It reports whether the request may go on.
+func bindJSON(ctx *gin.Context, obj interface{}) bool {
+	err := ctx.ShouldBindJSON(obj)
+	if err == nil {
+		return true
+	}
+
+	var invalid validator.ValidationErrors
+	if !errors.As(err, &invalid) {
+		badRequest(ctx, "Invalid request payload")
+		return false
+	}
+
+	fields := make([]FieldError, 0, len(invalid))
+	for _, fe := range invalid {
+		fields = append(fields, FieldError{Field: fieldPath(fe), Reason: fieldReason(fe)})
+	}
+
+	writeProblem(ctx, http.StatusUnprocessableEntity, codeValidation, "Request validation failed", fields)
+	return false
+}
+
+// acceptPatch lists the patch types the PATCH endpoints take.
+var acceptPatch = patch.MergePatchType + ", " + patch.JSONPatchType
+
+// bindPatch reads the request body as a patch of its Content-Type. Plain
+// JSON is taken for a merge patch, which is what clients sent before
+// patches had types of their own. An unknown type is a 415 and a body that
+// is not a patch a 400.
+func bindPatch(ctx *gin.Context) (patch.Patch, bool) {
+	contentType := ctx.ContentType()
+	switch contentType {
+	case "", binding.MIMEJSON:
+		contentType = patch.MergePatchType
+	case patch.MergePatchType, patch.JSONPatchType:
+	default:
+		ctx.Header("Accept-Patch", acceptPatch)
+		writeProblem(ctx, http.StatusUnsupportedMediaType, codeUnsupportedMediaType,
+			fmt.Sprintf("Content-Type must be %s or %s", acceptPatch, binding.MIMEJSON), nil)
+		return nil, false
+	}
+
+	body, err := ctx.GetRawData()
+	if err != nil {
+		badRequest(ctx, "Invalid request payload")
+		return nil, false
+	}
+
+	p, err := patch.Parse(contentType, body)
+	if err != nil {
+		badRequest(ctx, err.Error())
+		return nil, false
+	}
+
+	return p, true
+}
+
+// serviceFields returns the field list of a service validation error.
+func serviceFields(err error) []FieldError {
+	var e *service.Error
+	if !errors.As(err, &e) || e.Field == "" {
+		return nil
+	}
+
+	return []FieldError{{Field: e.Field, Reason: e.Message}}
+}
+
+// serviceDetails returns the details of a service error, if any.
+func serviceDetails(err error) interface{} {
+	var e *service.Error
+	if !errors.As(err, &e) {
+		return nil
+	}
+
+	return e.Details
+}
+
+// fieldPath names the field by its JSON path from the body root, such as
+// power.unit for a nested field.
+func fieldPath(fe validator.FieldError) string {
+	_, path, _ := strings.Cut(fe.Namespace(), ".")
+	return path
+}
+
+func fieldReason(fe validator.FieldError) string {
+	field, param := fieldPath(fe), fe.Param()
+	isString := fe.Kind() == reflect.String
+
+	switch fe.Tag() {
+	case "required":
+		return fmt.Sprintf("%s is required", field)
+	case "min":
+		if isString {
+			return fmt.Sprintf("%s must be at least %s characters long", field, param)
+		}
+		return fmt.Sprintf("%s must be at least %s", field, param)
+	case "gt":
+		return fmt.Sprintf("%s must be greater than %s", field, param)
+	case "max":
+		if isString {
+			return fmt.Sprintf("%s must be at most %s characters long", field, param)
+		}
+		return fmt.Sprintf("%s must be at most %s", field, param)
+	case "oneof":
+		return fmt.Sprintf("%s must be one of %s", field, strings.ReplaceAll(param, " ", ", "))
+	case "email":
+		return fmt.Sprintf("%s must be a valid email address", field)
+	case "iso4217":
+		return fmt.Sprintf("%s must be an ISO 4217 code such as EUR", field)
+	case "alphanum":
+		return fmt.Sprintf("%s must only contain letters and digits", field)
+	case "vin":
+		return fmt.Sprintf("%s must be 17 letters and digits, without I, O and Q", field)
+	case "notfuture":
+		return fmt.Sprintf("%s must not be later than %d", field, time.Now().Year()+1)
+	}
+
+	return fmt.Sprintf("%s failed the %s rule", field, fe.Tag())
+}
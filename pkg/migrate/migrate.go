@@ -0,0 +1,351 @@
+// Package migrate applies the versioned SQL migrations embedded in the
+// binary. Migrations live in migrations/ as NNNNNN_name.up.sql and
+// NNNNNN_name.down.sql pairs; applied versions are recorded in the
+// schema_migrations table.
+package migrate
+
+import (
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// lockID is the key of the advisory lock that keeps two processes from
+// migrating the same database at once.
+const lockID = 72_616_368
+
+var ErrNoMigrations = errors.New("no migrations to roll back")
+
+// ErrSchemaAhead means the database has migrations applied that the binary
+// does not know, usually because a newer release migrated it.
+var ErrSchemaAhead = errors.New("database schema is newer than this binary")
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+type Status struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+}
+
+func New(db *sql.DB) (*Migrator, error) {
+	migrations, err := load(migrationFiles)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+func load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, "migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, e := range entries {
+		name := e.Name()
+
+		var direction string
+		switch {
+		case strings.HasSuffix(name, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(name, ".down.sql"):
+			direction = "down"
+		default:
+			return nil, fmt.Errorf("migration %s: expected .up.sql or .down.sql suffix", name)
+		}
+
+		base := strings.TrimSuffix(name, "."+direction+".sql")
+		prefix, title, ok := strings.Cut(base, "_")
+		version, err := strconv.Atoi(prefix)
+		if !ok || err != nil || version <= 0 {
+			return nil, fmt.Errorf("migration %s: expected NNNNNN_name prefix", name)
+		}
+
+		body, err := fs.ReadFile(fsys, "migrations/"+name)
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: title}
+			byVersion[version] = m
+		}
+		if m.Name != title {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, m.Name, title)
+		}
+
+		if direction == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s needs both up and down files", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	return migrations, nil
+}
+
+func (m *Migrator) ensureTable() error {
+	_, err := m.db.Exec(`
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name VARCHAR(255) NOT NULL,
+		applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`)
+
+	return err
+}
+
+func (m *Migrator) applied() (map[int]time.Time, error) {
+	if err := m.ensureTable(); err != nil {
+		return nil, err
+	}
+
+	return m.readApplied()
+}
+
+// querier is a database or a transaction.
+type querier interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+func (m *Migrator) readApplied() (map[int]time.Time, error) {
+	return readApplied(m.db)
+}
+
+func readApplied(q querier) (map[int]time.Time, error) {
+	rows, err := q.Query(`SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int]time.Time{}
+	for rows.Next() {
+		var version int
+		var at time.Time
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+		applied[version] = at
+	}
+
+	return applied, rows.Err()
+}
+
+// Status lists every known migration and whether it has been applied.
+func (m *Migrator) Status() ([]Status, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, 0, len(m.migrations))
+	for _, mig := range m.migrations {
+		at, ok := applied[mig.Version]
+		statuses = append(statuses, Status{Migration: mig, Applied: ok, AppliedAt: at})
+	}
+
+	return statuses, nil
+}
+
+// Check returns the migrations that have not been applied yet without
+// changing the database, not even to create the schema_migrations table.
+// It fails with ErrSchemaAhead if a migration newer than the newest one
+// embedded has been applied.
+func (m *Migrator) Check() ([]Migration, error) {
+	var exists bool
+	if err := m.db.QueryRow(`SELECT to_regclass('schema_migrations') IS NOT NULL`).Scan(&exists); err != nil {
+		return nil, err
+	}
+	if !exists {
+		return m.migrations, nil
+	}
+
+	applied, err := m.readApplied()
+	if err != nil {
+		return nil, err
+	}
+	if err := m.checkAhead(applied); err != nil {
+		return nil, err
+	}
+
+	var pending []Migration
+	for _, mig := range m.migrations {
+		if _, ok := applied[mig.Version]; !ok {
+			pending = append(pending, mig)
+		}
+	}
+
+	return pending, nil
+}
+
+// checkAhead fails with ErrSchemaAhead if applied has a migration newer
+// than the newest one embedded.
+func (m *Migrator) checkAhead(applied map[int]time.Time) error {
+	latest := 0
+	if len(m.migrations) > 0 {
+		latest = m.migrations[len(m.migrations)-1].Version
+	}
+	for version := range applied {
+		if version > latest {
+			return fmt.Errorf("%w: migration %d is applied, the newest one known is %d", ErrSchemaAhead, version, latest)
+		}
+	}
+
+	return nil
+}
+
+// Pending returns the migrations that have not been applied yet.
+func (m *Migrator) Pending() ([]Migration, error) {
+	statuses, err := m.Status()
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []Migration
+	for _, s := range statuses {
+		if !s.Applied {
+			pending = append(pending, s.Migration)
+		}
+	}
+
+	return pending, nil
+}
+
+// Up applies all pending migrations in order, each in its own transaction,
+// and returns the ones it applied. Like Check it fails with ErrSchemaAhead
+// on a database a newer binary migrated, which it leaves as is.
+func (m *Migrator) Up() ([]Migration, error) {
+	if err := m.ensureTable(); err != nil {
+		return nil, err
+	}
+
+	pending, err := m.Check()
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for _, mig := range pending {
+		err := m.inTx(func(tx *sql.Tx) error {
+			// Another process may have migrated the database since
+			// Check, so the applied versions are read again under the
+			// lock.
+			applied, err := readApplied(tx)
+			if err != nil {
+				return err
+			}
+			if err := m.checkAhead(applied); err != nil {
+				return err
+			}
+			if _, ok := applied[mig.Version]; ok {
+				return nil
+			}
+
+			if _, err := tx.Exec(mig.Up); err != nil {
+				return err
+			}
+
+			_, err = tx.Exec(`INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`, mig.Version, mig.Name)
+			return err
+		})
+		if err != nil {
+			return done, fmt.Errorf("migration %d_%s: %w", mig.Version, mig.Name, err)
+		}
+		done = append(done, mig)
+	}
+
+	return done, nil
+}
+
+// Down rolls back the most recently applied migration. It picks the
+// migration under the lock, so that two processes rolling back at once roll
+// back one migration each, and fails with ErrSchemaAhead rather than roll
+// back under a migration it does not know.
+func (m *Migrator) Down() (Migration, error) {
+	if err := m.ensureTable(); err != nil {
+		return Migration{}, err
+	}
+
+	var mig Migration
+	err := m.inTx(func(tx *sql.Tx) error {
+		applied, err := readApplied(tx)
+		if err != nil {
+			return err
+		}
+		if err := m.checkAhead(applied); err != nil {
+			return err
+		}
+
+		for i := len(m.migrations) - 1; i >= 0; i-- {
+			if _, ok := applied[m.migrations[i].Version]; !ok {
+				continue
+			}
+
+			mig = m.migrations[i]
+			if _, err := tx.Exec(mig.Down); err != nil {
+				return fmt.Errorf("migration %d_%s: %w", mig.Version, mig.Name, err)
+			}
+
+			_, err := tx.Exec(`DELETE FROM schema_migrations WHERE version = $1`, mig.Version)
+			if err != nil {
+				return fmt.Errorf("migration %d_%s: %w", mig.Version, mig.Name, err)
+			}
+			return nil
+		}
+
+		return ErrNoMigrations
+	})
+
+	return mig, err
+}
+
+func (m *Migrator) inTx(fn func(tx *sql.Tx) error) error {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`SELECT pg_advisory_xact_lock($1)`, lockID); err != nil {
+		return err
+	}
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,110 @@
+package migrate_test
+
+import (
+	"database/sql"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/Stremilov/car-shop/pkg/migrate"
+	"github.com/Stremilov/car-shop/pkg/testdb"
+)
+
+// The tests below need a test database, see package testdb.
+
+// newMigrator migrates a schema of the test database all the way up and
+// returns the migrations it applied.
+func newMigrator(t *testing.T) (*migrate.Migrator, *sql.DB, []migrate.Migration) {
+	t.Helper()
+
+	db := testdb.New(t)
+	m, err := migrate.New(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	applied, err := m.Up()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) == 0 {
+		t.Fatal("no migrations applied to an empty schema")
+	}
+
+	return m, db, applied
+}
+
+func appliedVersions(t *testing.T, m *migrate.Migrator) map[int]bool {
+	t.Helper()
+
+	statuses, err := m.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	applied := map[int]bool{}
+	for _, s := range statuses {
+		if s.Applied {
+			applied[s.Version] = true
+		}
+	}
+
+	return applied
+}
+
+func TestSchemaAhead(t *testing.T) {
+	m, db, all := newMigrator(t)
+
+	// A newer release applied a migration this binary does not know.
+	if _, err := db.Exec(`INSERT INTO schema_migrations (version, name) VALUES (999999, 'newer')`); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := m.Up(); !errors.Is(err, migrate.ErrSchemaAhead) {
+		t.Errorf("Up: got error %v, want ErrSchemaAhead", err)
+	}
+	if _, err := m.Down(); !errors.Is(err, migrate.ErrSchemaAhead) {
+		t.Errorf("Down: got error %v, want ErrSchemaAhead", err)
+	}
+	if applied := appliedVersions(t, m); len(applied) != len(all) {
+		t.Errorf("got %d known migrations applied after the refused Down, want %d", len(applied), len(all))
+	}
+}
+
+func TestConcurrentDown(t *testing.T) {
+	m, _, all := newMigrator(t)
+	if len(all) < 2 {
+		t.Skip("fewer than two migrations to roll back")
+	}
+
+	var wg sync.WaitGroup
+	rolledBack := make([]migrate.Migration, 2)
+	errs := make([]error, 2)
+	for i := range rolledBack {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			rolledBack[i], errs[i] = m.Down()
+		}(i)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			t.Fatalf("Down: %v", err)
+		}
+	}
+	if rolledBack[0].Version == rolledBack[1].Version {
+		t.Errorf("both rolled back migration %d", rolledBack[0].Version)
+	}
+
+	applied := appliedVersions(t, m)
+	for _, mig := range all[len(all)-2:] {
+		if applied[mig.Version] {
+			t.Errorf("migration %d is still applied", mig.Version)
+		}
+	}
+	if len(applied) != len(all)-2 {
+		t.Errorf("got %d migrations applied, want %d", len(applied), len(all)-2)
+	}
+}
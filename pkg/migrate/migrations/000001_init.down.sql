@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS orders;
+DROP TABLE IF EXISTS cars;
+DROP TABLE IF EXISTS people;
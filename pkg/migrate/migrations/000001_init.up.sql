@@ -0,0 +1,21 @@
+CREATE TABLE IF NOT EXISTS people (
+	id SERIAL PRIMARY KEY,
+	first_name VARCHAR(50),
+	last_name VARCHAR(50),
+	age INTEGER
+);
+
+CREATE TABLE IF NOT EXISTS cars (
+	id SERIAL PRIMARY KEY,
+	name VARCHAR(50),
+	power INTEGER,
+	type VARCHAR(10),
+	year INTEGER
+);
+
+CREATE TABLE IF NOT EXISTS orders (
+	id SERIAL PRIMARY KEY,
+	user_id INTEGER REFERENCES people(id),
+	car_id INTEGER REFERENCES cars(id),
+	order_date TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
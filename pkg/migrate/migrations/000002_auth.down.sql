@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS refresh_tokens;
+
+ALTER TABLE people
+	DROP COLUMN IF EXISTS password_hash,
+	DROP COLUMN IF EXISTS email;
@@ -0,0 +1,13 @@
+ALTER TABLE people
+	ADD COLUMN email VARCHAR(255) UNIQUE,
+	ADD COLUMN password_hash VARCHAR(255);
+
+CREATE TABLE refresh_tokens (
+	id VARCHAR(64) PRIMARY KEY,
+	user_id INTEGER NOT NULL REFERENCES people(id) ON DELETE CASCADE,
+	expires_at TIMESTAMP NOT NULL,
+	revoked_at TIMESTAMP,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX refresh_tokens_user_id_idx ON refresh_tokens (user_id);
@@ -0,0 +1,3 @@
+ALTER TABLE people
+	ADD COLUMN role VARCHAR(20) NOT NULL DEFAULT 'customer'
+	CHECK (role IN ('customer', 'sales', 'admin'));
@@ -0,0 +1,3 @@
+ALTER TABLE cars DROP CONSTRAINT IF EXISTS cars_power_watts_check;
+UPDATE cars SET power_watts = ROUND(power_watts / 745.69987158227022);
+ALTER TABLE cars RENAME COLUMN power_watts TO power;
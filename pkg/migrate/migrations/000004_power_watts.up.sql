@@ -0,0 +1,5 @@
+-- Power used to be whole horsepower. Keep it in watts instead, so that
+-- values entered in kW survive the round trip.
+ALTER TABLE cars RENAME COLUMN power TO power_watts;
+UPDATE cars SET power_watts = ROUND(power_watts * 745.69987158227022);
+ALTER TABLE cars ADD CONSTRAINT cars_power_watts_check CHECK (power_watts > 0);
@@ -0,0 +1,2 @@
+ALTER TABLE cars DROP COLUMN IF EXISTS created_at, DROP COLUMN IF EXISTS updated_at;
+ALTER TABLE people DROP COLUMN IF EXISTS created_at, DROP COLUMN IF EXISTS updated_at;
@@ -0,0 +1,7 @@
+ALTER TABLE people
+	ADD COLUMN created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	ADD COLUMN updated_at TIMESTAMPTZ NOT NULL DEFAULT now();
+
+ALTER TABLE cars
+	ADD COLUMN created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	ADD COLUMN updated_at TIMESTAMPTZ NOT NULL DEFAULT now();
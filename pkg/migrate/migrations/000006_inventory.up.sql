@@ -0,0 +1,14 @@
+CREATE TABLE vehicles (
+	id SERIAL PRIMARY KEY,
+	car_id INTEGER NOT NULL REFERENCES cars(id),
+	vin CHAR(17) NOT NULL UNIQUE,
+	status VARCHAR(20) NOT NULL DEFAULT 'in_stock'
+		CHECK (status IN ('in_stock', 'reserved', 'sold', 'in_transit')),
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX vehicles_car_id_status_idx ON vehicles (car_id, status);
+
+-- Orders placed before the inventory existed have no vehicle.
+ALTER TABLE orders ADD COLUMN vehicle_id INTEGER REFERENCES vehicles(id);
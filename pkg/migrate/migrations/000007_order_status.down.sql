@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS order_status_history;
+ALTER TABLE orders DROP COLUMN IF EXISTS status, DROP COLUMN IF EXISTS updated_at;
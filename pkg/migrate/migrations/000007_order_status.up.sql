@@ -0,0 +1,19 @@
+ALTER TABLE orders
+	ADD COLUMN status VARCHAR(30) NOT NULL DEFAULT 'draft'
+		CHECK (status IN ('draft', 'pending_payment', 'paid', 'ready_for_delivery',
+			'delivered', 'cancelled', 'refunded')),
+	ADD COLUMN updated_at TIMESTAMPTZ NOT NULL DEFAULT now();
+
+CREATE TABLE order_status_history (
+	id SERIAL PRIMARY KEY,
+	order_id INTEGER NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+	from_status VARCHAR(30) NOT NULL,
+	to_status VARCHAR(30) NOT NULL,
+	-- Kept when the user is deleted, so the trail still shows something
+	-- happened.
+	changed_by INTEGER REFERENCES people(id) ON DELETE SET NULL,
+	changed_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	note TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX order_status_history_order_id_idx ON order_status_history (order_id);
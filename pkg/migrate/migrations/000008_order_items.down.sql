@@ -0,0 +1,16 @@
+ALTER TABLE orders
+	ADD COLUMN car_id INTEGER REFERENCES cars(id),
+	ADD COLUMN vehicle_id INTEGER REFERENCES vehicles(id);
+
+-- Orders keep their first car; the other items are lost.
+UPDATE orders SET car_id = first.car_id, vehicle_id = first.vehicle_id
+FROM (
+	SELECT DISTINCT ON (order_id) order_id, car_id, vehicle_id
+	FROM order_items
+	WHERE kind = 'car'
+	ORDER BY order_id, id
+) AS first
+WHERE orders.id = first.order_id;
+
+DROP TABLE IF EXISTS order_items;
+DROP TABLE IF EXISTS extras;
@@ -0,0 +1,52 @@
+-- Prices are in cents.
+CREATE TABLE extras (
+	id SERIAL PRIMARY KEY,
+	name VARCHAR(50) NOT NULL UNIQUE,
+	price BIGINT NOT NULL CHECK (price >= 0),
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE order_items (
+	id SERIAL PRIMARY KEY,
+	order_id INTEGER NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+	kind VARCHAR(10) NOT NULL CHECK (kind IN ('car', 'extra')),
+	car_id INTEGER REFERENCES cars(id),
+	vehicle_id INTEGER REFERENCES vehicles(id),
+	extra_id INTEGER REFERENCES extras(id),
+	-- Name of the car or extra when the order was placed.
+	name VARCHAR(50) NOT NULL,
+	unit_price BIGINT NOT NULL DEFAULT 0 CHECK (unit_price >= 0),
+	quantity INTEGER NOT NULL DEFAULT 1 CHECK (quantity > 0),
+	CHECK ((kind = 'car') = (car_id IS NOT NULL)),
+	CHECK ((kind = 'extra') = (extra_id IS NOT NULL)),
+	-- A car line is one vehicle.
+	CHECK (kind = 'extra' OR quantity = 1)
+);
+
+CREATE INDEX order_items_order_id_idx ON order_items (order_id);
+
+-- Every existing order becomes an order with one car. An order without a
+-- car has nothing to become and would lose it with the column, so the
+-- migration stops on one and leaves it to be fixed by hand.
+DO $$
+DECLARE
+	ids TEXT;
+BEGIN
+	SELECT string_agg(id::TEXT, ', ' ORDER BY id) INTO ids FROM orders WHERE car_id IS NULL;
+	IF ids IS NOT NULL THEN
+		RAISE EXCEPTION 'orders without a car cannot get order items: %', ids
+			USING HINT = 'Set their car_id or delete them, then migrate again.';
+	END IF;
+END
+$$;
+
+INSERT INTO order_items (order_id, kind, car_id, vehicle_id, name)
+SELECT orders.id, 'car', orders.car_id, orders.vehicle_id, COALESCE(cars.name, '')
+FROM orders
+JOIN cars ON cars.id = orders.car_id
+ORDER BY orders.id;
+
+ALTER TABLE orders
+	DROP COLUMN car_id,
+	DROP COLUMN vehicle_id;
@@ -0,0 +1,9 @@
+ALTER TABLE order_items DROP COLUMN IF EXISTS list_price, DROP COLUMN IF EXISTS discount_id;
+ALTER TABLE orders
+	DROP COLUMN IF EXISTS currency,
+	DROP COLUMN IF EXISTS discount,
+	DROP COLUMN IF EXISTS discount_id,
+	DROP COLUMN IF EXISTS promo_code;
+ALTER TABLE extras DROP COLUMN IF EXISTS currency;
+DROP TABLE IF EXISTS discounts;
+DROP TABLE IF EXISTS car_prices;
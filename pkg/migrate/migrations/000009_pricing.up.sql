@@ -0,0 +1,46 @@
+-- Amounts are in cents of an ISO 4217 currency.
+CREATE TABLE car_prices (
+	id SERIAL PRIMARY KEY,
+	car_id INTEGER NOT NULL REFERENCES cars(id) ON DELETE CASCADE,
+	amount BIGINT NOT NULL CHECK (amount >= 0),
+	currency CHAR(3) NOT NULL,
+	effective_from TIMESTAMPTZ NOT NULL DEFAULT now(),
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	UNIQUE (car_id, effective_from)
+);
+
+CREATE TABLE discounts (
+	id SERIAL PRIMARY KEY,
+	-- Promo codes have a code; discounts without one apply automatically.
+	code VARCHAR(30) UNIQUE,
+	kind VARCHAR(10) NOT NULL CHECK (kind IN ('percent', 'fixed')),
+	value BIGINT NOT NULL CHECK (value > 0),
+	currency CHAR(3),
+	car_id INTEGER REFERENCES cars(id) ON DELETE CASCADE,
+	valid_from TIMESTAMPTZ,
+	valid_to TIMESTAMPTZ,
+	max_uses INTEGER CHECK (max_uses > 0),
+	uses INTEGER NOT NULL DEFAULT 0,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	CHECK (kind <> 'percent' OR value <= 100),
+	CHECK (kind <> 'fixed' OR currency IS NOT NULL),
+	CHECK (valid_to > valid_from)
+);
+
+-- Existing extras are taken to be priced in US dollars.
+ALTER TABLE extras ADD COLUMN currency CHAR(3) NOT NULL DEFAULT 'USD';
+ALTER TABLE extras ALTER COLUMN currency DROP DEFAULT;
+
+-- The prices an order was placed at, so that later price changes do not
+-- rewrite it. Orders placed before cars had prices have no currency.
+ALTER TABLE orders
+	ADD COLUMN currency CHAR(3),
+	ADD COLUMN discount BIGINT NOT NULL DEFAULT 0 CHECK (discount >= 0),
+	ADD COLUMN discount_id INTEGER REFERENCES discounts(id),
+	ADD COLUMN promo_code VARCHAR(30);
+
+ALTER TABLE order_items
+	ADD COLUMN list_price BIGINT NOT NULL DEFAULT 0 CHECK (list_price >= 0),
+	ADD COLUMN discount_id INTEGER REFERENCES discounts(id);
+
+UPDATE order_items SET list_price = unit_price;
@@ -0,0 +1,21 @@
+CREATE TABLE payments (
+	id SERIAL PRIMARY KEY,
+	-- Orders with payments cannot be deleted, the payments are kept as a
+	-- record of the money that moved.
+	order_id INTEGER NOT NULL REFERENCES orders(id),
+	provider VARCHAR(30) NOT NULL,
+	provider_ref VARCHAR(100),
+	amount BIGINT NOT NULL CHECK (amount > 0),
+	currency CHAR(3) NOT NULL,
+	status VARCHAR(20) NOT NULL DEFAULT 'pending'
+		CHECK (status IN ('pending', 'authorized', 'captured', 'failed', 'refunded')),
+	idempotency_key VARCHAR(100) NOT NULL,
+	failure_reason TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	UNIQUE (order_id, idempotency_key),
+	UNIQUE (provider, provider_ref)
+);
+
+-- An order is paid at most once; failed attempts may be retried.
+CREATE UNIQUE INDEX payments_order_id_active_idx ON payments (order_id) WHERE status <> 'failed';
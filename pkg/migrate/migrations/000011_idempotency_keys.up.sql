@@ -0,0 +1,12 @@
+CREATE TABLE idempotent_requests (
+	user_id INTEGER NOT NULL REFERENCES people(id) ON DELETE CASCADE,
+	key VARCHAR(255) NOT NULL,
+	fingerprint CHAR(64) NOT NULL,
+	-- 0 while the first request with the key is still being handled.
+	status SMALLINT NOT NULL DEFAULT 0,
+	content_type VARCHAR(100) NOT NULL DEFAULT '',
+	location VARCHAR(255) NOT NULL DEFAULT '',
+	body BYTEA NOT NULL DEFAULT '',
+	expires_at TIMESTAMPTZ NOT NULL,
+	PRIMARY KEY (user_id, key)
+);
@@ -0,0 +1,3 @@
+-- Soft deleted users and cars come back.
+ALTER TABLE people DROP COLUMN deleted_at;
+ALTER TABLE cars DROP COLUMN deleted_at;
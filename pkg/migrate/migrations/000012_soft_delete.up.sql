@@ -0,0 +1,4 @@
+-- Soft deleted users and cars are hidden but kept for the orders that
+-- refer to them.
+ALTER TABLE people ADD COLUMN deleted_at TIMESTAMPTZ;
+ALTER TABLE cars ADD COLUMN deleted_at TIMESTAMPTZ;
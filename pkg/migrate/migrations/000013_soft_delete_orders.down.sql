@@ -0,0 +1,6 @@
+-- Soft deleted orders come back.
+DROP INDEX cars_deleted_at_idx;
+DROP INDEX people_deleted_at_idx;
+DROP INDEX orders_deleted_at_idx;
+
+ALTER TABLE orders DROP COLUMN deleted_at;
@@ -0,0 +1,8 @@
+-- Deleted orders are kept for the books until they are purged. The
+-- partial indexes let the purge find what is due without scanning the
+-- live rows.
+ALTER TABLE orders ADD COLUMN deleted_at TIMESTAMPTZ;
+
+CREATE INDEX orders_deleted_at_idx ON orders (deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX people_deleted_at_idx ON people (deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX cars_deleted_at_idx ON cars (deleted_at) WHERE deleted_at IS NOT NULL;
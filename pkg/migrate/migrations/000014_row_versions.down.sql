@@ -0,0 +1,3 @@
+-- Users and cars are written without checking for concurrent changes.
+ALTER TABLE people DROP COLUMN version;
+ALTER TABLE cars DROP COLUMN version;
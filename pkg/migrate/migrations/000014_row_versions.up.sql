@@ -0,0 +1,4 @@
+-- Every change to a user or car bumps its version, which clients send back
+-- in If-Match to make sure they do not overwrite changes they have not seen.
+ALTER TABLE people ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE cars ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
@@ -0,0 +1,428 @@
+// Package patch applies JSON Merge Patch (RFC 7396) and JSON Patch
+// (RFC 6902) documents to JSON documents.
+package patch
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Media types of the patch formats.
+const (
+	MergePatchType = "application/merge-patch+json"
+	JSONPatchType  = "application/json-patch+json"
+)
+
+// Patch changes a JSON document.
+type Patch interface {
+	// Apply returns doc with the patch applied. It fails if the patch
+	// does not fit doc, for example because a path does not exist or a
+	// test operation fails.
+	Apply(doc []byte) ([]byte, error)
+}
+
+// Parse reads a patch of media type contentType, MergePatchType or
+// JSONPatchType.
+func Parse(contentType string, body []byte) (Patch, error) {
+	switch contentType {
+	case MergePatchType:
+		value, err := decode(body)
+		if err != nil {
+			return nil, errors.New("merge patch must be a JSON document")
+		}
+		return mergePatch{value}, nil
+	case JSONPatchType:
+		return parseJSONPatch(body)
+	}
+
+	return nil, fmt.Errorf("unsupported patch type %q", contentType)
+}
+
+// decode reads a JSON value, keeping numbers as they are written.
+func decode(data []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var value interface{}
+	if err := dec.Decode(&value); err != nil {
+		return nil, err
+	}
+	if dec.More() {
+		return nil, errors.New("trailing data after JSON value")
+	}
+
+	return value, nil
+}
+
+// mergePatch replaces the members of the target it names; null removes
+// them. Objects are merged member by member, anything else is replaced as
+// a whole.
+type mergePatch struct {
+	value interface{}
+}
+
+func (p mergePatch) Apply(doc []byte) ([]byte, error) {
+	target, err := decode(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(merge(target, p.value))
+}
+
+func merge(target, patch interface{}) interface{} {
+	members, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	result, ok := target.(map[string]interface{})
+	if !ok {
+		result = make(map[string]interface{})
+	}
+
+	for name, value := range members {
+		if value == nil {
+			delete(result, name)
+			continue
+		}
+		result[name] = merge(result[name], value)
+	}
+
+	return result
+}
+
+// operation is one step of a JSON Patch.
+type operation struct {
+	op    string
+	path  []string
+	from  []string
+	value interface{}
+}
+
+// jsonPatch applies its operations in order, all or nothing.
+type jsonPatch []operation
+
+// members lists the members every operation needs besides op and path.
+var members = map[string][]string{
+	"add":     {"value"},
+	"remove":  nil,
+	"replace": {"value"},
+	"move":    {"from"},
+	"copy":    {"from"},
+	"test":    {"value"},
+}
+
+func parseJSONPatch(body []byte) (Patch, error) {
+	var raw []map[string]json.RawMessage
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return nil, errors.New("JSON patch must be an array of operation objects")
+	}
+
+	p := make(jsonPatch, 0, len(raw))
+	for i, fields := range raw {
+		var op operation
+		if err := json.Unmarshal(fields["op"], &op.op); err != nil {
+			return nil, fmt.Errorf("operation %d: op must be a string", i)
+		}
+
+		needed, ok := members[op.op]
+		if !ok {
+			return nil, fmt.Errorf("operation %d: unknown op %q", i, op.op)
+		}
+
+		var err error
+		if op.path, err = parsePointer(fields["path"]); err != nil {
+			return nil, fmt.Errorf("operation %d: path %w", i, err)
+		}
+
+		for _, name := range needed {
+			if _, ok := fields[name]; !ok {
+				return nil, fmt.Errorf("operation %d: %s needs a %s", i, op.op, name)
+			}
+		}
+
+		if fields["from"] != nil {
+			if op.from, err = parsePointer(fields["from"]); err != nil {
+				return nil, fmt.Errorf("operation %d: from %w", i, err)
+			}
+		}
+
+		if fields["value"] != nil {
+			if op.value, err = decode(fields["value"]); err != nil {
+				return nil, fmt.Errorf("operation %d: value must be a JSON value", i)
+			}
+		}
+
+		p = append(p, op)
+	}
+
+	return p, nil
+}
+
+// parsePointer splits a JSON Pointer (RFC 6901) into its reference tokens.
+func parsePointer(raw json.RawMessage) ([]string, error) {
+	var pointer string
+	if err := json.Unmarshal(raw, &pointer); err != nil {
+		return nil, errors.New("must be a string")
+	}
+
+	if pointer == "" {
+		return []string{}, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("%q must be empty or start with /", pointer)
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+	}
+
+	return tokens, nil
+}
+
+func formatPointer(tokens []string) string {
+	var b strings.Builder
+	for _, token := range tokens {
+		b.WriteString("/" + strings.NewReplacer("~", "~0", "/", "~1").Replace(token))
+	}
+
+	return b.String()
+}
+
+func (p jsonPatch) Apply(doc []byte) ([]byte, error) {
+	target, err := decode(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, op := range p {
+		if target, err = op.apply(target); err != nil {
+			return nil, fmt.Errorf("operation %d (%s %s): %w", i, op.op, formatPointer(op.path), err)
+		}
+	}
+
+	return json.Marshal(target)
+}
+
+func (op operation) apply(doc interface{}) (interface{}, error) {
+	switch op.op {
+	case "add":
+		return add(doc, op.path, op.value)
+	case "remove":
+		doc, _, err := remove(doc, op.path)
+		return doc, err
+	case "replace":
+		doc, _, err := remove(doc, op.path)
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, op.path, op.value)
+	case "move":
+		if len(op.from) < len(op.path) && formatPointer(op.path[:len(op.from)]) == formatPointer(op.from) {
+			return nil, errors.New("cannot move a value into itself")
+		}
+		doc, value, err := remove(doc, op.from)
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, op.path, value)
+	case "copy":
+		value, err := get(doc, op.from)
+		if err != nil {
+			return nil, err
+		}
+		if value, err = deepCopy(value); err != nil {
+			return nil, err
+		}
+		return add(doc, op.path, value)
+	case "test":
+		value, err := get(doc, op.path)
+		if err != nil {
+			return nil, err
+		}
+		if !equal(value, op.value) {
+			return nil, errors.New("test failed")
+		}
+		return doc, nil
+	}
+
+	return nil, fmt.Errorf("unknown op %q", op.op)
+}
+
+func get(doc interface{}, path []string) (interface{}, error) {
+	for i, token := range path {
+		switch container := doc.(type) {
+		case map[string]interface{}:
+			value, ok := container[token]
+			if !ok {
+				return nil, fmt.Errorf("%s does not exist", formatPointer(path[:i+1]))
+			}
+			doc = value
+		case []interface{}:
+			index, err := arrayIndex(token, len(container)-1)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", formatPointer(path[:i+1]), err)
+			}
+			doc = container[index]
+		default:
+			return nil, fmt.Errorf("%s is not an object or array", formatPointer(path[:i]))
+		}
+	}
+
+	return doc, nil
+}
+
+// arrayIndex parses an array index token, which must be at most max.
+func arrayIndex(token string, max int) (int, error) {
+	if token == "" || (len(token) > 1 && token[0] == '0') || strings.TrimLeft(token, "0123456789") != "" {
+		return 0, fmt.Errorf("%q is not an array index", token)
+	}
+
+	index, err := strconv.Atoi(token)
+	if err != nil || index > max {
+		return 0, fmt.Errorf("index %s is out of range", token)
+	}
+
+	return index, nil
+}
+
+// add sets the member or inserts the element at path and returns the new
+// document.
+func add(doc interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	parent, last := path[:len(path)-1], path[len(path)-1]
+	container, err := get(doc, parent)
+	if err != nil {
+		return nil, err
+	}
+
+	switch container := container.(type) {
+	case map[string]interface{}:
+		container[last] = value
+		return doc, nil
+	case []interface{}:
+		index := len(container)
+		if last != "-" {
+			if index, err = arrayIndex(last, len(container)); err != nil {
+				return nil, err
+			}
+		}
+		grown := append(container[:index:index], value)
+		return set(doc, parent, append(grown, container[index:]...))
+	}
+
+	return nil, fmt.Errorf("%s is not an object or array", formatPointer(parent))
+}
+
+// remove takes the value at path out and returns the new document and the
+// value.
+func remove(doc interface{}, path []string) (interface{}, interface{}, error) {
+	value, err := get(doc, path)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(path) == 0 {
+		return nil, value, nil
+	}
+
+	parent, last := path[:len(path)-1], path[len(path)-1]
+	container, _ := get(doc, parent)
+
+	switch container := container.(type) {
+	case map[string]interface{}:
+		delete(container, last)
+		return doc, value, nil
+	case []interface{}:
+		index, _ := arrayIndex(last, len(container)-1)
+		shrunk := append(container[:index:index], container[index+1:]...)
+		doc, err := set(doc, parent, shrunk)
+		return doc, value, err
+	}
+
+	return nil, nil, fmt.Errorf("%s is not an object or array", formatPointer(parent))
+}
+
+// set puts value at path, which exists, and returns the new document.
+// Arrays need it since growing or shrinking them makes new slices.
+func set(doc interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	parent, last := path[:len(path)-1], path[len(path)-1]
+	container, err := get(doc, parent)
+	if err != nil {
+		return nil, err
+	}
+
+	switch container := container.(type) {
+	case map[string]interface{}:
+		container[last] = value
+	case []interface{}:
+		index, err := arrayIndex(last, len(container)-1)
+		if err != nil {
+			return nil, err
+		}
+		container[index] = value
+	}
+
+	return doc, nil
+}
+
+func deepCopy(value interface{}) (interface{}, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	return decode(data)
+}
+
+// equal compares JSON values the way the test operation does: numbers by
+// value and objects regardless of member order.
+func equal(a, b interface{}) bool {
+	switch a := a.(type) {
+	case json.Number:
+		b, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		x, errA := a.Float64()
+		y, errB := b.Float64()
+		return errA == nil && errB == nil && x == y
+	case map[string]interface{}:
+		b, ok := b.(map[string]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for name, value := range a {
+			other, ok := b[name]
+			if !ok || !equal(value, other) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		b, ok := b.([]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !equal(a[i], b[i]) {
+				return false
+			}
+		}
+		return true
+	}
+
+	return a == b
+}
@@ -0,0 +1,151 @@
+package patch_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/Stremilov/car-shop/pkg/patch"
+)
+
+func TestMergePatch(t *testing.T) {
+	// The examples of RFC 7396, appendix A.
+	tests := []struct {
+		doc, patch, want string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"a":"foo"}`, `null`, `null`},
+		{`{"a":"foo"}`, `"bar"`, `"bar"`},
+		{`{"e":null}`, `{"a":1}`, `{"a":1,"e":null}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	}
+
+	for _, tt := range tests {
+		p, err := patch.Parse(patch.MergePatchType, []byte(tt.patch))
+		if err != nil {
+			t.Fatalf("Parse(%s): %v", tt.patch, err)
+		}
+
+		assertApplies(t, p, tt.doc, tt.want)
+	}
+}
+
+func TestJSONPatch(t *testing.T) {
+	// Mostly the examples of RFC 6902, appendix A.
+	tests := []struct {
+		name, doc, patch, want string
+	}{
+		{"add member", `{"foo":"bar"}`, `[{"op":"add","path":"/baz","value":"qux"}]`, `{"baz":"qux","foo":"bar"}`},
+		{"add element", `{"foo":["bar","baz"]}`, `[{"op":"add","path":"/foo/1","value":"qux"}]`, `{"foo":["bar","qux","baz"]}`},
+		{"append element", `{"foo":["bar"]}`, `[{"op":"add","path":"/foo/-","value":["abc"]}]`, `{"foo":["bar",["abc"]]}`},
+		{"remove member", `{"baz":"qux","foo":"bar"}`, `[{"op":"remove","path":"/baz"}]`, `{"foo":"bar"}`},
+		{"remove element", `{"foo":["bar","qux","baz"]}`, `[{"op":"remove","path":"/foo/1"}]`, `{"foo":["bar","baz"]}`},
+		{"replace", `{"baz":"qux","foo":"bar"}`, `[{"op":"replace","path":"/baz","value":"boo"}]`, `{"baz":"boo","foo":"bar"}`},
+		{"move member", `{"foo":{"bar":"baz","waldo":"fred"},"qux":{"corge":"grault"}}`,
+			`[{"op":"move","from":"/foo/waldo","path":"/qux/thud"}]`,
+			`{"foo":{"bar":"baz"},"qux":{"corge":"grault","thud":"fred"}}`},
+		{"move element", `{"foo":["all","grass","cows","eat"]}`, `[{"op":"move","from":"/foo/1","path":"/foo/3"}]`,
+			`{"foo":["all","cows","eat","grass"]}`},
+		{"copy", `{"foo":{"a":1}}`, `[{"op":"copy","from":"/foo","path":"/bar"},{"op":"add","path":"/bar/b","value":2}]`,
+			`{"bar":{"a":1,"b":2},"foo":{"a":1}}`},
+		{"test", `{"baz":"qux","foo":["a",2,"c"]}`,
+			`[{"op":"test","path":"/baz","value":"qux"},{"op":"test","path":"/foo/1","value":2.0}]`,
+			`{"baz":"qux","foo":["a",2,"c"]}`},
+		{"add nested", `{"foo":"bar"}`, `[{"op":"add","path":"/child","value":{"grandchild":{}}}]`,
+			`{"child":{"grandchild":{}},"foo":"bar"}`},
+		{"escaped path", `{"/":9,"~1":10}`, `[{"op":"test","path":"/~01","value":10},{"op":"replace","path":"/~1","value":0}]`,
+			`{"/":0,"~1":10}`},
+		{"null value", `{"foo":"bar"}`, `[{"op":"add","path":"/foo","value":null}]`, `{"foo":null}`},
+		{"whole document", `{"foo":"bar"}`, `[{"op":"replace","path":"","value":[1]}]`, `[1]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := patch.Parse(patch.JSONPatchType, []byte(tt.patch))
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+
+			assertApplies(t, p, tt.doc, tt.want)
+		})
+	}
+}
+
+func TestJSONPatchFails(t *testing.T) {
+	tests := []struct {
+		name, doc, patch string
+	}{
+		{"failed test", `{"baz":"qux"}`, `[{"op":"test","path":"/baz","value":"bar"}]`},
+		{"missing parent", `{"foo":"bar"}`, `[{"op":"add","path":"/baz/bat","value":"qux"}]`},
+		{"remove missing", `{"foo":"bar"}`, `[{"op":"remove","path":"/baz"}]`},
+		{"index out of range", `{"foo":[1]}`, `[{"op":"add","path":"/foo/2","value":2}]`},
+		{"leading zero", `{"foo":[1,2]}`, `[{"op":"replace","path":"/foo/01","value":3}]`},
+		{"move into itself", `{"foo":{"a":1}}`, `[{"op":"move","from":"/foo","path":"/foo/b"}]`},
+		{"all or nothing", `{"foo":"bar"}`, `[{"op":"remove","path":"/foo"},{"op":"test","path":"/foo","value":"bar"}]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := patch.Parse(patch.JSONPatchType, []byte(tt.patch))
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+
+			if got, err := p.Apply([]byte(tt.doc)); err == nil {
+				t.Errorf("Apply: got %s, want an error", got)
+			}
+		})
+	}
+}
+
+func TestParseFails(t *testing.T) {
+	tests := []struct {
+		name, contentType, body string
+	}{
+		{"merge patch not JSON", patch.MergePatchType, `{"a":`},
+		{"not an array", patch.JSONPatchType, `{"op":"add"}`},
+		{"unknown op", patch.JSONPatchType, `[{"op":"merge","path":"/a"}]`},
+		{"missing value", patch.JSONPatchType, `[{"op":"add","path":"/a"}]`},
+		{"missing from", patch.JSONPatchType, `[{"op":"copy","path":"/a"}]`},
+		{"relative path", patch.JSONPatchType, `[{"op":"remove","path":"a"}]`},
+		{"unsupported type", "application/xml", `<patch/>`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := patch.Parse(tt.contentType, []byte(tt.body)); err == nil {
+				t.Error("Parse: got no error")
+			}
+		})
+	}
+}
+
+func assertApplies(t *testing.T, p patch.Patch, doc, want string) {
+	t.Helper()
+
+	got, err := p.Apply([]byte(doc))
+	if err != nil {
+		t.Fatalf("Apply(%s): %v", doc, err)
+	}
+
+	var gotValue, wantValue interface{}
+	if err := json.Unmarshal(got, &gotValue); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(want), &wantValue); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(gotValue, wantValue) {
+		t.Errorf("Apply(%s): got %s, want %s", doc, got, want)
+	}
+}
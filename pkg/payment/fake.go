@@ -0,0 +1,119 @@
+package payment
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+
+	goapi "github.com/Stremilov/car-shop"
+)
+
+// Tokens the fake provider treats specially. Every other token is a card
+// that is always approved.
+const (
+	// TokenDeclined is a card that is always declined.
+	TokenDeclined = "tok_declined"
+	// TokenPending is a card whose authorization goes through, but is
+	// reported as pending at first, as if the bank took its time. A
+	// payment.authorized webhook event is expected to follow.
+	TokenPending = "tok_pending"
+)
+
+// Fake is a payment provider that keeps its payments in memory. It remembers
+// the result of every idempotency key, like a real provider would, so that
+// retries do not move money twice.
+type Fake struct {
+	mu       sync.Mutex
+	results  map[string]Result
+	payments map[string]fakePayment
+	lastRef  int
+}
+
+type fakePayment struct {
+	amount goapi.Money
+	status goapi.PaymentStatus
+}
+
+func NewFake() *Fake {
+	return &Fake{
+		results:  make(map[string]Result),
+		payments: make(map[string]fakePayment),
+	}
+}
+
+func (f *Fake) Name() string {
+	return "fake"
+}
+
+func (f *Fake) Authorize(key, token string, amount goapi.Money) (Result, error) {
+	return f.once(key, func() (Result, error) {
+		f.lastRef++
+		ref := "fake_" + strconv.Itoa(f.lastRef)
+
+		result := Result{Ref: ref, Status: goapi.PaymentAuthorized}
+		if token == TokenDeclined {
+			result.Status, result.FailureReason = goapi.PaymentFailed, "card declined"
+		}
+
+		f.payments[ref] = fakePayment{amount: amount, status: result.Status}
+
+		if token == TokenPending {
+			result.Status = goapi.PaymentPending
+		}
+
+		return result, nil
+	})
+}
+
+func (f *Fake) Capture(key, ref string, amount goapi.Money) (Result, error) {
+	return f.once(key, func() (Result, error) {
+		return f.move(ref, amount, goapi.PaymentAuthorized, goapi.PaymentCaptured)
+	})
+}
+
+func (f *Fake) Refund(key, ref string, amount goapi.Money) (Result, error) {
+	return f.once(key, func() (Result, error) {
+		return f.move(ref, amount, goapi.PaymentCaptured, goapi.PaymentRefunded)
+	})
+}
+
+// once runs op for a new idempotency key and replays its result for a key
+// seen before. Errors are not remembered, so the operation can be retried.
+func (f *Fake) once(key string, op func() (Result, error)) (Result, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if result, ok := f.results[key]; ok {
+		return result, nil
+	}
+
+	result, err := op()
+	if err != nil {
+		return Result{}, err
+	}
+	f.results[key] = result
+
+	return result, nil
+}
+
+// move takes the payment ref from status from to status to if amount is
+// what it was authorized for. The caller holds the lock.
+func (f *Fake) move(ref string, amount goapi.Money, from, to goapi.PaymentStatus) (Result, error) {
+	p, ok := f.payments[ref]
+	if !ok {
+		return Result{}, fmt.Errorf("fake provider: unknown payment %q", ref)
+	}
+
+	if p.status != from {
+		return Result{Ref: ref, Status: p.status, FailureReason: fmt.Sprintf("payment is %s, not %s", p.status, from)}, nil
+	}
+
+	if amount != p.amount {
+		return Result{Ref: ref, Status: p.status, FailureReason: "amount does not match the authorization"}, nil
+	}
+
+	p.status = to
+	f.payments[ref] = p
+
+	return Result{Ref: ref, Status: to}, nil
+}
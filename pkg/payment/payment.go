@@ -0,0 +1,65 @@
+// Package payment holds what the service needs to know about payment
+// providers: the results of their operations, the webhook events they send
+// and how those are signed, and a fake provider for development and tests.
+package payment
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+
+	goapi "github.com/Stremilov/car-shop"
+)
+
+// Result is what a provider answers to a payment operation.
+type Result struct {
+	// Ref is the ID of the payment at the provider.
+	Ref           string
+	Status        goapi.PaymentStatus
+	FailureReason string
+}
+
+// Event is a webhook notification from a provider that a payment changed
+// status, for example when an authorization that was pending went through.
+type Event struct {
+	ID            string `json:"id" example:"evt_1"`
+	Type          string `json:"type" enums:"payment.authorized,payment.captured,payment.failed,payment.refunded"`
+	PaymentRef    string `json:"payment_ref" example:"fake_1"`
+	FailureReason string `json:"failure_reason,omitempty"`
+}
+
+var eventStatuses = map[string]goapi.PaymentStatus{
+	"payment.authorized": goapi.PaymentAuthorized,
+	"payment.captured":   goapi.PaymentCaptured,
+	"payment.failed":     goapi.PaymentFailed,
+	"payment.refunded":   goapi.PaymentRefunded,
+}
+
+// Status returns the payment status the event reports. It returns false
+// for events of other types.
+func (e Event) Status() (goapi.PaymentStatus, bool) {
+	status, ok := eventStatuses[e.Type]
+	return status, ok
+}
+
+// SignatureHeader carries the signature of a webhook body.
+const SignatureHeader = "X-Payment-Signature"
+
+// Sign returns the signature of a webhook body: its HMAC-SHA256 keyed with
+// secret, in hex.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether signature is the signature of body. Nothing is
+// valid without a secret.
+func Verify(secret string, body []byte, signature string) bool {
+	if secret == "" {
+		return false
+	}
+
+	return hmac.Equal([]byte(Sign(secret, body)), []byte(signature))
+}
@@ -0,0 +1,110 @@
+package repository
+
+import (
+	"time"
+
+	goapi "github.com/Stremilov/car-shop"
+)
+
+type AuthMemory struct {
+	store *memoryStore
+}
+
+func (r *AuthMemory) CreateAccount(user goapi.User, email, passwordHash string) (int, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	for _, account := range r.store.accounts {
+		if account.Email == email {
+			return 0, ErrDuplicate
+		}
+	}
+
+	r.store.lastUserID++
+	user.UserID = r.store.lastUserID
+	user.CreatedAt = time.Now()
+	user.UpdatedAt = user.CreatedAt
+	user.Version = 1
+	r.store.users[user.UserID] = user
+	r.store.accounts[user.UserID] = goapi.Account{
+		UserID:       user.UserID,
+		Email:        email,
+		PasswordHash: passwordHash,
+	}
+
+	return user.UserID, nil
+}
+
+func (r *AuthMemory) GetAccount(email string) (goapi.Account, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	for _, account := range r.store.accounts {
+		if account.Email == email && r.store.users[account.UserID].DeletedAt == nil {
+			account.Role = r.store.users[account.UserID].Role
+			return account, nil
+		}
+	}
+
+	return goapi.Account{}, ErrNotFound
+}
+
+func (r *AuthMemory) CreateRefreshToken(token goapi.RefreshToken) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if _, ok := r.store.users[token.UserID]; !ok {
+		return ErrForeignKeyViolation
+	}
+
+	if _, ok := r.store.refreshTokens[token.ID]; ok {
+		return ErrDuplicate
+	}
+
+	r.store.refreshTokens[token.ID] = token
+
+	return nil
+}
+
+func (r *AuthMemory) GetRefreshToken(tokenID string) (goapi.RefreshToken, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	token, ok := r.store.refreshTokens[tokenID]
+	if !ok {
+		return goapi.RefreshToken{}, ErrNotFound
+	}
+
+	return token, nil
+}
+
+func (r *AuthMemory) RevokeRefreshToken(tokenID string) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	token, ok := r.store.refreshTokens[tokenID]
+	if !ok || token.RevokedAt != nil {
+		return ErrNotFound
+	}
+
+	now := time.Now().UTC()
+	token.RevokedAt = &now
+	r.store.refreshTokens[tokenID] = token
+
+	return nil
+}
+
+func (r *AuthMemory) RevokeUserRefreshTokens(userID int) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	now := time.Now().UTC()
+	for id, token := range r.store.refreshTokens {
+		if token.UserID == userID && token.RevokedAt == nil {
+			token.RevokedAt = &now
+			r.store.refreshTokens[id] = token
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,77 @@
+package repository
+
+import (
+	"database/sql"
+
+	goapi "github.com/Stremilov/car-shop"
+)
+
+type AuthPostgres struct {
+	db *sql.DB
+}
+
+func NewAuthPostgres(db *sql.DB) *AuthPostgres {
+	return &AuthPostgres{db: db}
+}
+
+func (r *AuthPostgres) CreateAccount(user goapi.User, email, passwordHash string) (int, error) {
+	query := `
+	INSERT INTO people (first_name, last_name, age, role, email, password_hash)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	RETURNING id`
+
+	var id int
+	err := r.db.QueryRow(query, user.FirstName, user.LastName, user.Age, user.Role, email, passwordHash).Scan(&id)
+
+	return id, translateError(err)
+}
+
+func (r *AuthPostgres) GetAccount(email string) (goapi.Account, error) {
+	query := `SELECT id, role, email, password_hash FROM people
+	WHERE email = $1 AND password_hash IS NOT NULL AND deleted_at IS NULL`
+
+	var account goapi.Account
+	err := r.db.QueryRow(query, email).Scan(&account.UserID, &account.Role, &account.Email, &account.PasswordHash)
+	if err == sql.ErrNoRows {
+		return account, ErrNotFound
+	}
+
+	return account, err
+}
+
+func (r *AuthPostgres) CreateRefreshToken(token goapi.RefreshToken) error {
+	query := `INSERT INTO refresh_tokens (id, user_id, expires_at) VALUES ($1, $2, $3)`
+	_, err := r.db.Exec(query, token.ID, token.UserID, token.ExpiresAt)
+
+	return translateError(err)
+}
+
+func (r *AuthPostgres) GetRefreshToken(tokenID string) (goapi.RefreshToken, error) {
+	query := `SELECT id, user_id, expires_at, revoked_at FROM refresh_tokens WHERE id = $1`
+
+	var token goapi.RefreshToken
+	err := r.db.QueryRow(query, tokenID).Scan(&token.ID, &token.UserID, &token.ExpiresAt, &token.RevokedAt)
+	if err == sql.ErrNoRows {
+		return token, ErrNotFound
+	}
+
+	return token, err
+}
+
+func (r *AuthPostgres) RevokeRefreshToken(tokenID string) error {
+	query := `UPDATE refresh_tokens SET revoked_at = CURRENT_TIMESTAMP WHERE id = $1 AND revoked_at IS NULL`
+
+	result, err := r.db.Exec(query, tokenID)
+	if err != nil {
+		return err
+	}
+
+	return checkRowsAffected(result)
+}
+
+func (r *AuthPostgres) RevokeUserRefreshTokens(userID int) error {
+	query := `UPDATE refresh_tokens SET revoked_at = CURRENT_TIMESTAMP WHERE user_id = $1 AND revoked_at IS NULL`
+	_, err := r.db.Exec(query, userID)
+
+	return err
+}
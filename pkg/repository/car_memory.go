@@ -0,0 +1,273 @@
+package repository
+
+import (
+	"cmp"
+	"slices"
+	"time"
+
+	goapi "github.com/Stremilov/car-shop"
+)
+
+type CarMemory struct {
+	store *memoryStore
+}
+
+func (r *CarMemory) Create(car goapi.Car) (goapi.Car, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	r.store.lastCarID++
+	car.CarID = r.store.lastCarID
+	car.Power = storedPower(car.Power)
+	car.CreatedAt = time.Now()
+	car.UpdatedAt = car.CreatedAt
+	car.Version = 1
+	r.store.cars[car.CarID] = car
+
+	return car, nil
+}
+
+var carSortFields = map[string]func(a, b goapi.Car) int{
+	"name":  func(a, b goapi.Car) int { return cmp.Compare(a.Name, b.Name) },
+	"power": func(a, b goapi.Car) int { return cmp.Compare(carPower(a), carPower(b)) },
+	"type":  func(a, b goapi.Car) int { return cmp.Compare(a.Type, b.Type) },
+	"year":  func(a, b goapi.Car) int { return cmp.Compare(a.Year, b.Year) },
+}
+
+// carPower reads power in the whole watts Postgres stores it in.
+func carPower(car goapi.Car) int64 {
+	return car.Power.Watts()
+}
+
+// storedPower rounds p to whole watts like the power_watts column does.
+func storedPower(p goapi.Power) goapi.Power {
+	return goapi.PowerFromWatts(p.Watts())
+}
+
+func (r *CarMemory) GetAll(filter goapi.CarFilter, params goapi.ListParams) ([]goapi.Car, int, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	var cars []goapi.Car
+	for _, id := range sortedKeys(r.store.cars) {
+		car := r.store.cars[id]
+		if !visible(car.DeletedAt, filter.Deleted) {
+			continue
+		}
+		if filter.Type != "" && car.Type != filter.Type {
+			continue
+		}
+		if filter.YearFrom != nil && car.Year < *filter.YearFrom {
+			continue
+		}
+		if filter.YearTo != nil && car.Year > *filter.YearTo {
+			continue
+		}
+		if filter.PowerMin != nil && carPower(car) < filter.PowerMin.Watts() {
+			continue
+		}
+		cars = append(cars, r.store.withPrice(car))
+	}
+
+	total := len(cars)
+
+	return page(cars, params, func(c goapi.Car) int { return c.CarID }, carSortFields), total, nil
+}
+
+func (r *CarMemory) GetByID(carID int) (goapi.Car, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	car, ok := r.store.cars[carID]
+	if !ok || car.DeletedAt != nil {
+		return goapi.Car{}, ErrNotFound
+	}
+
+	return r.store.withPrice(car), nil
+}
+
+func (r *CarMemory) GetDeleted(carID int) (goapi.Car, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	car, ok := r.store.cars[carID]
+	if !ok || car.DeletedAt == nil {
+		return goapi.Car{}, ErrNotFound
+	}
+
+	return r.store.withPrice(car), nil
+}
+
+func (r *CarMemory) Update(carID int, input goapi.CarUpdate, version int) (goapi.Car, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	car, ok := r.store.cars[carID]
+	if !ok || car.DeletedAt != nil {
+		return goapi.Car{}, ErrNotFound
+	}
+	if err := checkVersion(car.Version, version); err != nil {
+		return goapi.Car{}, err
+	}
+
+	if input.Name != nil {
+		car.Name = *input.Name
+	}
+
+	if input.Power != nil {
+		car.Power = storedPower(*input.Power)
+	}
+
+	if input.Type != nil {
+		car.Type = *input.Type
+	}
+
+	if input.Year != nil {
+		car.Year = *input.Year
+	}
+
+	car.UpdatedAt = time.Now()
+	car.Version++
+	r.store.cars[carID] = car
+
+	return r.store.withPrice(car), nil
+}
+
+func (r *CarMemory) Delete(carID int, version int) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	car, ok := r.store.cars[carID]
+	if !ok || car.DeletedAt != nil {
+		return ErrNotFound
+	}
+	if err := checkVersion(car.Version, version); err != nil {
+		return err
+	}
+
+	for _, o := range r.store.orders {
+		for _, item := range o.items {
+			if item.carID == carID {
+				return ErrForeignKeyViolation
+			}
+		}
+	}
+
+	for _, v := range r.store.vehicles {
+		if v.CarID == carID {
+			return ErrForeignKeyViolation
+		}
+	}
+
+	r.store.deleteCar(carID)
+
+	return nil
+}
+
+func (r *CarMemory) SoftDelete(carID int, version int) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	car, ok := r.store.cars[carID]
+	if !ok || car.DeletedAt != nil {
+		return ErrNotFound
+	}
+	if err := checkVersion(car.Version, version); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	car.DeletedAt = &now
+	car.Version++
+	r.store.cars[carID] = car
+
+	return nil
+}
+
+func (r *CarMemory) DeleteCascade(carID int, version int) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	car, ok := r.store.cars[carID]
+	if !ok {
+		return ErrNotFound
+	}
+	if err := checkVersion(car.Version, version); err != nil {
+		return err
+	}
+
+	orderIDs := r.store.orderIDs(func(o memoryOrder) bool {
+		return slices.ContainsFunc(o.items, func(item memoryOrderItem) bool { return item.carID == carID })
+	})
+	if err := r.store.deleteOrders(orderIDs); err != nil {
+		return err
+	}
+
+	for id, v := range r.store.vehicles {
+		if v.CarID == carID {
+			delete(r.store.vehicles, id)
+		}
+	}
+
+	r.store.deleteCar(carID)
+
+	return nil
+}
+
+func (r *CarMemory) Restore(carID int) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	car, ok := r.store.cars[carID]
+	if !ok || car.DeletedAt == nil {
+		return ErrNotFound
+	}
+
+	car.DeletedAt = nil
+	car.UpdatedAt = time.Now()
+	car.Version++
+	r.store.cars[carID] = car
+
+	return nil
+}
+
+func (r *CarMemory) Purge(t time.Time) (int, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	purged := 0
+	for id, car := range r.store.cars {
+		ordered := r.store.orderIDs(func(o memoryOrder) bool {
+			return slices.ContainsFunc(o.items, func(item memoryOrderItem) bool { return item.carID == id })
+		})
+		if !dueForPurge(car.DeletedAt, t) || len(ordered) > 0 {
+			continue
+		}
+
+		for vehicleID, v := range r.store.vehicles {
+			if v.CarID == id {
+				delete(r.store.vehicles, vehicleID)
+			}
+		}
+		r.store.deleteCar(id)
+		purged++
+	}
+
+	return purged, nil
+}
+
+// deleteCar removes the car with its prices and discounts. The caller
+// holds the lock.
+func (s *memoryStore) deleteCar(carID int) {
+	delete(s.cars, carID)
+	for id, p := range s.carPrices {
+		if p.CarID == carID {
+			delete(s.carPrices, id)
+		}
+	}
+	for id, d := range s.discounts {
+		if d.CarID != nil && *d.CarID == carID {
+			delete(s.discounts, id)
+		}
+	}
+}
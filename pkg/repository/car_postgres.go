@@ -0,0 +1,238 @@
+package repository
+
+import (
+	"database/sql"
+	"time"
+
+	goapi "github.com/Stremilov/car-shop"
+)
+
+type CarPostgres struct {
+	db *sql.DB
+}
+
+func NewCarPostgres(db *sql.DB) *CarPostgres {
+	return &CarPostgres{db: db}
+}
+
+func (r *CarPostgres) Create(car goapi.Car) (goapi.Car, error) {
+	query := `
+	INSERT INTO cars (name, power_watts, type, year)
+	VALUES ($1, $2, $3, $4)
+	RETURNING ` + carColumns
+
+	return scanCar(r.db.QueryRow(query, car.Name, car.Power.Watts(), car.Type, car.Year))
+}
+
+var carSortColumns = map[string]string{
+	"id":    "id",
+	"name":  "name",
+	"power": "power_watts",
+	"type":  "type",
+	"year":  "year",
+}
+
+func (r *CarPostgres) GetAll(filter goapi.CarFilter, params goapi.ListParams) ([]goapi.Car, int, error) {
+	q := newSelect(carColumns, "cars")
+	q.whereDeleted("cars", filter.Deleted)
+
+	if filter.Type != "" {
+		q.where("type = ?", filter.Type)
+	}
+
+	if filter.YearFrom != nil {
+		q.where("year >= ?", *filter.YearFrom)
+	}
+
+	if filter.YearTo != nil {
+		q.where("year <= ?", *filter.YearTo)
+	}
+
+	if filter.PowerMin != nil {
+		q.where("power_watts >= ?", filter.PowerMin.Watts())
+	}
+
+	var total int
+	countQuery, countArgs := q.count()
+	if err := r.db.QueryRow(countQuery, countArgs...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	q.page("id", carSortColumns, params)
+	query, args := q.build()
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	cars, err := scanAll(rows, scanCar)
+
+	return cars, total, err
+}
+
+func (r *CarPostgres) GetByID(carID int) (goapi.Car, error) {
+	car, err := scanCar(r.db.QueryRow("SELECT "+carColumns+" FROM cars WHERE cars.id = $1 AND cars.deleted_at IS NULL", carID))
+	if err == sql.ErrNoRows {
+		return car, ErrNotFound
+	}
+
+	return car, err
+}
+
+func (r *CarPostgres) GetDeleted(carID int) (goapi.Car, error) {
+	car, err := scanCar(r.db.QueryRow("SELECT "+carColumns+" FROM cars WHERE cars.id = $1 AND cars.deleted_at IS NOT NULL", carID))
+	if err == sql.ErrNoRows {
+		return car, ErrNotFound
+	}
+
+	return car, err
+}
+
+// liveCarVersion selects the version of a car that is not soft deleted.
+const liveCarVersion = `SELECT version FROM cars WHERE id = $1 AND deleted_at IS NULL`
+
+func (r *CarPostgres) Update(carID int, input goapi.CarUpdate, version int) (goapi.Car, error) {
+	q := newUpdate("cars")
+
+	if input.Name != nil {
+		q.set("name", *input.Name)
+	}
+
+	if input.Power != nil {
+		q.set("power_watts", input.Power.Watts())
+	}
+
+	if input.Type != nil {
+		q.set("type", *input.Type)
+	}
+
+	if input.Year != nil {
+		q.set("year", *input.Year)
+	}
+
+	q.setExpr("updated_at", "now()")
+	q.setExpr("version", "version + 1")
+	q.where("id = ?", carID)
+	q.returnColumns(carColumns)
+	query, args := q.build()
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return goapi.Car{}, err
+	}
+	defer tx.Rollback()
+
+	if err := lockVersion(tx, version, liveCarVersion, carID); err != nil {
+		return goapi.Car{}, err
+	}
+
+	car, err := scanCar(tx.QueryRow(query, args...))
+	if err != nil {
+		return goapi.Car{}, err
+	}
+
+	return car, tx.Commit()
+}
+
+func (r *CarPostgres) Delete(carID int, version int) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := lockVersion(tx, version, liveCarVersion, carID); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM cars WHERE id = $1`, carID); err != nil {
+		return translateError(err)
+	}
+
+	return tx.Commit()
+}
+
+func (r *CarPostgres) SoftDelete(carID int, version int) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := lockVersion(tx, version, liveCarVersion, carID); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`UPDATE cars SET deleted_at = now(), version = version + 1 WHERE id = $1`, carID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *CarPostgres) DeleteCascade(carID int, version int) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := lockVersion(tx, version, `SELECT version FROM cars WHERE id = $1`, carID); err != nil {
+		return err
+	}
+
+	if err := deleteOrders(tx, `SELECT order_id FROM order_items WHERE car_id = $1`, carID); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM vehicles WHERE car_id = $1`, carID); err != nil {
+		return translateError(err)
+	}
+
+	if _, err := tx.Exec(`DELETE FROM cars WHERE id = $1`, carID); err != nil {
+		return translateError(err)
+	}
+
+	return tx.Commit()
+}
+
+func (r *CarPostgres) Restore(carID int) error {
+	result, err := r.db.Exec(`UPDATE cars SET deleted_at = NULL, updated_at = now(), version = version + 1 WHERE id = $1 AND deleted_at IS NOT NULL`, carID)
+	if err != nil {
+		return err
+	}
+
+	return checkRowsAffected(result)
+}
+
+// purgeableCars selects the cars soft deleted before $1 that no order
+// refers to.
+const purgeableCars = `
+	SELECT id FROM cars
+	WHERE deleted_at < $1
+		AND NOT EXISTS (SELECT 1 FROM order_items WHERE order_items.car_id = cars.id)`
+
+func (r *CarPostgres) Purge(t time.Time) (int, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// Vehicles no order refers to are only stock, which goes with the car.
+	if _, err := tx.Exec(`DELETE FROM vehicles WHERE car_id IN (`+purgeableCars+`)`, t); err != nil {
+		return 0, translateError(err)
+	}
+
+	result, err := tx.Exec(`DELETE FROM cars WHERE id IN (`+purgeableCars+`)`, t)
+	if err != nil {
+		return 0, translateError(err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(n), tx.Commit()
+}
@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"cmp"
+	"time"
+
+	goapi "github.com/Stremilov/car-shop"
+)
+
+type ExtraMemory struct {
+	store *memoryStore
+}
+
+func (r *ExtraMemory) Create(extra goapi.Extra) (goapi.Extra, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	for _, e := range r.store.extras {
+		if e.Name == extra.Name {
+			return goapi.Extra{}, ErrDuplicate
+		}
+	}
+
+	r.store.lastExtraID++
+	extra.ExtraID = r.store.lastExtraID
+	extra.CreatedAt = time.Now()
+	extra.UpdatedAt = extra.CreatedAt
+	r.store.extras[extra.ExtraID] = extra
+
+	return extra, nil
+}
+
+var extraSortFields = map[string]func(a, b goapi.Extra) int{
+	"name":  func(a, b goapi.Extra) int { return cmp.Compare(a.Name, b.Name) },
+	"price": func(a, b goapi.Extra) int { return cmp.Compare(a.Price, b.Price) },
+}
+
+func (r *ExtraMemory) GetAll(params goapi.ListParams) ([]goapi.Extra, int, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	var extras []goapi.Extra
+	for _, id := range sortedKeys(r.store.extras) {
+		extras = append(extras, r.store.extras[id])
+	}
+
+	total := len(extras)
+
+	return page(extras, params, func(e goapi.Extra) int { return e.ExtraID }, extraSortFields), total, nil
+}
+
+func (r *ExtraMemory) GetByID(extraID int) (goapi.Extra, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	extra, ok := r.store.extras[extraID]
+	if !ok {
+		return goapi.Extra{}, ErrNotFound
+	}
+
+	return extra, nil
+}
@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"database/sql"
+
+	goapi "github.com/Stremilov/car-shop"
+)
+
+type ExtraPostgres struct {
+	db *sql.DB
+}
+
+func NewExtraPostgres(db *sql.DB) *ExtraPostgres {
+	return &ExtraPostgres{db: db}
+}
+
+func (r *ExtraPostgres) Create(extra goapi.Extra) (goapi.Extra, error) {
+	query := `
+	INSERT INTO extras (name, price, currency)
+	VALUES ($1, $2, $3)
+	RETURNING ` + extraColumns
+
+	created, err := scanExtra(r.db.QueryRow(query, extra.Name, extra.Price, extra.Currency))
+
+	return created, translateError(err)
+}
+
+var extraSortColumns = map[string]string{
+	"id":    "id",
+	"name":  "name",
+	"price": "price",
+}
+
+func (r *ExtraPostgres) GetAll(params goapi.ListParams) ([]goapi.Extra, int, error) {
+	q := newSelect(extraColumns, "extras")
+
+	var total int
+	countQuery, countArgs := q.count()
+	if err := r.db.QueryRow(countQuery, countArgs...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	q.page("id", extraSortColumns, params)
+	query, args := q.build()
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	extras, err := scanAll(rows, scanExtra)
+
+	return extras, total, err
+}
+
+func (r *ExtraPostgres) GetByID(extraID int) (goapi.Extra, error) {
+	extra, err := scanExtra(r.db.QueryRow("SELECT "+extraColumns+" FROM extras WHERE extras.id = $1", extraID))
+	if err == sql.ErrNoRows {
+		return extra, ErrNotFound
+	}
+
+	return extra, err
+}
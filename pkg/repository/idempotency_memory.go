@@ -0,0 +1,64 @@
+package repository
+
+import (
+	"time"
+
+	goapi "github.com/Stremilov/car-shop"
+)
+
+type idempotencyKey struct {
+	userID int
+	key    string
+}
+
+type IdempotencyMemory struct {
+	store *memoryStore
+}
+
+func (r *IdempotencyMemory) Create(request goapi.IdempotentRequest) (goapi.IdempotentRequest, bool, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if _, ok := r.store.users[request.UserID]; !ok {
+		return goapi.IdempotentRequest{}, false, ErrForeignKeyViolation
+	}
+
+	now := time.Now()
+	for key, existing := range r.store.requests {
+		if key.userID == request.UserID && !existing.ExpiresAt.After(now) {
+			delete(r.store.requests, key)
+		}
+	}
+
+	key := idempotencyKey{userID: request.UserID, key: request.Key}
+	if existing, ok := r.store.requests[key]; ok {
+		return existing, false, nil
+	}
+
+	request.Status, request.ContentType, request.Location, request.Body = 0, "", "", nil
+	r.store.requests[key] = request
+
+	return request, true, nil
+}
+
+func (r *IdempotencyMemory) Complete(request goapi.IdempotentRequest) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	key := idempotencyKey{userID: request.UserID, key: request.Key}
+	if _, ok := r.store.requests[key]; !ok {
+		return ErrNotFound
+	}
+	r.store.requests[key] = request
+
+	return nil
+}
+
+func (r *IdempotencyMemory) Delete(userID int, key string) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	delete(r.store.requests, idempotencyKey{userID: userID, key: key})
+
+	return nil
+}
@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"database/sql"
+
+	goapi "github.com/Stremilov/car-shop"
+)
+
+type IdempotencyPostgres struct {
+	db *sql.DB
+}
+
+func NewIdempotencyPostgres(db *sql.DB) *IdempotencyPostgres {
+	return &IdempotencyPostgres{db: db}
+}
+
+func (r *IdempotencyPostgres) Create(request goapi.IdempotentRequest) (goapi.IdempotentRequest, bool, error) {
+	// Expired requests of the user are forgotten first, which also keeps
+	// the table from growing without bounds.
+	_, err := r.db.Exec(`DELETE FROM idempotent_requests WHERE user_id = $1 AND expires_at <= now()`, request.UserID)
+	if err != nil {
+		return goapi.IdempotentRequest{}, false, err
+	}
+
+	result, err := r.db.Exec(`
+	INSERT INTO idempotent_requests (user_id, key, fingerprint, expires_at)
+	VALUES ($1, $2, $3, $4)
+	ON CONFLICT (user_id, key) DO NOTHING`,
+		request.UserID, request.Key, request.Fingerprint, request.ExpiresAt)
+	if err != nil {
+		return goapi.IdempotentRequest{}, false, translateError(err)
+	}
+
+	inserted, err := result.RowsAffected()
+	if err != nil {
+		return goapi.IdempotentRequest{}, false, err
+	}
+	if inserted == 1 {
+		return request, true, nil
+	}
+
+	existing, err := scanIdempotentRequest(r.db.QueryRow(`SELECT `+idempotentRequestColumns+`
+	FROM idempotent_requests WHERE user_id = $1 AND key = $2`, request.UserID, request.Key))
+	if err == sql.ErrNoRows {
+		// Deleted in the meantime, the caller may just try again.
+		return existing, false, ErrNotFound
+	}
+
+	return existing, false, err
+}
+
+func (r *IdempotencyPostgres) Complete(request goapi.IdempotentRequest) error {
+	result, err := r.db.Exec(`
+	UPDATE idempotent_requests
+	SET status = $3, content_type = $4, location = $5, body = $6
+	WHERE user_id = $1 AND key = $2`,
+		request.UserID, request.Key, request.Status, request.ContentType, request.Location, request.Body)
+	if err != nil {
+		return err
+	}
+
+	return checkRowsAffected(result)
+}
+
+func (r *IdempotencyPostgres) Delete(userID int, key string) error {
+	_, err := r.db.Exec(`DELETE FROM idempotent_requests WHERE user_id = $1 AND key = $2`, userID, key)
+
+	return err
+}
@@ -0,0 +1,124 @@
+package repository
+
+import (
+	"cmp"
+	"time"
+
+	goapi "github.com/Stremilov/car-shop"
+)
+
+type InventoryMemory struct {
+	store *memoryStore
+}
+
+func (r *InventoryMemory) Create(vehicle goapi.Vehicle) (goapi.Vehicle, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if _, ok := r.store.cars[vehicle.CarID]; !ok {
+		return goapi.Vehicle{}, ErrForeignKeyViolation
+	}
+
+	for _, v := range r.store.vehicles {
+		if v.VIN == vehicle.VIN {
+			return goapi.Vehicle{}, ErrDuplicate
+		}
+	}
+
+	r.store.lastVehicleID++
+	vehicle.VehicleID = r.store.lastVehicleID
+	vehicle.CreatedAt = time.Now()
+	vehicle.UpdatedAt = vehicle.CreatedAt
+	r.store.vehicles[vehicle.VehicleID] = vehicle
+
+	return vehicle, nil
+}
+
+var vehicleSortFields = map[string]func(a, b goapi.Vehicle) int{
+	"car_id": func(a, b goapi.Vehicle) int { return cmp.Compare(a.CarID, b.CarID) },
+	"vin":    func(a, b goapi.Vehicle) int { return cmp.Compare(a.VIN, b.VIN) },
+	"status": func(a, b goapi.Vehicle) int { return cmp.Compare(a.Status, b.Status) },
+}
+
+func (r *InventoryMemory) GetAll(filter goapi.VehicleFilter, params goapi.ListParams) ([]goapi.Vehicle, int, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	var vehicles []goapi.Vehicle
+	for _, id := range sortedKeys(r.store.vehicles) {
+		v := r.store.vehicles[id]
+		if filter.CarID != nil && v.CarID != *filter.CarID {
+			continue
+		}
+		if filter.Status != "" && v.Status != filter.Status {
+			continue
+		}
+		vehicles = append(vehicles, v)
+	}
+
+	total := len(vehicles)
+
+	return page(vehicles, params, func(v goapi.Vehicle) int { return v.VehicleID }, vehicleSortFields), total, nil
+}
+
+func (r *InventoryMemory) GetByID(vehicleID int) (goapi.Vehicle, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	vehicle, ok := r.store.vehicles[vehicleID]
+	if !ok {
+		return goapi.Vehicle{}, ErrNotFound
+	}
+
+	return vehicle, nil
+}
+
+func (r *InventoryMemory) SetStatus(vehicleID int, from, to goapi.VehicleStatus) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	vehicle, ok := r.store.vehicles[vehicleID]
+	if !ok || vehicle.Status != from {
+		return ErrNotFound
+	}
+
+	vehicle.Status = to
+	vehicle.UpdatedAt = time.Now()
+	r.store.vehicles[vehicleID] = vehicle
+
+	return nil
+}
+
+func (r *InventoryMemory) GetStock(carID *int) ([]goapi.Stock, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	var stock []goapi.Stock
+	for _, id := range sortedKeys(r.store.cars) {
+		if carID != nil && id != *carID {
+			continue
+		}
+
+		s := goapi.Stock{CarID: id}
+		for _, v := range r.store.vehicles {
+			if v.CarID == id {
+				s.Count(v.Status)
+			}
+		}
+		stock = append(stock, s)
+	}
+
+	return stock, nil
+}
+
+// firstVehicle returns the vehicle of carID in status with the lowest ID,
+// the one Postgres would pick. The caller holds the store lock.
+func (s *memoryStore) firstVehicle(carID int, status goapi.VehicleStatus) (goapi.Vehicle, bool) {
+	for _, id := range sortedKeys(s.vehicles) {
+		if v := s.vehicles[id]; v.CarID == carID && v.Status == status {
+			return v, true
+		}
+	}
+
+	return goapi.Vehicle{}, false
+}
@@ -0,0 +1,113 @@
+package repository
+
+import (
+	"database/sql"
+
+	goapi "github.com/Stremilov/car-shop"
+)
+
+type InventoryPostgres struct {
+	db *sql.DB
+}
+
+func NewInventoryPostgres(db *sql.DB) *InventoryPostgres {
+	return &InventoryPostgres{db: db}
+}
+
+func (r *InventoryPostgres) Create(vehicle goapi.Vehicle) (goapi.Vehicle, error) {
+	query := `
+	INSERT INTO vehicles (car_id, vin, status)
+	VALUES ($1, $2, $3)
+	RETURNING ` + vehicleColumns
+
+	created, err := scanVehicle(r.db.QueryRow(query, vehicle.CarID, vehicle.VIN, vehicle.Status))
+
+	return created, translateError(err)
+}
+
+var vehicleSortColumns = map[string]string{
+	"id":     "id",
+	"car_id": "car_id",
+	"vin":    "vin",
+	"status": "status",
+}
+
+func (r *InventoryPostgres) GetAll(filter goapi.VehicleFilter, params goapi.ListParams) ([]goapi.Vehicle, int, error) {
+	q := newSelect(vehicleColumns, "vehicles")
+
+	if filter.CarID != nil {
+		q.where("car_id = ?", *filter.CarID)
+	}
+
+	if filter.Status != "" {
+		q.where("status = ?", filter.Status)
+	}
+
+	var total int
+	countQuery, countArgs := q.count()
+	if err := r.db.QueryRow(countQuery, countArgs...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	q.page("id", vehicleSortColumns, params)
+	query, args := q.build()
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	vehicles, err := scanAll(rows, scanVehicle)
+
+	return vehicles, total, err
+}
+
+func (r *InventoryPostgres) GetByID(vehicleID int) (goapi.Vehicle, error) {
+	vehicle, err := scanVehicle(r.db.QueryRow("SELECT "+vehicleColumns+" FROM vehicles WHERE vehicles.id = $1", vehicleID))
+	if err == sql.ErrNoRows {
+		return vehicle, ErrNotFound
+	}
+
+	return vehicle, err
+}
+
+func (r *InventoryPostgres) SetStatus(vehicleID int, from, to goapi.VehicleStatus) error {
+	result, err := r.db.Exec(`
+	UPDATE vehicles SET status = $3, updated_at = now()
+	WHERE id = $1 AND status = $2`, vehicleID, from, to)
+	if err != nil {
+		return err
+	}
+
+	return checkRowsAffected(result)
+}
+
+func (r *InventoryPostgres) GetStock(carID *int) ([]goapi.Stock, error) {
+	query := `
+	SELECT
+		cars.id,
+		COUNT(vehicles.id) FILTER (WHERE vehicles.status = 'in_stock'),
+		COUNT(vehicles.id) FILTER (WHERE vehicles.status = 'reserved'),
+		COUNT(vehicles.id) FILTER (WHERE vehicles.status = 'sold'),
+		COUNT(vehicles.id) FILTER (WHERE vehicles.status = 'in_transit'),
+		COUNT(vehicles.id)
+	FROM
+		cars
+	LEFT JOIN
+		vehicles ON vehicles.car_id = cars.id
+	WHERE
+		$1::INTEGER IS NULL OR cars.id = $1
+	GROUP BY
+		cars.id
+	ORDER BY
+		cars.id`
+
+	rows, err := r.db.Query(query, carID)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanAll(rows, func(row row) (goapi.Stock, error) {
+		var s goapi.Stock
+		return s, row.Scan(&s.CarID, &s.InStock, &s.Reserved, &s.Sold, &s.InTransit, &s.Total)
+	})
+}
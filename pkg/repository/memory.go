@@ -0,0 +1,147 @@
+package repository
+
+import (
+	"cmp"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	goapi "github.com/Stremilov/car-shop"
+)
+
+// memoryStore holds the tables for the in-memory
+// repositories. The tables share one lock so that foreign key checks between
+// them see a consistent state, the same way they would in Postgres.
+type memoryStore struct {
+	mu sync.RWMutex
+
+	users         map[int]goapi.User
+	accounts      map[int]goapi.Account
+	refreshTokens map[string]goapi.RefreshToken
+	cars          map[int]goapi.Car
+	orders        map[int]memoryOrder
+	extras        map[int]goapi.Extra
+	carPrices     map[int]goapi.CarPrice
+	discounts     map[int]goapi.Discount
+	payments      map[int]goapi.Payment
+	requests      map[idempotencyKey]goapi.IdempotentRequest
+	vehicles      map[int]goapi.Vehicle
+	orderHistory  []goapi.OrderStatusChange
+
+	lastUserID      int
+	lastCarID       int
+	lastOrderID     int
+	lastOrderItemID int
+	lastExtraID     int
+	lastCarPriceID  int
+	lastDiscountID  int
+	lastPaymentID   int
+	lastVehicleID   int
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{
+		users:         make(map[int]goapi.User),
+		accounts:      make(map[int]goapi.Account),
+		refreshTokens: make(map[string]goapi.RefreshToken),
+		cars:          make(map[int]goapi.Car),
+		orders:        make(map[int]memoryOrder),
+		extras:        make(map[int]goapi.Extra),
+		carPrices:     make(map[int]goapi.CarPrice),
+		discounts:     make(map[int]goapi.Discount),
+		payments:      make(map[int]goapi.Payment),
+		requests:      make(map[idempotencyKey]goapi.IdempotentRequest),
+		vehicles:      make(map[int]goapi.Vehicle),
+	}
+}
+
+// NewMemoryRepository returns a Repository that keeps all data in memory. It
+// is meant for tests and local demos and loses everything on restart.
+func NewMemoryRepository() *Repository {
+	store := newMemoryStore()
+
+	return &Repository{
+		Authorization: &AuthMemory{store: store},
+		User:          &UserMemory{store: store},
+		Car:           &CarMemory{store: store},
+		Order:         &OrderMemory{store: store},
+		Extra:         &ExtraMemory{store: store},
+		Pricing:       &PricingMemory{store: store},
+		Payment:       &PaymentMemory{store: store},
+		Idempotency:   &IdempotencyMemory{store: store},
+		Inventory:     &InventoryMemory{store: store},
+	}
+}
+
+// checkVersion fails with ErrVersionMismatch if version is not 0 and not
+// the current version of a record.
+func checkVersion(current, version int) error {
+	if version != 0 && version != current {
+		return ErrVersionMismatch
+	}
+
+	return nil
+}
+
+// visible reports whether a record deleted at deletedAt, nil if it is not
+// deleted, is one of the records deleted says.
+func visible(deletedAt *time.Time, deleted goapi.Deleted) bool {
+	switch deleted {
+	case goapi.IncludeDeleted:
+		return true
+	case goapi.OnlyDeleted:
+		return deletedAt != nil
+	}
+
+	return deletedAt == nil
+}
+
+// dueForPurge reports whether a record deleted at deletedAt was deleted
+// before t.
+func dueForPurge(deletedAt *time.Time, t time.Time) bool {
+	return deletedAt != nil && deletedAt.Before(t)
+}
+
+func sortedKeys[V any](m map[int]V) []int {
+	keys := make([]int, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+
+	return keys
+}
+
+// page sorts the items that already match a filter and cuts one page out of
+// them the same way selectQuery.page does in SQL. fields compares two items by
+// each sort field; ties and the default order use the ID.
+func page[T any](items []T, params goapi.ListParams, id func(T) int, fields map[string]func(a, b T) int) []T {
+	compareField := fields[params.Sort]
+	slices.SortStableFunc(items, func(a, b T) int {
+		c := 0
+		if compareField != nil {
+			c = compareField(a, b)
+		}
+		if c == 0 {
+			c = cmp.Compare(id(a), id(b))
+		}
+		if params.Desc {
+			c = -c
+		}
+		return c
+	})
+
+	if params.Cursor > 0 {
+		items = slices.DeleteFunc(items, func(item T) bool {
+			if params.Desc {
+				return id(item) >= params.Cursor
+			}
+			return id(item) <= params.Cursor
+		})
+	}
+
+	items = items[min(params.Offset, len(items)):]
+
+	return items[:min(params.Limit, len(items))]
+}
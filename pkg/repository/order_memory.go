@@ -0,0 +1,447 @@
+package repository
+
+import (
+	"cmp"
+	"slices"
+	"time"
+
+	goapi "github.com/Stremilov/car-shop"
+)
+
+type memoryOrder struct {
+	id         int
+	userID     int
+	status     goapi.OrderStatus
+	orderDate  time.Time
+	updatedAt  time.Time
+	items      []memoryOrderItem
+	currency   string
+	discount   int64
+	discountID int
+	promoCode  string
+	deletedAt  *time.Time
+}
+
+type memoryOrderItem struct {
+	id         int
+	kind       goapi.OrderItemKind
+	carID      int
+	vehicleID  int
+	extraID    int
+	name       string
+	listPrice  int64
+	unitPrice  int64
+	discountID int
+	quantity   int
+}
+
+type OrderMemory struct {
+	store *memoryStore
+}
+
+func (r *OrderMemory) Create(order goapi.PricedOrder) (goapi.Order, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if _, ok := r.store.users[order.UserID]; !ok {
+		return goapi.Order{}, ErrForeignKeyViolation
+	}
+
+	discountIDs := order.DiscountIDs()
+	for _, id := range discountIDs {
+		d, ok := r.store.discounts[id]
+		if !ok {
+			return goapi.Order{}, ErrForeignKeyViolation
+		}
+		if d.MaxUses != nil && d.Uses >= *d.MaxUses {
+			return goapi.Order{}, ErrDiscountUsedUp
+		}
+	}
+
+	// Reservations are undone if a later item fails, like a rolled back
+	// transaction.
+	var reserved []goapi.Vehicle
+	release := func() {
+		for _, v := range reserved {
+			r.store.vehicles[v.VehicleID] = v
+		}
+	}
+
+	now := time.Now()
+	var items []memoryOrderItem
+	for _, item := range order.Items {
+		if item.CarID != 0 {
+			car, ok := r.store.cars[item.CarID]
+			if !ok {
+				release()
+				return goapi.Order{}, ErrForeignKeyViolation
+			}
+
+			for range item.Quantity {
+				vehicle, ok := r.store.firstVehicle(item.CarID, goapi.VehicleInStock)
+				if !ok {
+					release()
+					return goapi.Order{}, &OutOfStockError{CarID: item.CarID}
+				}
+				reserved = append(reserved, vehicle)
+
+				vehicle.Status = goapi.VehicleReserved
+				vehicle.UpdatedAt = now
+				r.store.vehicles[vehicle.VehicleID] = vehicle
+
+				items = append(items, memoryOrderItem{
+					kind:       goapi.OrderItemCar,
+					carID:      car.CarID,
+					vehicleID:  vehicle.VehicleID,
+					name:       car.Name,
+					listPrice:  item.ListPrice,
+					unitPrice:  item.UnitPrice,
+					discountID: item.DiscountID,
+					quantity:   1,
+				})
+			}
+			continue
+		}
+
+		extra, ok := r.store.extras[item.ExtraID]
+		if !ok {
+			release()
+			return goapi.Order{}, ErrForeignKeyViolation
+		}
+
+		items = append(items, memoryOrderItem{
+			kind:       goapi.OrderItemExtra,
+			extraID:    extra.ExtraID,
+			name:       extra.Name,
+			listPrice:  item.ListPrice,
+			unitPrice:  item.UnitPrice,
+			discountID: item.DiscountID,
+			quantity:   item.Quantity,
+		})
+	}
+
+	for _, id := range discountIDs {
+		d := r.store.discounts[id]
+		d.Uses++
+		r.store.discounts[id] = d
+	}
+
+	for i := range items {
+		r.store.lastOrderItemID++
+		items[i].id = r.store.lastOrderItemID
+	}
+
+	r.store.lastOrderID++
+	o := memoryOrder{
+		id:         r.store.lastOrderID,
+		userID:     order.UserID,
+		status:     goapi.OrderDraft,
+		orderDate:  now,
+		updatedAt:  now,
+		items:      items,
+		currency:   order.Currency,
+		discount:   order.Discount,
+		discountID: order.DiscountID,
+		promoCode:  order.PromoCode,
+	}
+	r.store.orders[o.id] = o
+
+	return r.join(o), nil
+}
+
+var orderSortFields = map[string]func(a, b goapi.Order) int{
+	"order_date": func(a, b goapi.Order) int { return orderTime(a).Compare(orderTime(b)) },
+	"status":     func(a, b goapi.Order) int { return cmp.Compare(a.Status, b.Status) },
+	"user_id":    func(a, b goapi.Order) int { return cmp.Compare(a.User.UserID, b.User.UserID) },
+}
+
+func orderTime(o goapi.Order) time.Time {
+	t, _ := time.Parse(time.RFC3339Nano, o.OrderDate)
+	return t
+}
+
+func (r *OrderMemory) GetAll(filter goapi.OrderFilter, params goapi.ListParams) ([]goapi.Order, int, error) {
+	orders := r.find(func(o memoryOrder) bool {
+		if !visible(o.deletedAt, filter.Deleted) {
+			return false
+		}
+		if filter.DateFrom != nil && o.orderDate.Before(*filter.DateFrom) {
+			return false
+		}
+		if filter.Status != "" && o.status != filter.Status {
+			return false
+		}
+		return filter.DateTo == nil || !o.orderDate.After(*filter.DateTo)
+	})
+
+	total := len(orders)
+
+	return page(orders, params, func(o goapi.Order) int { return o.OrderID }, orderSortFields), total, nil
+}
+
+func (r *OrderMemory) GetByID(orderID int) (goapi.Order, error) {
+	return r.get(func(o memoryOrder) bool { return o.id == orderID && o.deletedAt == nil })
+}
+
+func (r *OrderMemory) GetDeleted(orderID int) (goapi.Order, error) {
+	return r.get(func(o memoryOrder) bool { return o.id == orderID && o.deletedAt != nil })
+}
+
+func (r *OrderMemory) get(match func(memoryOrder) bool) (goapi.Order, error) {
+	orders := r.find(match)
+	if len(orders) == 0 {
+		return goapi.Order{}, ErrNotFound
+	}
+
+	return orders[0], nil
+}
+
+func (r *OrderMemory) GetByUserID(userID int) ([]goapi.Order, error) {
+	return r.find(func(o memoryOrder) bool { return o.userID == userID && o.deletedAt == nil }), nil
+}
+
+func (r *OrderMemory) SetStatus(change goapi.OrderStatusChange, vehicleStatus goapi.VehicleStatus) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	o, ok := r.store.orders[change.OrderID]
+	if !ok || o.status != change.From || o.deletedAt != nil {
+		return ErrNotFound
+	}
+
+	now := time.Now()
+	o.status = change.To
+	o.updatedAt = now
+	r.store.orders[o.id] = o
+
+	for _, item := range o.items {
+		if vehicle, ok := r.store.vehicles[item.vehicleID]; ok && vehicleStatus != "" {
+			vehicle.Status = vehicleStatus
+			vehicle.UpdatedAt = now
+			r.store.vehicles[vehicle.VehicleID] = vehicle
+		}
+	}
+
+	change.ChangedAt = now
+	r.store.orderHistory = append(r.store.orderHistory, change)
+
+	return nil
+}
+
+func (r *OrderMemory) GetHistory(orderID int) ([]goapi.OrderStatusChange, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	var history []goapi.OrderStatusChange
+	for _, change := range r.store.orderHistory {
+		if change.OrderID == orderID {
+			history = append(history, change)
+		}
+	}
+
+	return history, nil
+}
+
+func (r *OrderMemory) Delete(orderID int) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if o, ok := r.store.orders[orderID]; !ok || o.deletedAt != nil {
+		return ErrNotFound
+	}
+
+	return r.store.deleteOrders([]int{orderID})
+}
+
+func (r *OrderMemory) SoftDelete(orderID int) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	o, ok := r.store.orders[orderID]
+	if !ok || o.deletedAt != nil {
+		return ErrNotFound
+	}
+
+	r.store.releaseVehicles(o)
+
+	now := time.Now()
+	o.deletedAt = &now
+	r.store.orders[orderID] = o
+
+	return nil
+}
+
+func (r *OrderMemory) Restore(orderID int, vehicleStatus goapi.VehicleStatus) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	o, ok := r.store.orders[orderID]
+	if !ok || o.deletedAt == nil {
+		return ErrNotFound
+	}
+
+	now := time.Now()
+	if vehicleStatus != "" {
+		for _, item := range o.items {
+			if vehicle, ok := r.store.vehicles[item.vehicleID]; ok && vehicle.Status != goapi.VehicleInStock {
+				return &OutOfStockError{CarID: vehicle.CarID}
+			}
+		}
+
+		for _, item := range o.items {
+			if vehicle, ok := r.store.vehicles[item.vehicleID]; ok {
+				vehicle.Status = vehicleStatus
+				vehicle.UpdatedAt = now
+				r.store.vehicles[vehicle.VehicleID] = vehicle
+			}
+		}
+	}
+
+	o.deletedAt = nil
+	o.updatedAt = now
+	r.store.orders[orderID] = o
+
+	return nil
+}
+
+func (r *OrderMemory) Purge(t time.Time) (int, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	paid := make(map[int]bool)
+	for _, p := range r.store.payments {
+		paid[p.OrderID] = true
+	}
+
+	orderIDs := r.store.orderIDs(func(o memoryOrder) bool { return dueForPurge(o.deletedAt, t) && !paid[o.id] })
+
+	return len(orderIDs), r.store.deleteOrders(orderIDs)
+}
+
+// orderIDs returns the IDs of the orders matching the predicate in
+// ascending order. The caller holds the lock.
+func (s *memoryStore) orderIDs(match func(memoryOrder) bool) []int {
+	var ids []int
+	for _, id := range sortedKeys(s.orders) {
+		if match(s.orders[id]) {
+			ids = append(ids, id)
+		}
+	}
+
+	return ids
+}
+
+// deleteOrders removes the orders with their history and puts their
+// reserved vehicles back in stock. It fails with ErrForeignKeyViolation,
+// removing nothing, if any of them has payments. The caller holds the
+// lock.
+func (s *memoryStore) deleteOrders(orderIDs []int) error {
+	for _, p := range s.payments {
+		if slices.Contains(orderIDs, p.OrderID) {
+			return ErrForeignKeyViolation
+		}
+	}
+
+	for _, orderID := range orderIDs {
+		s.releaseVehicles(s.orders[orderID])
+		delete(s.orders, orderID)
+	}
+
+	s.orderHistory = slices.DeleteFunc(s.orderHistory, func(c goapi.OrderStatusChange) bool {
+		return slices.Contains(orderIDs, c.OrderID)
+	})
+
+	return nil
+}
+
+// releaseVehicles puts the vehicles o holds back in stock. Orders that
+// do not hold theirs anymore, and soft deleted orders, which gave them back
+// when they were deleted, leave them alone, since another order may have
+// reserved them since. The caller holds the lock.
+func (s *memoryStore) releaseVehicles(o memoryOrder) {
+	if !o.status.HoldsVehicles() || o.deletedAt != nil {
+		return
+	}
+
+	for _, item := range o.items {
+		if vehicle, ok := s.vehicles[item.vehicleID]; ok && vehicle.Status == goapi.VehicleReserved {
+			vehicle.Status = goapi.VehicleInStock
+			vehicle.UpdatedAt = time.Now()
+			s.vehicles[vehicle.VehicleID] = vehicle
+		}
+	}
+}
+
+func (r *OrderMemory) GetIDsByUserID(userID int) ([]int, error) {
+	return r.findIDs(func(o memoryOrder) bool { return o.userID == userID }), nil
+}
+
+func (r *OrderMemory) GetIDsByCarID(carID int) ([]int, error) {
+	return r.findIDs(func(o memoryOrder) bool {
+		return slices.ContainsFunc(o.items, func(item memoryOrderItem) bool { return item.carID == carID })
+	}), nil
+}
+
+func (r *OrderMemory) findIDs(match func(memoryOrder) bool) []int {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	return r.store.orderIDs(match)
+}
+
+// find returns the orders matching the predicate joined with their user and
+// car, ordered by ID.
+func (r *OrderMemory) find(match func(memoryOrder) bool) []goapi.Order {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	var orders []goapi.Order
+	for _, id := range sortedKeys(r.store.orders) {
+		o := r.store.orders[id]
+		if !match(o) {
+			continue
+		}
+
+		orders = append(orders, r.join(o))
+	}
+
+	return orders
+}
+
+// join fills in the user and the items of o. The caller holds the store
+// lock.
+func (r *OrderMemory) join(o memoryOrder) goapi.Order {
+	order := goapi.Order{
+		OrderID:   o.id,
+		OrderDate: o.orderDate.Format(time.RFC3339Nano),
+		User:      r.store.users[o.userID],
+		Status:    o.status,
+		Items:     make([]goapi.OrderItem, 0, len(o.items)),
+		Currency:  o.currency,
+		Discount:  o.discount,
+		PromoCode: o.promoCode,
+		UpdatedAt: o.updatedAt,
+		DeletedAt: o.deletedAt,
+	}
+
+	for _, i := range o.items {
+		item := goapi.OrderItem{
+			ItemID:    i.id,
+			Kind:      i.kind,
+			VIN:       r.store.vehicles[i.vehicleID].VIN,
+			ExtraID:   i.extraID,
+			Name:      i.name,
+			ListPrice: i.listPrice,
+			UnitPrice: i.unitPrice,
+			Quantity:  i.quantity,
+		}
+		if car, ok := r.store.cars[i.carID]; ok {
+			car = r.store.withPrice(car)
+			item.Car = &car
+		}
+		order.Items = append(order.Items, item)
+	}
+	order.SumTotals()
+
+	return order
+}
@@ -0,0 +1,487 @@
+package repository
+
+import (
+	"database/sql"
+	"time"
+
+	goapi "github.com/Stremilov/car-shop"
+	"github.com/lib/pq"
+)
+
+type OrderPostgres struct {
+	db *sql.DB
+}
+
+func NewOrderPostgres(db *sql.DB) *OrderPostgres {
+	return &OrderPostgres{db: db}
+}
+
+// reserveCarItem reserves the first vehicle of car $2 in stock and adds it
+// to order $1. SKIP LOCKED lets concurrent orders of the same car each take
+// a different vehicle instead of queueing behind the first.
+const reserveCarItem = `
+	WITH vehicle AS (
+		SELECT id FROM vehicles
+		WHERE car_id = $2 AND status = 'in_stock'
+		ORDER BY id
+		LIMIT 1
+		FOR UPDATE SKIP LOCKED
+	), reserved AS (
+		UPDATE vehicles SET status = 'reserved', updated_at = now()
+		FROM vehicle
+		WHERE vehicles.id = vehicle.id
+		RETURNING vehicles.id, vehicles.car_id
+	)
+	INSERT INTO order_items (order_id, kind, car_id, vehicle_id, name, list_price, unit_price, discount_id)
+	SELECT $1, 'car', reserved.car_id, reserved.id, cars.name, $3, $4, NULLIF($5, 0)
+	FROM reserved
+	JOIN cars ON cars.id = reserved.car_id`
+
+// addExtraItem adds $3 of extra $2 to order $1.
+const addExtraItem = `
+	INSERT INTO order_items (order_id, kind, extra_id, name, quantity, list_price, unit_price, discount_id)
+	SELECT $1, 'extra', id, name, $3, $4, $5, NULLIF($6, 0)
+	FROM extras
+	WHERE id = $2`
+
+func (r *OrderPostgres) Create(order goapi.PricedOrder) (goapi.Order, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return goapi.Order{}, err
+	}
+	defer tx.Rollback()
+
+	var orderID int
+	err = tx.QueryRow(`
+	INSERT INTO orders (user_id, currency, discount, discount_id, promo_code)
+	VALUES ($1, $2, $3, NULLIF($4, 0), NULLIF($5, ''))
+	RETURNING id`, order.UserID, order.Currency, order.Discount, order.DiscountID, order.PromoCode).Scan(&orderID)
+	if err != nil {
+		return goapi.Order{}, translateError(err)
+	}
+
+	for _, item := range order.Items {
+		if item.CarID != 0 {
+			for range item.Quantity {
+				result, err := tx.Exec(reserveCarItem, orderID, item.CarID, item.ListPrice, item.UnitPrice, item.DiscountID)
+				if err != nil {
+					return goapi.Order{}, err
+				}
+				err = checkRowsAffected(result)
+				if err == ErrNotFound {
+					return goapi.Order{}, &OutOfStockError{CarID: item.CarID}
+				}
+				if err != nil {
+					return goapi.Order{}, err
+				}
+			}
+			continue
+		}
+
+		result, err := tx.Exec(addExtraItem, orderID, item.ExtraID, item.Quantity, item.ListPrice, item.UnitPrice, item.DiscountID)
+		if err != nil {
+			return goapi.Order{}, err
+		}
+		err = checkRowsAffected(result)
+		if err == ErrNotFound {
+			return goapi.Order{}, ErrForeignKeyViolation
+		}
+		if err != nil {
+			return goapi.Order{}, err
+		}
+	}
+
+	for _, discountID := range order.DiscountIDs() {
+		result, err := tx.Exec(`
+		UPDATE discounts SET uses = uses + 1
+		WHERE id = $1 AND (max_uses IS NULL OR uses < max_uses)`, discountID)
+		if err != nil {
+			return goapi.Order{}, err
+		}
+		err = checkRowsAffected(result)
+		if err == ErrNotFound {
+			return goapi.Order{}, ErrDiscountUsedUp
+		}
+		if err != nil {
+			return goapi.Order{}, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return goapi.Order{}, err
+	}
+
+	return r.GetByID(orderID)
+}
+
+var orderSortColumns = map[string]string{
+	"id":         "orders.id",
+	"order_date": "orders.order_date",
+	"status":     "orders.status",
+	"user_id":    "orders.user_id",
+}
+
+func (r *OrderPostgres) GetAll(filter goapi.OrderFilter, params goapi.ListParams) ([]goapi.Order, int, error) {
+	q := newSelect(orderColumns, "orders"+orderJoins)
+	q.whereDeleted("orders", filter.Deleted)
+
+	if filter.DateFrom != nil {
+		q.where("orders.order_date >= ?", *filter.DateFrom)
+	}
+
+	if filter.DateTo != nil {
+		q.where("orders.order_date <= ?", *filter.DateTo)
+	}
+
+	if filter.Status != "" {
+		q.where("orders.status = ?", filter.Status)
+	}
+
+	var total int
+	countQuery, countArgs := q.count()
+	if err := r.db.QueryRow(countQuery, countArgs...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	q.page("orders.id", orderSortColumns, params)
+	query, args := q.build()
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	orders, err := scanAll(rows, scanOrder)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	orders, err = r.withItems(orders)
+
+	return orders, total, err
+}
+
+func (r *OrderPostgres) GetByID(orderID int) (goapi.Order, error) {
+	return r.get("orders.id = $1 AND orders.deleted_at IS NULL", orderID)
+}
+
+func (r *OrderPostgres) GetDeleted(orderID int) (goapi.Order, error) {
+	return r.get("orders.id = $1 AND orders.deleted_at IS NOT NULL", orderID)
+}
+
+// get returns the order matching cond, given its args, with its items.
+func (r *OrderPostgres) get(cond string, args ...interface{}) (goapi.Order, error) {
+	query := "SELECT " + orderColumns + " FROM orders" + orderJoins + " WHERE " + cond
+
+	order, err := scanOrder(r.db.QueryRow(query, args...))
+	if err == sql.ErrNoRows {
+		return order, ErrNotFound
+	}
+	if err != nil {
+		return order, err
+	}
+
+	orders, err := r.withItems([]goapi.Order{order})
+	if err != nil {
+		return goapi.Order{}, err
+	}
+
+	return orders[0], nil
+}
+
+func (r *OrderPostgres) GetByUserID(userID int) ([]goapi.Order, error) {
+	query := "SELECT " + orderColumns + " FROM orders" + orderJoins + " WHERE orders.user_id = $1 AND orders.deleted_at IS NULL ORDER BY orders.id"
+
+	rows, err := r.db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	orders, err := scanAll(rows, scanOrder)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.withItems(orders)
+}
+
+// withItems reads the items of orders with their cars and sums up the
+// totals.
+func (r *OrderPostgres) withItems(orders []goapi.Order) ([]goapi.Order, error) {
+	if len(orders) == 0 {
+		return orders, nil
+	}
+
+	orderIDs := make([]int64, len(orders))
+	index := make(map[int]int, len(orders))
+	for i, o := range orders {
+		orderIDs[i] = int64(o.OrderID)
+		index[o.OrderID] = i
+		orders[i].Items = []goapi.OrderItem{}
+	}
+
+	rows, err := r.db.Query(`
+	SELECT `+orderItemColumns+`
+	FROM order_items
+	LEFT JOIN vehicles ON order_items.vehicle_id = vehicles.id
+	WHERE order_items.order_id = ANY($1)
+	ORDER BY order_items.id`, pq.Array(orderIDs))
+	if err != nil {
+		return nil, err
+	}
+
+	items, err := scanAll(rows, scanOrderItem)
+	if err != nil {
+		return nil, err
+	}
+
+	var carIDs []int64
+	for _, i := range items {
+		if i.carID != 0 {
+			carIDs = append(carIDs, int64(i.carID))
+		}
+	}
+
+	rows, err = r.db.Query("SELECT "+carColumns+" FROM cars WHERE cars.id = ANY($1)", pq.Array(carIDs))
+	if err != nil {
+		return nil, err
+	}
+
+	cars, err := scanAll(rows, scanCar)
+	if err != nil {
+		return nil, err
+	}
+
+	carsByID := make(map[int]goapi.Car, len(cars))
+	for _, c := range cars {
+		carsByID[c.CarID] = c
+	}
+
+	for _, i := range items {
+		if car, ok := carsByID[i.carID]; ok {
+			i.item.Car = &car
+		}
+		o := &orders[index[i.orderID]]
+		o.Items = append(o.Items, i.item)
+	}
+
+	for i := range orders {
+		orders[i].SumTotals()
+	}
+
+	return orders, nil
+}
+
+func (r *OrderPostgres) GetIDsByUserID(userID int) ([]int, error) {
+	return r.getIDs(`SELECT id FROM orders WHERE user_id = $1 ORDER BY id`, userID)
+}
+
+func (r *OrderPostgres) GetIDsByCarID(carID int) ([]int, error) {
+	return r.getIDs(`SELECT DISTINCT order_id FROM order_items WHERE car_id = $1 ORDER BY order_id`, carID)
+}
+
+func (r *OrderPostgres) getIDs(query string, args ...interface{}) ([]int, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanAll(rows, func(r row) (int, error) {
+		var id int
+		return id, r.Scan(&id)
+	})
+}
+
+func (r *OrderPostgres) SetStatus(change goapi.OrderStatusChange, vehicleStatus goapi.VehicleStatus) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+	UPDATE orders SET status = $3, updated_at = now()
+	WHERE id = $1 AND status = $2 AND deleted_at IS NULL`, change.OrderID, change.From, change.To)
+	if err != nil {
+		return err
+	}
+	if err := checkRowsAffected(result); err != nil {
+		return err
+	}
+
+	if vehicleStatus != "" {
+		_, err = tx.Exec(`
+		UPDATE vehicles SET status = $2, updated_at = now()
+		WHERE id IN (SELECT vehicle_id FROM order_items WHERE order_id = $1)`, change.OrderID, vehicleStatus)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(`
+	INSERT INTO order_status_history (order_id, from_status, to_status, changed_by, note)
+	VALUES ($1, $2, $3, NULLIF($4, 0), $5)`, change.OrderID, change.From, change.To, change.ChangedBy, change.Note)
+	if err != nil {
+		return translateError(err)
+	}
+
+	return tx.Commit()
+}
+
+func (r *OrderPostgres) GetHistory(orderID int) ([]goapi.OrderStatusChange, error) {
+	rows, err := r.db.Query(`
+	SELECT order_id, from_status, to_status, COALESCE(changed_by, 0), changed_at, note
+	FROM order_status_history
+	WHERE order_id = $1
+	ORDER BY id`, orderID)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanAll(rows, func(row row) (goapi.OrderStatusChange, error) {
+		var c goapi.OrderStatusChange
+		return c, row.Scan(&c.OrderID, &c.From, &c.To, &c.ChangedBy, &c.ChangedAt, &c.Note)
+	})
+}
+
+func (r *OrderPostgres) Delete(orderID int) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := releaseVehicles(tx, `SELECT $1::integer`, orderID); err != nil {
+		return err
+	}
+
+	result, err := tx.Exec(`DELETE FROM orders WHERE id = $1 AND deleted_at IS NULL`, orderID)
+	if err != nil {
+		return translateError(err)
+	}
+	if err := checkRowsAffected(result); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *OrderPostgres) SoftDelete(orderID int) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := releaseVehicles(tx, `SELECT $1::integer`, orderID); err != nil {
+		return err
+	}
+
+	result, err := tx.Exec(`UPDATE orders SET deleted_at = now() WHERE id = $1 AND deleted_at IS NULL`, orderID)
+	if err != nil {
+		return err
+	}
+	if err := checkRowsAffected(result); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *OrderPostgres) Restore(orderID int, vehicleStatus goapi.VehicleStatus) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`UPDATE orders SET deleted_at = NULL, updated_at = now() WHERE id = $1 AND deleted_at IS NOT NULL`, orderID)
+	if err != nil {
+		return err
+	}
+	if err := checkRowsAffected(result); err != nil {
+		return err
+	}
+
+	if vehicleStatus != "" {
+		// The vehicles are locked so that no other order can reserve them
+		// between checking and taking them.
+		rows, err := tx.Query(`
+		SELECT car_id, status FROM vehicles
+		WHERE id IN (SELECT vehicle_id FROM order_items WHERE order_id = $1)
+		ORDER BY id
+		FOR UPDATE`, orderID)
+		if err != nil {
+			return err
+		}
+
+		vehicles, err := scanAll(rows, func(r row) (goapi.Vehicle, error) {
+			var v goapi.Vehicle
+			return v, r.Scan(&v.CarID, &v.Status)
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, v := range vehicles {
+			if v.Status != goapi.VehicleInStock {
+				return &OutOfStockError{CarID: v.CarID}
+			}
+		}
+
+		_, err = tx.Exec(`
+		UPDATE vehicles SET status = $2, updated_at = now()
+		WHERE id IN (SELECT vehicle_id FROM order_items WHERE order_id = $1)`, orderID, vehicleStatus)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (r *OrderPostgres) Purge(t time.Time) (int, error) {
+	// Soft deleting the orders put their reserved vehicles back in stock
+	// already.
+	result, err := r.db.Exec(`
+	DELETE FROM orders
+	WHERE deleted_at < $1
+		AND NOT EXISTS (SELECT 1 FROM payments WHERE payments.order_id = orders.id)`, t)
+	if err != nil {
+		return 0, translateError(err)
+	}
+
+	n, err := result.RowsAffected()
+
+	return int(n), err
+}
+
+// deleteOrders deletes the orders whose IDs the query selects, given its
+// args, and puts their reserved vehicles back in stock. It fails with
+// ErrForeignKeyViolation if any of them has payments.
+func deleteOrders(tx *sql.Tx, selectIDs string, args ...interface{}) error {
+	if err := releaseVehicles(tx, selectIDs, args...); err != nil {
+		return err
+	}
+
+	_, err := tx.Exec(`DELETE FROM orders WHERE id IN (`+selectIDs+`)`, args...)
+
+	return translateError(err)
+}
+
+// releaseVehicles puts the vehicles held by the orders whose IDs the query
+// selects, given its args, back in stock. Orders that do not hold theirs
+// anymore (see goapi.OrderStatus.HoldsVehicles), and soft deleted orders,
+// which gave them back when they were deleted, leave them alone, since
+// another order may have reserved them since.
+func releaseVehicles(tx *sql.Tx, selectIDs string, args ...interface{}) error {
+	_, err := tx.Exec(`
+	UPDATE vehicles SET status = 'in_stock', updated_at = now()
+	WHERE status = 'reserved'
+		AND id IN (
+			SELECT order_items.vehicle_id FROM order_items
+			JOIN orders ON orders.id = order_items.order_id
+			WHERE orders.status IN ('draft', 'pending_payment') AND orders.deleted_at IS NULL
+				AND orders.id IN (`+selectIDs+`))`, args...)
+
+	return err
+}
@@ -0,0 +1,96 @@
+package repository
+
+import (
+	"time"
+
+	goapi "github.com/Stremilov/car-shop"
+)
+
+type PaymentMemory struct {
+	store *memoryStore
+}
+
+func (r *PaymentMemory) Create(payment goapi.Payment) (goapi.Payment, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if _, ok := r.store.orders[payment.OrderID]; !ok {
+		return goapi.Payment{}, ErrForeignKeyViolation
+	}
+
+	for _, p := range r.store.payments {
+		if p.OrderID != payment.OrderID {
+			continue
+		}
+		if p.IdempotencyKey == payment.IdempotencyKey || p.Status != goapi.PaymentFailed {
+			return goapi.Payment{}, ErrDuplicate
+		}
+	}
+
+	r.store.lastPaymentID++
+	payment.PaymentID = r.store.lastPaymentID
+	payment.CreatedAt = time.Now()
+	payment.UpdatedAt = payment.CreatedAt
+	r.store.payments[payment.PaymentID] = payment
+
+	return payment, nil
+}
+
+func (r *PaymentMemory) GetByID(paymentID int) (goapi.Payment, error) {
+	return r.find(func(p goapi.Payment) bool { return p.PaymentID == paymentID })
+}
+
+func (r *PaymentMemory) GetByKey(orderID int, idempotencyKey string) (goapi.Payment, error) {
+	return r.find(func(p goapi.Payment) bool { return p.OrderID == orderID && p.IdempotencyKey == idempotencyKey })
+}
+
+func (r *PaymentMemory) GetByRef(provider, ref string) (goapi.Payment, error) {
+	return r.find(func(p goapi.Payment) bool {
+		return p.Provider == provider && p.ProviderRef != "" && p.ProviderRef == ref
+	})
+}
+
+func (r *PaymentMemory) find(match func(goapi.Payment) bool) (goapi.Payment, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	for _, p := range r.store.payments {
+		if match(p) {
+			return p, nil
+		}
+	}
+
+	return goapi.Payment{}, ErrNotFound
+}
+
+func (r *PaymentMemory) GetByOrderID(orderID int) ([]goapi.Payment, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	var payments []goapi.Payment
+	for _, id := range sortedKeys(r.store.payments) {
+		if p := r.store.payments[id]; p.OrderID == orderID {
+			payments = append(payments, p)
+		}
+	}
+
+	return payments, nil
+}
+
+func (r *PaymentMemory) Update(payment goapi.Payment, from goapi.PaymentStatus) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	stored, ok := r.store.payments[payment.PaymentID]
+	if !ok || stored.Status != from {
+		return ErrNotFound
+	}
+
+	stored.Status = payment.Status
+	stored.ProviderRef = payment.ProviderRef
+	stored.FailureReason = payment.FailureReason
+	stored.UpdatedAt = time.Now()
+	r.store.payments[stored.PaymentID] = stored
+
+	return nil
+}
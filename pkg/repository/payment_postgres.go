@@ -0,0 +1,70 @@
+package repository
+
+import (
+	"database/sql"
+
+	goapi "github.com/Stremilov/car-shop"
+)
+
+type PaymentPostgres struct {
+	db *sql.DB
+}
+
+func NewPaymentPostgres(db *sql.DB) *PaymentPostgres {
+	return &PaymentPostgres{db: db}
+}
+
+func (r *PaymentPostgres) Create(payment goapi.Payment) (goapi.Payment, error) {
+	query := `
+	INSERT INTO payments (order_id, provider, amount, currency, status, idempotency_key)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	RETURNING ` + paymentColumns
+
+	created, err := scanPayment(r.db.QueryRow(query, payment.OrderID, payment.Provider, payment.Amount,
+		payment.Currency, payment.Status, payment.IdempotencyKey))
+
+	return created, translateError(err)
+}
+
+func (r *PaymentPostgres) GetByID(paymentID int) (goapi.Payment, error) {
+	return r.get("payments.id = $1", paymentID)
+}
+
+func (r *PaymentPostgres) GetByKey(orderID int, idempotencyKey string) (goapi.Payment, error) {
+	return r.get("payments.order_id = $1 AND payments.idempotency_key = $2", orderID, idempotencyKey)
+}
+
+func (r *PaymentPostgres) GetByRef(provider, ref string) (goapi.Payment, error) {
+	return r.get("payments.provider = $1 AND payments.provider_ref = $2", provider, ref)
+}
+
+func (r *PaymentPostgres) get(cond string, args ...interface{}) (goapi.Payment, error) {
+	payment, err := scanPayment(r.db.QueryRow("SELECT "+paymentColumns+" FROM payments WHERE "+cond, args...))
+	if err == sql.ErrNoRows {
+		return payment, ErrNotFound
+	}
+
+	return payment, err
+}
+
+func (r *PaymentPostgres) GetByOrderID(orderID int) ([]goapi.Payment, error) {
+	rows, err := r.db.Query("SELECT "+paymentColumns+" FROM payments WHERE order_id = $1 ORDER BY id", orderID)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanAll(rows, scanPayment)
+}
+
+func (r *PaymentPostgres) Update(payment goapi.Payment, from goapi.PaymentStatus) error {
+	result, err := r.db.Exec(`
+	UPDATE payments
+	SET status = $3, provider_ref = NULLIF($4, ''), failure_reason = $5, updated_at = now()
+	WHERE id = $1 AND status = $2`,
+		payment.PaymentID, from, payment.Status, payment.ProviderRef, payment.FailureReason)
+	if err != nil {
+		return translateError(err)
+	}
+
+	return checkRowsAffected(result)
+}
@@ -0,0 +1,67 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/Stremilov/car-shop/pkg/config"
+	"github.com/lib/pq"
+)
+
+const (
+	foreignKeyViolation = "23503"
+	uniqueViolation     = "23505"
+)
+
+func NewPostgresDB(cfg config.DB) (*sql.DB, error) {
+	db, err := sql.Open("postgres", cfg.DSN)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to ping database: %w", err)
+	}
+
+	return db, nil
+}
+
+// translateError maps driver errors the callers care about to the
+// repository sentinel errors.
+func translateError(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch pqErr.Code {
+		case foreignKeyViolation:
+			return fmt.Errorf("%w: %s", ErrForeignKeyViolation, pqErr.Message)
+		case uniqueViolation:
+			return fmt.Errorf("%w: %s", ErrDuplicate, pqErr.Message)
+		}
+	}
+
+	return err
+}
+
+// lockVersion locks the row that query selects the version of for the rest
+// of tx. It fails with ErrNotFound if there is no such row and with
+// ErrVersionMismatch if version is not 0 and the row is at another version.
+func lockVersion(tx *sql.Tx, version int, query string, args ...interface{}) error {
+	var current int
+	err := tx.QueryRow(query+" FOR UPDATE", args...).Scan(&current)
+	switch {
+	case err == sql.ErrNoRows:
+		return ErrNotFound
+	case err != nil:
+		return err
+	case version != 0 && version != current:
+		return ErrVersionMismatch
+	}
+
+	return nil
+}
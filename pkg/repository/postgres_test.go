@@ -0,0 +1,226 @@
+package repository_test
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	goapi "github.com/Stremilov/car-shop"
+	"github.com/Stremilov/car-shop/pkg/config"
+	"github.com/Stremilov/car-shop/pkg/migrate"
+	"github.com/Stremilov/car-shop/pkg/repository"
+	"github.com/Stremilov/car-shop/pkg/service"
+	"github.com/Stremilov/car-shop/pkg/testdb"
+)
+
+// The tests below run the deletions against the Postgres repositories,
+// whose SQL the tests on memory storage leave out. They need a test
+// database, see package testdb.
+
+var vins = []string{"1M8GDM9AXKP042788", "1FTFW1ET5DFC10312", "5YJSA1E26HF000337"}
+
+// shop is the services on a migrated schema of the test database.
+type shop struct {
+	*service.Service
+	t *testing.T
+}
+
+func newShop(t *testing.T, args ...string) *shop {
+	t.Helper()
+
+	db := testdb.New(t)
+
+	m, err := migrate.New(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Up(); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, _, err := config.Load(append([]string{"-storage=postgres", "-db-dsn=" + os.Getenv(testdb.DSNEnv),
+		"-auth-jwt-secret=" + strings.Repeat("x", 32), "-payment-webhook-secret=" + strings.Repeat("y", 32)}, args...))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &shop{Service: service.NewService(repository.NewRepository(db), cfg), t: t}
+}
+
+func (s *shop) addUser() int {
+	s.t.Helper()
+
+	user, err := s.User.Create(goapi.User{FirstName: "Ann", LastName: "Buyer", Age: 30})
+	if err != nil {
+		s.t.Fatal(err)
+	}
+
+	return user.UserID
+}
+
+func (s *shop) addCar(vins ...string) int {
+	s.t.Helper()
+
+	car, err := s.Car.Create(goapi.Car{Name: "Golf", Power: goapi.Power{Value: 150, Unit: goapi.PowerUnitHP}, Type: "hatch", Year: 2020})
+	if err != nil {
+		s.t.Fatal(err)
+	}
+
+	if _, err := s.Pricing.AddCarPrice(car.CarID, goapi.CarPrice{Amount: 2000000, Currency: "EUR"}); err != nil {
+		s.t.Fatal(err)
+	}
+
+	for _, vin := range vins {
+		if _, err := s.Inventory.Create(goapi.Vehicle{CarID: car.CarID, VIN: vin}); err != nil {
+			s.t.Fatal(err)
+		}
+	}
+
+	return car.CarID
+}
+
+func (s *shop) order(input goapi.OrderInput) int {
+	s.t.Helper()
+
+	order, err := s.Order.Create(input)
+	if err != nil {
+		s.t.Fatalf("Create(%+v): %v", input, err)
+	}
+
+	return order.OrderID
+}
+
+func (s *shop) setStatus(orderID, userID int, status goapi.OrderStatus) {
+	s.t.Helper()
+
+	if _, err := s.Order.SetStatus(orderID, status, userID, ""); err != nil {
+		s.t.Fatal(err)
+	}
+}
+
+// pay pays for a draft order in full.
+func (s *shop) pay(orderID, userID int) {
+	s.t.Helper()
+
+	s.setStatus(orderID, userID, goapi.OrderPendingPayment)
+	if _, _, err := s.Payment.Pay(orderID, "key-1", goapi.PaymentInput{Token: "tok_visa"}, userID); err != nil {
+		s.t.Fatal(err)
+	}
+}
+
+// assertStock checks how many vehicles of carID are in stock and reserved.
+func (s *shop) assertStock(carID, inStock, reserved int) {
+	s.t.Helper()
+
+	stock, err := s.Inventory.GetStock(&carID)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+
+	var gotInStock, gotReserved int
+	if len(stock) > 0 {
+		gotInStock, gotReserved = stock[0].InStock, stock[0].Reserved
+	}
+	if gotInStock != inStock || gotReserved != reserved {
+		s.t.Errorf("car %d: got %d in stock and %d reserved, want %d and %d", carID, gotInStock, gotReserved, inStock, reserved)
+	}
+}
+
+func assertKind(t *testing.T, err error, want service.Kind) {
+	t.Helper()
+
+	if got := service.KindOf(err); got != want {
+		t.Errorf("got error %v of kind %d, want kind %d", err, got, want)
+	}
+}
+
+func TestPostgresDeleteRestrict(t *testing.T) {
+	s := newShop(t, "-deletion-users=restrict", "-deletion-cars=restrict", "-deletion-orders=restrict")
+	userID := s.addUser()
+	carID := s.addCar(vins[0])
+	stockedID := s.addCar(vins[1])
+	orderID := s.order(goapi.OrderInput{UserID: userID, CarID: carID})
+
+	assertKind(t, s.User.Delete(userID, 0), service.KindConflict)
+	assertKind(t, s.Car.Delete(carID, 0), service.KindConflict)
+	assertKind(t, s.Car.Delete(stockedID, 0), service.KindConflict)
+
+	s.pay(orderID, userID)
+	assertKind(t, s.Order.Delete(orderID), service.KindConflict)
+	if _, err := s.Order.GetByID(orderID); err != nil {
+		t.Errorf("order with a payment after deleting it: %v", err)
+	}
+
+	unorderedID := s.addCar()
+	if err := s.Car.Delete(unorderedID, 0); err != nil {
+		t.Errorf("deleting a car nobody ordered: %v", err)
+	}
+}
+
+func TestPostgresForceDeleteUser(t *testing.T) {
+	s := newShop(t)
+	userID := s.addUser()
+	otherID := s.addUser()
+	deletedCarID := s.addCar(vins[0])
+	cancelledCarID := s.addCar(vins[1])
+
+	// The orders of userID gave their vehicles back and otherID ordered
+	// them since.
+	deleted := s.order(goapi.OrderInput{UserID: userID, CarID: deletedCarID})
+	if err := s.Order.Delete(deleted); err != nil {
+		t.Fatal(err)
+	}
+	cancelled := s.order(goapi.OrderInput{UserID: userID, CarID: cancelledCarID})
+	s.setStatus(cancelled, userID, goapi.OrderCancelled)
+
+	s.order(goapi.OrderInput{UserID: otherID, CarID: deletedCarID})
+	s.order(goapi.OrderInput{UserID: otherID, CarID: cancelledCarID})
+
+	if err := s.User.ForceDelete(userID, 0); err != nil {
+		t.Fatal(err)
+	}
+	for _, orderID := range []int{deleted, cancelled} {
+		if _, err := s.Order.GetByIDWithDeleted(orderID); service.KindOf(err) != service.KindNotFound {
+			t.Errorf("order %d of the deleted user: got error %v, want not found", orderID, err)
+		}
+	}
+	s.assertStock(deletedCarID, 0, 1)
+	s.assertStock(cancelledCarID, 0, 1)
+
+	// A user whose orders have payments stays.
+	s.pay(s.order(goapi.OrderInput{UserID: otherID, CarID: s.addCar(vins[2])}), otherID)
+	assertKind(t, s.User.ForceDelete(otherID, 0), service.KindConflict)
+	if _, err := s.User.GetByID(otherID); err != nil {
+		t.Errorf("user with a payment after force deleting them: %v", err)
+	}
+}
+
+func TestPostgresForceDeleteCar(t *testing.T) {
+	s := newShop(t)
+	userID := s.addUser()
+	carID := s.addCar(vins[0])
+	otherCarID := s.addCar(vins[1])
+
+	// The order goes as a whole and gives back the vehicle of the other
+	// car.
+	mixed := s.order(goapi.OrderInput{UserID: userID, Items: []goapi.OrderItemInput{{CarID: carID}, {CarID: otherCarID}}})
+
+	if err := s.Car.ForceDelete(carID, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Car.GetByIDWithDeleted(carID); service.KindOf(err) != service.KindNotFound {
+		t.Errorf("deleted car: got error %v, want not found", err)
+	}
+	if _, err := s.Order.GetByIDWithDeleted(mixed); service.KindOf(err) != service.KindNotFound {
+		t.Errorf("order of the deleted car: got error %v, want not found", err)
+	}
+	s.assertStock(otherCarID, 1, 0)
+
+	paid := s.order(goapi.OrderInput{UserID: userID, CarID: otherCarID})
+	s.pay(paid, userID)
+	assertKind(t, s.Car.ForceDelete(otherCarID, 0), service.KindConflict)
+	if _, err := s.Order.GetByID(paid); err != nil {
+		t.Errorf("order with a payment after force deleting its car: %v", err)
+	}
+	s.assertStock(otherCarID, 0, 0)
+}
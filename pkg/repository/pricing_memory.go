@@ -0,0 +1,178 @@
+package repository
+
+import (
+	"cmp"
+	"slices"
+	"time"
+
+	goapi "github.com/Stremilov/car-shop"
+)
+
+type PricingMemory struct {
+	store *memoryStore
+}
+
+func (r *PricingMemory) CreateCarPrice(price goapi.CarPrice) (goapi.CarPrice, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if _, ok := r.store.cars[price.CarID]; !ok {
+		return goapi.CarPrice{}, ErrForeignKeyViolation
+	}
+
+	for _, p := range r.store.carPrices {
+		if p.CarID == price.CarID && p.EffectiveFrom.Equal(price.EffectiveFrom) {
+			return goapi.CarPrice{}, ErrDuplicate
+		}
+	}
+
+	r.store.lastCarPriceID++
+	price.PriceID = r.store.lastCarPriceID
+	price.CreatedAt = time.Now()
+	r.store.carPrices[price.PriceID] = price
+
+	return price, nil
+}
+
+func (r *PricingMemory) GetCarPrices(carID int) ([]goapi.CarPrice, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	var prices []goapi.CarPrice
+	for _, id := range sortedKeys(r.store.carPrices) {
+		if p := r.store.carPrices[id]; p.CarID == carID {
+			prices = append(prices, p)
+		}
+	}
+
+	slices.SortFunc(prices, func(a, b goapi.CarPrice) int { return a.EffectiveFrom.Compare(b.EffectiveFrom) })
+
+	return prices, nil
+}
+
+func (r *PricingMemory) GetCarPrice(carID int, at time.Time) (goapi.CarPrice, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	price, ok := r.store.carPrice(carID, at)
+	if !ok {
+		return goapi.CarPrice{}, ErrNotFound
+	}
+
+	return price, nil
+}
+
+// carPrice returns the price of carID in effect at t. The caller holds the
+// store lock.
+func (s *memoryStore) carPrice(carID int, at time.Time) (goapi.CarPrice, bool) {
+	var current goapi.CarPrice
+	found := false
+	for _, p := range s.carPrices {
+		if p.CarID != carID || p.EffectiveFrom.After(at) {
+			continue
+		}
+		if !found || p.EffectiveFrom.After(current.EffectiveFrom) {
+			current, found = p, true
+		}
+	}
+
+	return current, found
+}
+
+// withPrice fills in the current price of car like the cars queries do.
+// The caller holds the store lock.
+func (s *memoryStore) withPrice(car goapi.Car) goapi.Car {
+	car.Price = nil
+	if p, ok := s.carPrice(car.CarID, time.Now()); ok {
+		car.Price = &goapi.Money{Amount: p.Amount, Currency: p.Currency}
+	}
+
+	return car
+}
+
+func (r *PricingMemory) CreateDiscount(discount goapi.Discount) (goapi.Discount, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if discount.CarID != nil {
+		if _, ok := r.store.cars[*discount.CarID]; !ok {
+			return goapi.Discount{}, ErrForeignKeyViolation
+		}
+	}
+
+	for _, d := range r.store.discounts {
+		if discount.Code != "" && d.Code == discount.Code {
+			return goapi.Discount{}, ErrDuplicate
+		}
+	}
+
+	r.store.lastDiscountID++
+	discount.DiscountID = r.store.lastDiscountID
+	discount.Uses = 0
+	discount.CreatedAt = time.Now()
+	r.store.discounts[discount.DiscountID] = discount
+
+	return discount, nil
+}
+
+var discountSortFields = map[string]func(a, b goapi.Discount) int{
+	"code":       func(a, b goapi.Discount) int { return cmp.Compare(a.Code, b.Code) },
+	"valid_from": func(a, b goapi.Discount) int { return compareTimes(a.ValidFrom, b.ValidFrom) },
+	"valid_to":   func(a, b goapi.Discount) int { return compareTimes(a.ValidTo, b.ValidTo) },
+}
+
+// compareTimes orders missing times last, the way Postgres sorts NULLs in
+// ascending order.
+func compareTimes(a, b *time.Time) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return 1
+	case b == nil:
+		return -1
+	}
+
+	return a.Compare(*b)
+}
+
+func (r *PricingMemory) GetAllDiscounts(params goapi.ListParams) ([]goapi.Discount, int, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	var discounts []goapi.Discount
+	for _, id := range sortedKeys(r.store.discounts) {
+		discounts = append(discounts, r.store.discounts[id])
+	}
+
+	total := len(discounts)
+
+	return page(discounts, params, func(d goapi.Discount) int { return d.DiscountID }, discountSortFields), total, nil
+}
+
+func (r *PricingMemory) GetDiscountByCode(code string) (goapi.Discount, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	for _, d := range r.store.discounts {
+		if d.Code != "" && d.Code == code {
+			return d, nil
+		}
+	}
+
+	return goapi.Discount{}, ErrNotFound
+}
+
+func (r *PricingMemory) GetAutomaticDiscounts(at time.Time) ([]goapi.Discount, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	var discounts []goapi.Discount
+	for _, id := range sortedKeys(r.store.discounts) {
+		if d := r.store.discounts[id]; d.Code == "" && d.ValidAt(at) {
+			discounts = append(discounts, d)
+		}
+	}
+
+	return discounts, nil
+}
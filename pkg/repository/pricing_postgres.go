@@ -0,0 +1,119 @@
+package repository
+
+import (
+	"database/sql"
+	"time"
+
+	goapi "github.com/Stremilov/car-shop"
+)
+
+type PricingPostgres struct {
+	db *sql.DB
+}
+
+func NewPricingPostgres(db *sql.DB) *PricingPostgres {
+	return &PricingPostgres{db: db}
+}
+
+func (r *PricingPostgres) CreateCarPrice(price goapi.CarPrice) (goapi.CarPrice, error) {
+	query := `
+	INSERT INTO car_prices (car_id, amount, currency, effective_from)
+	VALUES ($1, $2, $3, $4)
+	RETURNING ` + carPriceColumns
+
+	created, err := scanCarPrice(r.db.QueryRow(query, price.CarID, price.Amount, price.Currency, price.EffectiveFrom))
+
+	return created, translateError(err)
+}
+
+func (r *PricingPostgres) GetCarPrices(carID int) ([]goapi.CarPrice, error) {
+	rows, err := r.db.Query(`
+	SELECT `+carPriceColumns+`
+	FROM car_prices
+	WHERE car_id = $1
+	ORDER BY effective_from`, carID)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanAll(rows, scanCarPrice)
+}
+
+func (r *PricingPostgres) GetCarPrice(carID int, at time.Time) (goapi.CarPrice, error) {
+	price, err := scanCarPrice(r.db.QueryRow(`
+	SELECT `+carPriceColumns+`
+	FROM car_prices
+	WHERE car_id = $1 AND effective_from <= $2
+	ORDER BY effective_from DESC
+	LIMIT 1`, carID, at))
+	if err == sql.ErrNoRows {
+		return price, ErrNotFound
+	}
+
+	return price, err
+}
+
+func (r *PricingPostgres) CreateDiscount(discount goapi.Discount) (goapi.Discount, error) {
+	query := `
+	INSERT INTO discounts (code, kind, value, currency, car_id, valid_from, valid_to, max_uses)
+	VALUES (NULLIF($1, ''), $2, $3, NULLIF($4, ''), $5, $6, $7, $8)
+	RETURNING ` + discountColumns
+
+	created, err := scanDiscount(r.db.QueryRow(query, discount.Code, discount.Kind, discount.Value,
+		discount.Currency, discount.CarID, discount.ValidFrom, discount.ValidTo, discount.MaxUses))
+
+	return created, translateError(err)
+}
+
+var discountSortColumns = map[string]string{
+	"id":         "id",
+	"code":       "code",
+	"valid_from": "valid_from",
+	"valid_to":   "valid_to",
+}
+
+func (r *PricingPostgres) GetAllDiscounts(params goapi.ListParams) ([]goapi.Discount, int, error) {
+	q := newSelect(discountColumns, "discounts")
+
+	var total int
+	countQuery, countArgs := q.count()
+	if err := r.db.QueryRow(countQuery, countArgs...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	q.page("id", discountSortColumns, params)
+	query, args := q.build()
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	discounts, err := scanAll(rows, scanDiscount)
+
+	return discounts, total, err
+}
+
+func (r *PricingPostgres) GetDiscountByCode(code string) (goapi.Discount, error) {
+	discount, err := scanDiscount(r.db.QueryRow("SELECT "+discountColumns+" FROM discounts WHERE code = $1", code))
+	if err == sql.ErrNoRows {
+		return discount, ErrNotFound
+	}
+
+	return discount, err
+}
+
+func (r *PricingPostgres) GetAutomaticDiscounts(at time.Time) ([]goapi.Discount, error) {
+	rows, err := r.db.Query(`
+	SELECT `+discountColumns+`
+	FROM discounts
+	WHERE code IS NULL
+		AND (valid_from IS NULL OR valid_from <= $1)
+		AND (valid_to IS NULL OR valid_to > $1)
+		AND (max_uses IS NULL OR uses < max_uses)
+	ORDER BY id`, at)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanAll(rows, scanDiscount)
+}
@@ -0,0 +1,180 @@
+package repository
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	goapi "github.com/Stremilov/car-shop"
+)
+
+// Statements that depend on the request are built with selectQuery and
+// updateQuery rather than by hand. Values only reach the SQL as $n
+// placeholders, numbered in the order the values are added, and columns
+// come from the code or from the whitelisted sort column maps, so nothing
+// a client sends ends up in the SQL text. Misuse is a bug in the caller and
+// panics.
+
+// columnName matches a column, optionally qualified with its table.
+var columnName = regexp.MustCompile(`^[a-z_][a-z0-9_]*(\.[a-z_][a-z0-9_]*)?$`)
+
+func column(name string) string {
+	if !columnName.MatchString(name) {
+		panic(fmt.Sprintf("query: %q is not a column name", name))
+	}
+
+	return name
+}
+
+// statement holds the values and WHERE conditions of a statement.
+type statement struct {
+	args  []interface{}
+	conds []string
+}
+
+// bind replaces every ? in expr with the placeholder of the next of args
+// and returns the result. expr must have one ? per value.
+func (s *statement) bind(expr string, args ...interface{}) string {
+	if n := strings.Count(expr, "?"); n != len(args) {
+		panic(fmt.Sprintf("query: %q has %d placeholders for %d values", expr, n, len(args)))
+	}
+
+	var b strings.Builder
+	for _, arg := range args {
+		before, after, _ := strings.Cut(expr, "?")
+		s.args = append(s.args, arg)
+		b.WriteString(before + "$" + strconv.Itoa(len(s.args)))
+		expr = after
+	}
+	b.WriteString(expr)
+
+	return b.String()
+}
+
+// where adds a condition with a ? for each of args. All conditions must
+// hold.
+func (s *statement) where(cond string, args ...interface{}) {
+	s.conds = append(s.conds, s.bind(cond, args...))
+}
+
+// whereDeleted adds the condition on the deleted_at column of table that
+// selects the records deleted says, if it takes one.
+func (s *statement) whereDeleted(table string, deleted goapi.Deleted) {
+	switch deleted {
+	case goapi.IncludeDeleted:
+	case goapi.OnlyDeleted:
+		s.where(column(table) + ".deleted_at IS NOT NULL")
+	default:
+		s.where(column(table) + ".deleted_at IS NULL")
+	}
+}
+
+func whereClause(conds []string) string {
+	if len(conds) == 0 {
+		return ""
+	}
+
+	return " WHERE " + strings.Join(conds, " AND ")
+}
+
+// selectQuery builds a SELECT of columns from from, which may include
+// joins.
+type selectQuery struct {
+	statement
+	columns string
+	from    string
+	orderBy string
+	limit   string
+}
+
+func newSelect(columns, from string) *selectQuery {
+	return &selectQuery{columns: columns, from: from}
+}
+
+// count returns the statement that counts the rows matching the conditions
+// so far, for the total of a list. It has to come before page.
+func (q *selectQuery) count() (string, []interface{}) {
+	return "SELECT COUNT(*) FROM " + q.from + whereClause(q.conds), slices.Clone(q.args)
+}
+
+// page limits the rows to one page of a list. They are sorted by the sort
+// field of params, mapped to a column by sortColumns, and then by
+// idColumn; a sort field missing from sortColumns sorts by idColumn only.
+// With a cursor only the rows after it on idColumn are selected.
+func (q *selectQuery) page(idColumn string, sortColumns map[string]string, params goapi.ListParams) {
+	idColumn = column(idColumn)
+
+	direction := "ASC"
+	if params.Desc {
+		direction = "DESC"
+	}
+
+	if params.Cursor > 0 {
+		op := " > ?"
+		if params.Desc {
+			op = " < ?"
+		}
+		q.where(idColumn+op, params.Cursor)
+	}
+
+	q.orderBy = idColumn + " " + direction
+	if sortColumn, ok := sortColumns[params.Sort]; ok && sortColumn != idColumn {
+		q.orderBy = column(sortColumn) + " " + direction + ", " + q.orderBy
+	}
+
+	q.limit = q.bind(" LIMIT ?", params.Limit)
+	if params.Offset > 0 {
+		q.limit += q.bind(" OFFSET ?", params.Offset)
+	}
+}
+
+func (q *selectQuery) build() (string, []interface{}) {
+	query := "SELECT " + q.columns + " FROM " + q.from + whereClause(q.conds)
+	if q.orderBy != "" {
+		query += " ORDER BY " + q.orderBy
+	}
+
+	return query + q.limit, q.args
+}
+
+// updateQuery builds an UPDATE of table.
+type updateQuery struct {
+	statement
+	table     string
+	sets      []string
+	returning string
+}
+
+func newUpdate(table string) *updateQuery {
+	return &updateQuery{table: column(table)}
+}
+
+// set sets col to value.
+func (q *updateQuery) set(col string, value interface{}) {
+	q.setExpr(col, "?", value)
+}
+
+// setExpr sets col to expr, which has a ? for each of args.
+func (q *updateQuery) setExpr(col, expr string, args ...interface{}) {
+	q.sets = append(q.sets, column(col)+" = "+q.bind(expr, args...))
+}
+
+// returnColumns makes the statement return columns of the updated rows.
+func (q *updateQuery) returnColumns(columns string) {
+	q.returning = columns
+}
+
+func (q *updateQuery) build() (string, []interface{}) {
+	if len(q.sets) == 0 {
+		panic("query: UPDATE of " + q.table + " sets nothing")
+	}
+
+	query := "UPDATE " + q.table + " SET " + strings.Join(q.sets, ", ") + whereClause(q.conds)
+	if q.returning != "" {
+		query += " RETURNING " + q.returning
+	}
+
+	return query, q.args
+}
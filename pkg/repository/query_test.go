@@ -0,0 +1,276 @@
+package repository
+
+import (
+	"math/rand"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/quick"
+
+	goapi "github.com/Stremilov/car-shop"
+)
+
+// Every value the random statements below bind is the string vN, unique
+// within the statement, and every ? they bind it to follows "vN = ", so
+// the placeholder each value got can be read back from the SQL.
+
+var (
+	placeholder = regexp.MustCompile(`\$(\d+)`)
+	labeled     = regexp.MustCompile(`(v\d+) = \$(\d+)`)
+)
+
+// labels returns the expression that binds the next n values and the
+// values. Without values it is TRUE.
+func labels(next *int, n int) (string, []interface{}) {
+	if n == 0 {
+		return "TRUE", nil
+	}
+
+	conds := make([]string, n)
+	args := make([]interface{}, n)
+	for i := range conds {
+		label := "v" + strconv.Itoa(*next)
+		*next++
+		conds[i] = label + " = ?"
+		args[i] = label
+	}
+
+	return strings.Join(conds, " AND "), args
+}
+
+// checkPlaceholders checks that query uses each of $1 to $n once, n being
+// the number of args, and that labeled values went to their placeholders.
+func checkPlaceholders(t *testing.T, query string, args []interface{}) bool {
+	t.Helper()
+
+	uses := make(map[int]int)
+	for _, match := range placeholder.FindAllStringSubmatch(query, -1) {
+		n, _ := strconv.Atoi(match[1])
+		uses[n]++
+	}
+	for n := 1; n <= len(args); n++ {
+		if uses[n] != 1 {
+			t.Errorf("%s: $%d is used %d times, want once", query, n, uses[n])
+			return false
+		}
+	}
+	if len(uses) != len(args) {
+		t.Errorf("%s: %d placeholders for %d values", query, len(uses), len(args))
+		return false
+	}
+
+	for _, match := range labeled.FindAllStringSubmatch(query, -1) {
+		n, _ := strconv.Atoi(match[2])
+		if args[n-1] != match[1] {
+			t.Errorf("%s: $%d is %v, want %s", query, n, args[n-1], match[1])
+			return false
+		}
+	}
+
+	return true
+}
+
+// selectCase is a random list query: the number of values of each filter
+// condition and the page to select.
+type selectCase struct {
+	conds  []int
+	params goapi.ListParams
+}
+
+func (selectCase) Generate(r *rand.Rand, size int) reflect.Value {
+	c := selectCase{conds: make([]int, r.Intn(size+1))}
+	for i := range c.conds {
+		c.conds[i] = r.Intn(4)
+	}
+
+	sorts := []string{"", "id", "name", "year", "unknown", "name; DROP TABLE cars"}
+	c.params = goapi.ListParams{
+		Limit: 1 + r.Intn(100),
+		Sort:  sorts[r.Intn(len(sorts))],
+		Desc:  r.Intn(2) == 0,
+	}
+	if r.Intn(2) == 0 {
+		c.params.Cursor = r.Intn(1000)
+	}
+	if r.Intn(2) == 0 {
+		c.params.Offset = r.Intn(1000)
+	}
+
+	return reflect.ValueOf(c)
+}
+
+var testSortColumns = map[string]string{
+	"id":   "id",
+	"name": "cars.name",
+	"year": "year",
+}
+
+func TestSelectPlaceholders(t *testing.T) {
+	pageValue := func(query, clause string, args []interface{}) interface{} {
+		match := regexp.MustCompile(regexp.QuoteMeta(clause) + ` \$(\d+)`).FindStringSubmatch(query)
+		if match == nil {
+			return nil
+		}
+		n, _ := strconv.Atoi(match[1])
+		return args[n-1]
+	}
+
+	property := func(c selectCase) bool {
+		q := newSelect("id, name", "cars")
+		next := 0
+		for _, n := range c.conds {
+			cond, args := labels(&next, n)
+			q.where(cond, args...)
+		}
+
+		countQuery, countArgs := q.count()
+		if !checkPlaceholders(t, countQuery, countArgs) {
+			return false
+		}
+
+		q.page("id", testSortColumns, c.params)
+		query, args := q.build()
+		if !checkPlaceholders(t, query, args) {
+			return false
+		}
+		if !slices.Equal(args[:len(countArgs)], countArgs) {
+			t.Errorf("%s %v: the count has the values %v", query, args, countArgs)
+			return false
+		}
+
+		cursorClause := "id >"
+		if c.params.Desc {
+			cursorClause = "id <"
+		}
+
+		var want, got [3]interface{}
+		want[0] = c.params.Limit
+		got[0] = pageValue(query, "LIMIT", args)
+		if c.params.Offset > 0 {
+			want[1] = c.params.Offset
+		}
+		got[1] = pageValue(query, "OFFSET", args)
+		if c.params.Cursor > 0 {
+			want[2] = c.params.Cursor
+		}
+		got[2] = pageValue(query, cursorClause, args)
+		if want != got {
+			t.Errorf("%s %v: got limit, offset and cursor %v, want %v", query, args, got, want)
+			return false
+		}
+
+		return true
+	}
+
+	if err := quick.Check(property, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSelectOrder(t *testing.T) {
+	property := func(c selectCase) bool {
+		q := newSelect("id, name", "cars")
+		q.page("id", testSortColumns, c.params)
+		query, _ := q.build()
+
+		direction := " ASC"
+		if c.params.Desc {
+			direction = " DESC"
+		}
+		want := "ORDER BY id" + direction
+		if column, ok := testSortColumns[c.params.Sort]; ok && column != "id" {
+			want = "ORDER BY " + column + direction + ", id" + direction
+		}
+
+		if !strings.Contains(query, want+" LIMIT") {
+			t.Errorf("sort %q: got %s, want %s", c.params.Sort, query, want)
+			return false
+		}
+
+		return true
+	}
+
+	if err := quick.Check(property, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+// updateCase is a random UPDATE: each step is a set, an expression set or
+// a condition, with the number of values of the last two.
+type updateCase []updateStep
+
+type updateStep struct {
+	kind, values int
+}
+
+func (updateCase) Generate(r *rand.Rand, size int) reflect.Value {
+	c := make(updateCase, 1+r.Intn(size+1))
+	for i := range c {
+		c[i] = updateStep{kind: r.Intn(3), values: r.Intn(4)}
+	}
+
+	return reflect.ValueOf(c)
+}
+
+func TestUpdatePlaceholders(t *testing.T) {
+	property := func(c updateCase) bool {
+		q := newUpdate("cars")
+		q.setExpr("updated_at", "now()")
+		next := 0
+		for _, step := range c {
+			switch step.kind {
+			case 0:
+				_, args := labels(&next, 1)
+				q.set(args[0].(string), args[0])
+			case 1:
+				expr, args := labels(&next, step.values)
+				q.setExpr("name", expr, args...)
+			case 2:
+				cond, args := labels(&next, step.values)
+				q.where(cond, args...)
+			}
+		}
+		q.returnColumns("id")
+
+		query, args := q.build()
+		if len(args) != next {
+			t.Errorf("%s: got %d values, want %d", query, len(args), next)
+			return false
+		}
+
+		return checkPlaceholders(t, query, args)
+	}
+
+	if err := quick.Check(property, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestQueryMisuse(t *testing.T) {
+	tests := []struct {
+		name  string
+		build func()
+	}{
+		{"too few values", func() { newSelect("id", "cars").where("id = ? OR id = ?", 1) }},
+		{"too many values", func() { newSelect("id", "cars").where("id = ?", 1, 2) }},
+		{"column with SQL", func() { newUpdate("cars").set("name = 'x'; --", 1) }},
+		{"sort column with SQL", func() {
+			newSelect("id", "cars").page("id", map[string]string{"name": "name; DROP TABLE cars"}, goapi.ListParams{Sort: "name"})
+		}},
+		{"nothing to set", func() { newUpdate("cars").build() }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Error("got no panic")
+				}
+			}()
+			tt.build()
+		})
+	}
+}
@@ -1,13 +1,242 @@
 package repository
 
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	goapi "github.com/Stremilov/car-shop"
+)
+
+var (
+	ErrNotFound            = errors.New("record not found")
+	ErrForeignKeyViolation = errors.New("foreign key violation")
+	ErrDuplicate           = errors.New("duplicate record")
+	// ErrDiscountUsedUp means a discount has been used as often as it
+	// may be.
+	ErrDiscountUsedUp = errors.New("discount used up")
+	// ErrVersionMismatch means a write was made for a version of a
+	// record that is not its current version anymore.
+	ErrVersionMismatch = errors.New("version mismatch")
+)
+
+// OutOfStockError means no vehicle of CarID was in stock to reserve.
+type OutOfStockError struct {
+	CarID int
+}
+
+func (e *OutOfStockError) Error() string {
+	return fmt.Sprintf("car %d is out of stock", e.CarID)
+}
+
+type Authorization interface {
+	// CreateAccount stores a new user together with its credentials and
+	// returns the user ID.
+	CreateAccount(user goapi.User, email, passwordHash string) (int, error)
+	GetAccount(email string) (goapi.Account, error)
+	CreateRefreshToken(token goapi.RefreshToken) error
+	GetRefreshToken(tokenID string) (goapi.RefreshToken, error)
+	RevokeRefreshToken(tokenID string) error
+	RevokeUserRefreshTokens(userID int) error
+}
+
+// The writes of users and cars that take a version only apply to the record
+// at that version and fail with ErrVersionMismatch otherwise. Version 0
+// applies to any version. Every write bumps the version of the record.
+
 type User interface {
+	// Create stores user and returns it as stored, with its ID and
+	// timestamps.
+	Create(user goapi.User) (goapi.User, error)
+	// GetAll returns one page of the users matching filter and the number
+	// of matching users across all pages.
+	GetAll(filter goapi.UserFilter, params goapi.ListParams) ([]goapi.User, int, error)
+	// GetByID returns the user unless they are soft deleted.
+	GetByID(userID int) (goapi.User, error)
+	// GetDeleted returns the user only if they are soft deleted.
+	GetDeleted(userID int) (goapi.User, error)
+	// Update changes the user unless they are soft deleted and returns
+	// them as stored.
+	Update(userID int, input goapi.UserUpdate, version int) (goapi.User, error)
+	// Delete removes the user for good. It fails with
+	// ErrForeignKeyViolation if orders refer to the user.
+	Delete(userID int, version int) error
+	// SoftDelete hides the user from everything but the orders that refer
+	// to them and revokes their refresh tokens.
+	SoftDelete(userID int, version int) error
+	// DeleteCascade removes the user, soft deleted or not, together with
+	// their orders. It fails with ErrForeignKeyViolation if any of the
+	// orders has payments.
+	DeleteCascade(userID int, version int) error
+	// Restore brings back a soft deleted user. It fails with ErrNotFound
+	// if the user is not soft deleted.
+	Restore(userID int) error
+	// Purge removes the users soft deleted before t that no order refers
+	// to for good and returns how many it removed.
+	Purge(t time.Time) (int, error)
+}
+
+type Car interface {
+	Create(car goapi.Car) (goapi.Car, error)
+	GetAll(filter goapi.CarFilter, params goapi.ListParams) ([]goapi.Car, int, error)
+	// GetByID returns the car unless it is soft deleted.
+	GetByID(carID int) (goapi.Car, error)
+	// GetDeleted returns the car only if it is soft deleted.
+	GetDeleted(carID int) (goapi.Car, error)
+	// Update changes the car unless it is soft deleted and returns it as
+	// stored.
+	Update(carID int, input goapi.CarUpdate, version int) (goapi.Car, error)
+	// Delete removes the car with its prices and discounts for good. It
+	// fails with ErrForeignKeyViolation if orders or vehicles refer to it.
+	Delete(carID int, version int) error
+	// SoftDelete hides the car from everything but the orders that refer
+	// to it.
+	SoftDelete(carID int, version int) error
+	// DeleteCascade removes the car, soft deleted or not, together with
+	// its vehicles and the orders of it. Those orders go as a whole, with
+	// their lines of other cars and extras, and the vehicles of other cars
+	// they hold go back in stock. It fails with ErrForeignKeyViolation if
+	// any of the orders has payments.
+	DeleteCascade(carID int, version int) error
+	// Restore brings back a soft deleted car. It fails with ErrNotFound if
+	// the car is not soft deleted.
+	Restore(carID int) error
+	// Purge removes the cars soft deleted before t that no order refers to
+	// for good, with their vehicles, and returns how many it removed.
+	Purge(t time.Time) (int, error)
+}
+
+type Order interface {
+	// Create places a priced order. In one transaction with the order it
+	// reserves as many vehicles in stock as ordered of every car and
+	// counts a use of every discount applied. It fails with
+	// *OutOfStockError if there are not enough vehicles and with
+	// ErrDiscountUsedUp if a discount has no uses left.
+	Create(order goapi.PricedOrder) (goapi.Order, error)
+	GetAll(filter goapi.OrderFilter, params goapi.ListParams) ([]goapi.Order, int, error)
+	// GetByID returns the order unless it is soft deleted.
+	GetByID(orderID int) (goapi.Order, error)
+	// GetDeleted returns the order only if it is soft deleted.
+	GetDeleted(orderID int) (goapi.Order, error)
+	// GetByUserID returns the orders of a user that are not soft deleted.
+	GetByUserID(userID int) ([]goapi.Order, error)
+	// GetIDsByUserID and GetIDsByCarID return the IDs of the orders of a
+	// user and of the orders with a car, soft deleted ones included, in
+	// ascending order.
+	GetIDsByUserID(userID int) ([]int, error)
+	GetIDsByCarID(carID int) ([]int, error)
+	// SetStatus moves the order from change.From to change.To, sets the
+	// status of its vehicles, if vehicleStatus is not empty,
+	// and adds change to the history of the order, all in one transaction.
+	// It fails with ErrNotFound if the order is not in change.From
+	// (anymore).
+	SetStatus(change goapi.OrderStatusChange, vehicleStatus goapi.VehicleStatus) error
+	// GetHistory returns the status changes of the order, oldest first.
+	GetHistory(orderID int) ([]goapi.OrderStatusChange, error)
+	// Delete removes the order with its items and puts its reserved
+	// vehicles back in stock. It fails with ErrForeignKeyViolation if the
+	// order has payments.
+	Delete(orderID int) error
+	// SoftDelete hides the order and puts its reserved vehicles back in
+	// stock.
+	SoftDelete(orderID int) error
+	// Restore brings back a soft deleted order. If vehicleStatus is not
+	// empty, the vehicles of the order are taken out of stock again and
+	// put in vehicleStatus; it fails with *OutOfStockError if one of them
+	// is not in stock anymore. It fails with ErrNotFound if the order is
+	// not soft deleted.
+	Restore(orderID int, vehicleStatus goapi.VehicleStatus) error
+	// Purge removes the orders soft deleted before t that have no
+	// payments for good and returns how many it removed.
+	Purge(t time.Time) (int, error)
+}
+
+type Extra interface {
+	Create(extra goapi.Extra) (goapi.Extra, error)
+	GetAll(params goapi.ListParams) ([]goapi.Extra, int, error)
+	GetByID(extraID int) (goapi.Extra, error)
+}
+
+type Pricing interface {
+	// CreateCarPrice adds a price to the schedule of a car. It fails with
+	// ErrDuplicate if another price of the car takes effect at the same
+	// time.
+	CreateCarPrice(price goapi.CarPrice) (goapi.CarPrice, error)
+	// GetCarPrices returns the whole price schedule of a car, past and
+	// future prices included, by the time they take effect.
+	GetCarPrices(carID int) ([]goapi.CarPrice, error)
+	// GetCarPrice returns the price of a car in effect at t.
+	GetCarPrice(carID int, at time.Time) (goapi.CarPrice, error)
+	CreateDiscount(discount goapi.Discount) (goapi.Discount, error)
+	GetAllDiscounts(params goapi.ListParams) ([]goapi.Discount, int, error)
+	GetDiscountByCode(code string) (goapi.Discount, error)
+	// GetAutomaticDiscounts returns the discounts without a code that may
+	// be used at t.
+	GetAutomaticDiscounts(at time.Time) ([]goapi.Discount, error)
+}
+
+type Payment interface {
+	// Create stores a new payment attempt. It fails with ErrDuplicate if
+	// the order already has an attempt with the same idempotency key or
+	// one that has not failed.
+	Create(payment goapi.Payment) (goapi.Payment, error)
+	GetByID(paymentID int) (goapi.Payment, error)
+	GetByKey(orderID int, idempotencyKey string) (goapi.Payment, error)
+	GetByRef(provider, ref string) (goapi.Payment, error)
+	// GetByOrderID returns the payment attempts of an order, oldest first.
+	GetByOrderID(orderID int) ([]goapi.Payment, error)
+	// Update stores the status, provider reference and failure reason of
+	// payment if it is still in status from. It fails with ErrNotFound
+	// otherwise.
+	Update(payment goapi.Payment, from goapi.PaymentStatus) error
+}
 
+type Idempotency interface {
+	// Create stores a request that has not been answered yet and returns
+	// it with true. If the user already made a request with the same key
+	// that has not expired, it returns that one with false instead.
+	Create(request goapi.IdempotentRequest) (goapi.IdempotentRequest, bool, error)
+	// Complete stores the response to request.
+	Complete(request goapi.IdempotentRequest) error
+	// Delete forgets a request, so that its key can be used again.
+	Delete(userID int, key string) error
+}
+
+type Inventory interface {
+	Create(vehicle goapi.Vehicle) (goapi.Vehicle, error)
+	GetAll(filter goapi.VehicleFilter, params goapi.ListParams) ([]goapi.Vehicle, int, error)
+	GetByID(vehicleID int) (goapi.Vehicle, error)
+	// SetStatus moves the vehicle from one status to another. It fails
+	// with ErrNotFound if the vehicle is not in status from (anymore).
+	SetStatus(vehicleID int, from, to goapi.VehicleStatus) error
+	// GetStock counts the vehicles of every car model, or of carID only
+	// if it is given.
+	GetStock(carID *int) ([]goapi.Stock, error)
 }
 
 type Repository struct {
+	Authorization
 	User
+	Car
+	Order
+	Extra
+	Pricing
+	Payment
+	Idempotency
+	Inventory
 }
 
-func NewRepository() *Repository{
-	return &Repository{}
-}
\ No newline at end of file
+func NewRepository(db *sql.DB) *Repository {
+	return &Repository{
+		Authorization: NewAuthPostgres(db),
+		User:          NewUserPostgres(db),
+		Car:           NewCarPostgres(db),
+		Order:         NewOrderPostgres(db),
+		Extra:         NewExtraPostgres(db),
+		Pricing:       NewPricingPostgres(db),
+		Payment:       NewPaymentPostgres(db),
+		Idempotency:   NewIdempotencyPostgres(db),
+		Inventory:     NewInventoryPostgres(db),
+	}
+}
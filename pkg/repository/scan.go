@@ -0,0 +1,222 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	goapi "github.com/Stremilov/car-shop"
+)
+
+// Column lists of the entities, in the order the scan functions below read
+// them. Queries select or return exactly these, so that adding a field
+// means touching one list and one function.
+const (
+	userColumns = `people.id, people.first_name, people.last_name, people.age, people.role,
+	people.created_at, people.updated_at, people.deleted_at, people.version`
+	carColumns = `cars.id, cars.name, cars.power_watts, cars.type, cars.year, (` + currentCarPrice + `),
+	cars.created_at, cars.updated_at, cars.deleted_at, cars.version`
+	orderColumns = `orders.id, orders.order_date, orders.status, orders.updated_at, ` + userColumns + `,
+	COALESCE(orders.currency, ''), orders.discount, COALESCE(orders.promo_code, ''), orders.deleted_at`
+	orderItemColumns = `order_items.order_id, COALESCE(order_items.car_id, 0), order_items.id, order_items.kind,
+	COALESCE(vehicles.vin, ''), COALESCE(order_items.extra_id, 0), order_items.name, order_items.list_price,
+	order_items.unit_price, order_items.quantity`
+	extraColumns = `extras.id, extras.name, extras.price, extras.currency, extras.created_at,
+	extras.updated_at`
+	carPriceColumns = `car_prices.id, car_prices.car_id, car_prices.amount, car_prices.currency,
+	car_prices.effective_from, car_prices.created_at`
+	discountColumns = `discounts.id, COALESCE(discounts.code, ''), discounts.kind, discounts.value,
+	COALESCE(discounts.currency, ''), discounts.car_id, discounts.valid_from, discounts.valid_to,
+	discounts.max_uses, discounts.uses, discounts.created_at`
+	paymentColumns = `payments.id, payments.order_id, payments.provider, COALESCE(payments.provider_ref, ''),
+	payments.amount, payments.currency, payments.status, payments.failure_reason, payments.idempotency_key,
+	payments.created_at, payments.updated_at`
+	idempotentRequestColumns = `user_id, key, fingerprint, status, content_type, location, body, expires_at`
+	vehicleColumns           = `vehicles.id, vehicles.car_id, vehicles.vin, vehicles.status,
+	vehicles.created_at, vehicles.updated_at`
+)
+
+// currentCarPrice is the list price of a car in effect now as a JSON
+// object, or NULL if it has none.
+const currentCarPrice = `
+	SELECT json_build_object('amount', car_prices.amount, 'currency', car_prices.currency)
+	FROM car_prices
+	WHERE car_prices.car_id = cars.id AND car_prices.effective_from <= now()
+	ORDER BY car_prices.effective_from DESC
+	LIMIT 1`
+
+// orderJoins joins an order with its user. The items are read separately.
+const orderJoins = `
+	JOIN people ON orders.user_id = people.id`
+
+// row is what *sql.Row and *sql.Rows have in common.
+type row interface {
+	Scan(dest ...interface{}) error
+}
+
+func userDest(u *goapi.User) []interface{} {
+	return []interface{}{&u.UserID, &u.FirstName, &u.LastName, &u.Age, &u.Role, &u.CreatedAt, &u.UpdatedAt, &u.DeletedAt,
+		&u.Version}
+}
+
+func carDest(c *goapi.Car) []interface{} {
+	return []interface{}{&c.CarID, &c.Name, powerDest{&c.Power}, &c.Type, &c.Year, moneyDest{&c.Price},
+		&c.CreatedAt, &c.UpdatedAt, &c.DeletedAt, &c.Version}
+}
+
+func orderDest(o *goapi.Order) []interface{} {
+	dest := []interface{}{&o.OrderID, &o.OrderDate, &o.Status, &o.UpdatedAt}
+	dest = append(dest, userDest(&o.User)...)
+	return append(dest, &o.Currency, &o.Discount, &o.PromoCode, &o.DeletedAt)
+}
+
+// orderItemRow is an order item together with the keys needed to put it
+// into its order and fill in its car.
+type orderItemRow struct {
+	orderID int
+	carID   int
+	item    goapi.OrderItem
+}
+
+func orderItemDest(i *orderItemRow) []interface{} {
+	return []interface{}{&i.orderID, &i.carID, &i.item.ItemID, &i.item.Kind, &i.item.VIN, &i.item.ExtraID,
+		&i.item.Name, &i.item.ListPrice, &i.item.UnitPrice, &i.item.Quantity}
+}
+
+func extraDest(e *goapi.Extra) []interface{} {
+	return []interface{}{&e.ExtraID, &e.Name, &e.Price, &e.Currency, &e.CreatedAt, &e.UpdatedAt}
+}
+
+func carPriceDest(p *goapi.CarPrice) []interface{} {
+	return []interface{}{&p.PriceID, &p.CarID, &p.Amount, &p.Currency, &p.EffectiveFrom, &p.CreatedAt}
+}
+
+func discountDest(d *goapi.Discount) []interface{} {
+	return []interface{}{&d.DiscountID, &d.Code, &d.Kind, &d.Value, &d.Currency, &d.CarID, &d.ValidFrom,
+		&d.ValidTo, &d.MaxUses, &d.Uses, &d.CreatedAt}
+}
+
+func paymentDest(p *goapi.Payment) []interface{} {
+	return []interface{}{&p.PaymentID, &p.OrderID, &p.Provider, &p.ProviderRef, &p.Amount, &p.Currency, &p.Status,
+		&p.FailureReason, &p.IdempotencyKey, &p.CreatedAt, &p.UpdatedAt}
+}
+
+func scanIdempotentRequest(r row) (goapi.IdempotentRequest, error) {
+	var q goapi.IdempotentRequest
+	return q, r.Scan(&q.UserID, &q.Key, &q.Fingerprint, &q.Status, &q.ContentType, &q.Location, &q.Body, &q.ExpiresAt)
+}
+
+func vehicleDest(v *goapi.Vehicle) []interface{} {
+	return []interface{}{&v.VehicleID, &v.CarID, &v.VIN, &v.Status, &v.CreatedAt, &v.UpdatedAt}
+}
+
+func scanUser(r row) (goapi.User, error) {
+	var u goapi.User
+	return u, r.Scan(userDest(&u)...)
+}
+
+func scanCar(r row) (goapi.Car, error) {
+	var c goapi.Car
+	return c, r.Scan(carDest(&c)...)
+}
+
+func scanOrder(r row) (goapi.Order, error) {
+	var o goapi.Order
+	return o, r.Scan(orderDest(&o)...)
+}
+
+func scanOrderItem(r row) (orderItemRow, error) {
+	var i orderItemRow
+	return i, r.Scan(orderItemDest(&i)...)
+}
+
+func scanExtra(r row) (goapi.Extra, error) {
+	var e goapi.Extra
+	return e, r.Scan(extraDest(&e)...)
+}
+
+func scanCarPrice(r row) (goapi.CarPrice, error) {
+	var p goapi.CarPrice
+	return p, r.Scan(carPriceDest(&p)...)
+}
+
+func scanDiscount(r row) (goapi.Discount, error) {
+	var d goapi.Discount
+	return d, r.Scan(discountDest(&d)...)
+}
+
+func scanPayment(r row) (goapi.Payment, error) {
+	var p goapi.Payment
+	return p, r.Scan(paymentDest(&p)...)
+}
+
+func scanVehicle(r row) (goapi.Vehicle, error) {
+	var v goapi.Vehicle
+	return v, r.Scan(vehicleDest(&v)...)
+}
+
+// scanAll reads every row with scan and closes rows.
+func scanAll[T any](rows *sql.Rows, scan func(row) (T, error)) ([]T, error) {
+	defer rows.Close()
+
+	var items []T
+	for rows.Next() {
+		item, err := scan(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+
+	return items, rows.Err()
+}
+
+// powerDest scans the power_watts column into a Power.
+type powerDest struct {
+	power *goapi.Power
+}
+
+func (d powerDest) Scan(src interface{}) error {
+	if src == nil {
+		*d.power = goapi.Power{}
+		return nil
+	}
+
+	watts, ok := src.(int64)
+	if !ok {
+		return fmt.Errorf("power_watts: unexpected %T", src)
+	}
+
+	*d.power = goapi.PowerFromWatts(watts)
+	return nil
+}
+
+// moneyDest scans a JSON object with an amount and a currency into a
+// *Money, leaving it nil for NULL.
+type moneyDest struct {
+	money **goapi.Money
+}
+
+func (d moneyDest) Scan(src interface{}) error {
+	*d.money = nil
+
+	var data []byte
+	switch src := src.(type) {
+	case nil:
+		return nil
+	case []byte:
+		data = src
+	case string:
+		data = []byte(src)
+	default:
+		return fmt.Errorf("money: unexpected %T", src)
+	}
+
+	var m goapi.Money
+	if err := json.Unmarshal(data, &m); err != nil {
+		return fmt.Errorf("money: %w", err)
+	}
+
+	*d.money = &m
+	return nil
+}
@@ -0,0 +1,247 @@
+package repository
+
+import (
+	"cmp"
+	"time"
+
+	goapi "github.com/Stremilov/car-shop"
+)
+
+type UserMemory struct {
+	store *memoryStore
+}
+
+func (r *UserMemory) Create(user goapi.User) (goapi.User, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	r.store.lastUserID++
+	user.UserID = r.store.lastUserID
+	user.CreatedAt = time.Now()
+	user.UpdatedAt = user.CreatedAt
+	user.Version = 1
+	r.store.users[user.UserID] = user
+
+	return user, nil
+}
+
+var userSortFields = map[string]func(a, b goapi.User) int{
+	"first_name": func(a, b goapi.User) int { return cmp.Compare(a.FirstName, b.FirstName) },
+	"last_name":  func(a, b goapi.User) int { return cmp.Compare(a.LastName, b.LastName) },
+	"age":        func(a, b goapi.User) int { return cmp.Compare(a.Age, b.Age) },
+	"role":       func(a, b goapi.User) int { return cmp.Compare(a.Role, b.Role) },
+}
+
+func (r *UserMemory) GetAll(filter goapi.UserFilter, params goapi.ListParams) ([]goapi.User, int, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	var people []goapi.User
+	for _, id := range sortedKeys(r.store.users) {
+		p := r.store.users[id]
+		if !visible(p.DeletedAt, filter.Deleted) {
+			continue
+		}
+		if filter.AgeMin != nil && p.Age < *filter.AgeMin {
+			continue
+		}
+		if filter.AgeMax != nil && p.Age > *filter.AgeMax {
+			continue
+		}
+		if filter.Role != "" && p.Role != filter.Role {
+			continue
+		}
+		people = append(people, p)
+	}
+
+	total := len(people)
+
+	return page(people, params, func(u goapi.User) int { return u.UserID }, userSortFields), total, nil
+}
+
+func (r *UserMemory) GetByID(userID int) (goapi.User, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	user, ok := r.store.users[userID]
+	if !ok || user.DeletedAt != nil {
+		return goapi.User{}, ErrNotFound
+	}
+
+	return user, nil
+}
+
+func (r *UserMemory) GetDeleted(userID int) (goapi.User, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	user, ok := r.store.users[userID]
+	if !ok || user.DeletedAt == nil {
+		return goapi.User{}, ErrNotFound
+	}
+
+	return user, nil
+}
+
+func (r *UserMemory) Update(userID int, input goapi.UserUpdate, version int) (goapi.User, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	user, ok := r.store.users[userID]
+	if !ok || user.DeletedAt != nil {
+		return goapi.User{}, ErrNotFound
+	}
+	if err := checkVersion(user.Version, version); err != nil {
+		return goapi.User{}, err
+	}
+
+	if input.FirstName != nil {
+		user.FirstName = *input.FirstName
+	}
+
+	if input.LastName != nil {
+		user.LastName = *input.LastName
+	}
+
+	if input.Age != nil {
+		user.Age = *input.Age
+	}
+
+	if input.Role != nil {
+		user.Role = *input.Role
+	}
+
+	user.UpdatedAt = time.Now()
+	user.Version++
+	r.store.users[userID] = user
+
+	return user, nil
+}
+
+func (r *UserMemory) Delete(userID int, version int) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	user, ok := r.store.users[userID]
+	if !ok || user.DeletedAt != nil {
+		return ErrNotFound
+	}
+	if err := checkVersion(user.Version, version); err != nil {
+		return err
+	}
+
+	for _, o := range r.store.orders {
+		if o.userID == userID {
+			return ErrForeignKeyViolation
+		}
+	}
+
+	r.store.deleteUser(userID)
+
+	return nil
+}
+
+func (r *UserMemory) SoftDelete(userID int, version int) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	user, ok := r.store.users[userID]
+	if !ok || user.DeletedAt != nil {
+		return ErrNotFound
+	}
+	if err := checkVersion(user.Version, version); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	user.DeletedAt = &now
+	user.Version++
+	r.store.users[userID] = user
+
+	for id, token := range r.store.refreshTokens {
+		if token.UserID == userID && token.RevokedAt == nil {
+			token.RevokedAt = &now
+			r.store.refreshTokens[id] = token
+		}
+	}
+
+	return nil
+}
+
+func (r *UserMemory) DeleteCascade(userID int, version int) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	user, ok := r.store.users[userID]
+	if !ok {
+		return ErrNotFound
+	}
+	if err := checkVersion(user.Version, version); err != nil {
+		return err
+	}
+
+	orderIDs := r.store.orderIDs(func(o memoryOrder) bool { return o.userID == userID })
+	if err := r.store.deleteOrders(orderIDs); err != nil {
+		return err
+	}
+
+	r.store.deleteUser(userID)
+
+	return nil
+}
+
+func (r *UserMemory) Restore(userID int) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	user, ok := r.store.users[userID]
+	if !ok || user.DeletedAt == nil {
+		return ErrNotFound
+	}
+
+	user.DeletedAt = nil
+	user.UpdatedAt = time.Now()
+	user.Version++
+	r.store.users[userID] = user
+
+	return nil
+}
+
+func (r *UserMemory) Purge(t time.Time) (int, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	purged := 0
+	for id, user := range r.store.users {
+		if !dueForPurge(user.DeletedAt, t) || len(r.store.orderIDs(func(o memoryOrder) bool { return o.userID == id })) > 0 {
+			continue
+		}
+
+		r.store.deleteUser(id)
+		purged++
+	}
+
+	return purged, nil
+}
+
+// deleteUser removes the user with everything that goes with them. The
+// caller holds the lock.
+func (s *memoryStore) deleteUser(userID int) {
+	delete(s.users, userID)
+	delete(s.accounts, userID)
+	for id, token := range s.refreshTokens {
+		if token.UserID == userID {
+			delete(s.refreshTokens, id)
+		}
+	}
+	for key := range s.requests {
+		if key.userID == userID {
+			delete(s.requests, key)
+		}
+	}
+	for i, change := range s.orderHistory {
+		if change.ChangedBy == userID {
+			s.orderHistory[i].ChangedBy = 0
+		}
+	}
+}
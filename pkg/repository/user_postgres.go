@@ -0,0 +1,231 @@
+package repository
+
+import (
+	"database/sql"
+	"time"
+
+	goapi "github.com/Stremilov/car-shop"
+)
+
+type UserPostgres struct {
+	db *sql.DB
+}
+
+func NewUserPostgres(db *sql.DB) *UserPostgres {
+	return &UserPostgres{db: db}
+}
+
+func (r *UserPostgres) Create(user goapi.User) (goapi.User, error) {
+	query := `
+	INSERT INTO people (first_name, last_name, age, role)
+	VALUES ($1, $2, $3, $4)
+	RETURNING ` + userColumns
+
+	return scanUser(r.db.QueryRow(query, user.FirstName, user.LastName, user.Age, user.Role))
+}
+
+var userSortColumns = map[string]string{
+	"id":         "id",
+	"first_name": "first_name",
+	"last_name":  "last_name",
+	"age":        "age",
+	"role":       "role",
+}
+
+func (r *UserPostgres) GetAll(filter goapi.UserFilter, params goapi.ListParams) ([]goapi.User, int, error) {
+	q := newSelect(userColumns, "people")
+	q.whereDeleted("people", filter.Deleted)
+
+	if filter.AgeMin != nil {
+		q.where("age >= ?", *filter.AgeMin)
+	}
+
+	if filter.AgeMax != nil {
+		q.where("age <= ?", *filter.AgeMax)
+	}
+
+	if filter.Role != "" {
+		q.where("role = ?", filter.Role)
+	}
+
+	var total int
+	countQuery, countArgs := q.count()
+	if err := r.db.QueryRow(countQuery, countArgs...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	q.page("id", userSortColumns, params)
+	query, args := q.build()
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	people, err := scanAll(rows, scanUser)
+
+	return people, total, err
+}
+
+func (r *UserPostgres) GetByID(userID int) (goapi.User, error) {
+	user, err := scanUser(r.db.QueryRow("SELECT "+userColumns+" FROM people WHERE people.id = $1 AND people.deleted_at IS NULL", userID))
+	if err == sql.ErrNoRows {
+		return user, ErrNotFound
+	}
+
+	return user, err
+}
+
+func (r *UserPostgres) GetDeleted(userID int) (goapi.User, error) {
+	user, err := scanUser(r.db.QueryRow("SELECT "+userColumns+" FROM people WHERE people.id = $1 AND people.deleted_at IS NOT NULL", userID))
+	if err == sql.ErrNoRows {
+		return user, ErrNotFound
+	}
+
+	return user, err
+}
+
+// liveUserVersion selects the version of a user who is not soft deleted.
+const liveUserVersion = `SELECT version FROM people WHERE id = $1 AND deleted_at IS NULL`
+
+func (r *UserPostgres) Update(userID int, input goapi.UserUpdate, version int) (goapi.User, error) {
+	q := newUpdate("people")
+
+	if input.FirstName != nil {
+		q.set("first_name", *input.FirstName)
+	}
+
+	if input.LastName != nil {
+		q.set("last_name", *input.LastName)
+	}
+
+	if input.Age != nil {
+		q.set("age", *input.Age)
+	}
+
+	if input.Role != nil {
+		q.set("role", *input.Role)
+	}
+
+	q.setExpr("updated_at", "now()")
+	q.setExpr("version", "version + 1")
+	q.where("id = ?", userID)
+	q.returnColumns(userColumns)
+	query, args := q.build()
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return goapi.User{}, err
+	}
+	defer tx.Rollback()
+
+	if err := lockVersion(tx, version, liveUserVersion, userID); err != nil {
+		return goapi.User{}, err
+	}
+
+	user, err := scanUser(tx.QueryRow(query, args...))
+	if err != nil {
+		return goapi.User{}, err
+	}
+
+	return user, tx.Commit()
+}
+
+func (r *UserPostgres) Delete(userID int, version int) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := lockVersion(tx, version, liveUserVersion, userID); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM people WHERE id = $1`, userID); err != nil {
+		return translateError(err)
+	}
+
+	return tx.Commit()
+}
+
+func (r *UserPostgres) SoftDelete(userID int, version int) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := lockVersion(tx, version, liveUserVersion, userID); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`UPDATE people SET deleted_at = now(), version = version + 1 WHERE id = $1`, userID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`UPDATE refresh_tokens SET revoked_at = now() WHERE user_id = $1 AND revoked_at IS NULL`, userID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *UserPostgres) DeleteCascade(userID int, version int) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := lockVersion(tx, version, `SELECT version FROM people WHERE id = $1`, userID); err != nil {
+		return err
+	}
+
+	if err := deleteOrders(tx, `SELECT id FROM orders WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM people WHERE id = $1`, userID); err != nil {
+		return translateError(err)
+	}
+
+	return tx.Commit()
+}
+
+func (r *UserPostgres) Restore(userID int) error {
+	result, err := r.db.Exec(`UPDATE people SET deleted_at = NULL, updated_at = now(), version = version + 1 WHERE id = $1 AND deleted_at IS NOT NULL`, userID)
+	if err != nil {
+		return err
+	}
+
+	return checkRowsAffected(result)
+}
+
+func (r *UserPostgres) Purge(t time.Time) (int, error) {
+	result, err := r.db.Exec(`
+	DELETE FROM people
+	WHERE deleted_at < $1
+		AND NOT EXISTS (SELECT 1 FROM orders WHERE orders.user_id = people.id)`, t)
+	if err != nil {
+		return 0, translateError(err)
+	}
+
+	n, err := result.RowsAffected()
+
+	return int(n), err
+}
+
+func checkRowsAffected(result sql.Result) error {
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
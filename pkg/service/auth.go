@@ -0,0 +1,318 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+
+	goapi "github.com/Stremilov/car-shop"
+	"github.com/Stremilov/car-shop/pkg/config"
+	"github.com/Stremilov/car-shop/pkg/repository"
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	tokenTypeAccess  = "access"
+	tokenTypeRefresh = "refresh"
+
+	minPasswordLength = 8
+	// bcrypt ignores everything after the first 72 bytes.
+	maxPasswordLength = 72
+)
+
+// dummyHash is compared against when the email is unknown, so that sign-in
+// takes the same time whether or not the account exists.
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("dummy password"), bcrypt.DefaultCost)
+
+type tokenClaims struct {
+	jwt.RegisteredClaims
+	Type string     `json:"typ"`
+	Role goapi.Role `json:"role,omitempty"`
+}
+
+type AuthService struct {
+	repo     repository.Authorization
+	userRepo repository.User
+	cfg      config.Auth
+}
+
+func NewAuthService(repo repository.Authorization, userRepo repository.User, cfg config.Auth) *AuthService {
+	return &AuthService{repo: repo, userRepo: userRepo, cfg: cfg}
+}
+
+func (s *AuthService) SignUp(input goapi.SignUpInput) (int, error) {
+	if err := validateName("first_name", input.FirstName); err != nil {
+		return 0, err
+	}
+
+	if err := validateName("last_name", input.LastName); err != nil {
+		return 0, err
+	}
+
+	if err := validateAge(input.Age); err != nil {
+		return 0, err
+	}
+
+	email, err := normalizeEmail(input.Email)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(input.Password) < minPasswordLength || len(input.Password) > maxPasswordLength {
+		return 0, invalidField("password", "password must be between %d and %d bytes long", minPasswordLength, maxPasswordLength)
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return 0, err
+	}
+
+	user := goapi.User{FirstName: input.FirstName, LastName: input.LastName, Age: input.Age, Role: goapi.RoleCustomer}
+	id, err := s.repo.CreateAccount(user, email, string(hash))
+	if errors.Is(err, repository.ErrDuplicate) {
+		return 0, conflict("email %s is already registered", email)
+	}
+
+	return id, err
+}
+
+func (s *AuthService) SignIn(input goapi.SignInInput) (goapi.Tokens, error) {
+	email, err := normalizeEmail(input.Email)
+	if err != nil {
+		return goapi.Tokens{}, err
+	}
+
+	account, err := s.repo.GetAccount(email)
+	if errors.Is(err, repository.ErrNotFound) {
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(input.Password))
+		return goapi.Tokens{}, unauthorized("invalid email or password")
+	}
+	if err != nil {
+		return goapi.Tokens{}, err
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(account.PasswordHash), []byte(input.Password)); err != nil {
+		return goapi.Tokens{}, unauthorized("invalid email or password")
+	}
+
+	return s.issueTokens(goapi.Identity{UserID: account.UserID, Role: account.Role})
+}
+
+// Refresh exchanges a refresh token for a new token pair and revokes it.
+// Presenting a token that was already revoked is taken as a sign that it
+// leaked, and every refresh token of that user is revoked.
+func (s *AuthService) Refresh(refreshToken string) (goapi.Tokens, error) {
+	claims, err := s.parseToken(refreshToken, tokenTypeRefresh)
+	if err != nil {
+		return goapi.Tokens{}, err
+	}
+
+	stored, err := s.repo.GetRefreshToken(claims.ID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return goapi.Tokens{}, unauthorized("invalid refresh token")
+	}
+	if err != nil {
+		return goapi.Tokens{}, err
+	}
+
+	if stored.RevokedAt != nil {
+		if err := s.repo.RevokeUserRefreshTokens(stored.UserID); err != nil {
+			return goapi.Tokens{}, err
+		}
+		return goapi.Tokens{}, unauthorized("refresh token has been revoked")
+	}
+
+	if time.Now().After(stored.ExpiresAt) {
+		return goapi.Tokens{}, unauthorized("refresh token has expired")
+	}
+
+	if err := s.repo.RevokeRefreshToken(stored.ID); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return goapi.Tokens{}, unauthorized("refresh token has been revoked")
+		}
+		return goapi.Tokens{}, err
+	}
+
+	// The role is read again so that the new tokens carry role changes.
+	user, err := s.userRepo.GetByID(stored.UserID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return goapi.Tokens{}, unauthorized("user no longer exists")
+	}
+	if err != nil {
+		return goapi.Tokens{}, err
+	}
+
+	return s.issueTokens(goapi.Identity{UserID: stored.UserID, Role: user.Role})
+}
+
+// Revoke invalidates a refresh token. Revoking a token twice is not an
+// error.
+func (s *AuthService) Revoke(refreshToken string) error {
+	claims, err := s.parseToken(refreshToken, tokenTypeRefresh)
+	if err != nil {
+		return err
+	}
+
+	err = s.repo.RevokeRefreshToken(claims.ID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil
+	}
+
+	return err
+}
+
+// ParseAccessToken validates an access token and returns the identity it
+// was issued to. The user is read on every call rather than trusted to the
+// claims, so that a deleted user is locked out and a role change applies
+// at once instead of when the token expires.
+func (s *AuthService) ParseAccessToken(accessToken string) (goapi.Identity, error) {
+	claims, err := s.parseToken(accessToken, tokenTypeAccess)
+	if err != nil {
+		return goapi.Identity{}, err
+	}
+
+	userID, err := strconv.Atoi(claims.Subject)
+	if err != nil || !claims.Role.Valid() {
+		return goapi.Identity{}, unauthorized("invalid token claims")
+	}
+
+	user, err := s.userRepo.GetByID(userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return goapi.Identity{}, unauthorized("user no longer exists")
+	}
+	if err != nil {
+		return goapi.Identity{}, err
+	}
+
+	return goapi.Identity{UserID: userID, Role: user.Role}, nil
+}
+
+// EnsureAdmin makes sure an admin account with the given email exists,
+// creating it with password or promoting the existing account.
+func (s *AuthService) EnsureAdmin(email, password string) error {
+	email, err := normalizeEmail(email)
+	if err != nil {
+		return err
+	}
+
+	account, err := s.repo.GetAccount(email)
+	if err == nil {
+		if account.Role == goapi.RoleAdmin {
+			return nil
+		}
+		role := goapi.RoleAdmin
+		_, err := s.userRepo.Update(account.UserID, goapi.UserUpdate{Role: &role}, 0)
+		return err
+	}
+	if !errors.Is(err, repository.ErrNotFound) {
+		return err
+	}
+
+	if len(password) < minPasswordLength || len(password) > maxPasswordLength {
+		return invalid("admin password must be between %d and %d bytes long", minPasswordLength, maxPasswordLength)
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	admin := goapi.User{FirstName: "Admin", LastName: "Admin", Role: goapi.RoleAdmin}
+	_, err = s.repo.CreateAccount(admin, email, string(hash))
+
+	return err
+}
+
+func (s *AuthService) issueTokens(identity goapi.Identity) (goapi.Tokens, error) {
+	now := time.Now().UTC()
+	userID := identity.UserID
+
+	accessToken, err := s.signToken(identity, tokenTypeAccess, "", now, now.Add(s.cfg.AccessTokenTTL))
+	if err != nil {
+		return goapi.Tokens{}, err
+	}
+
+	tokenID, err := newTokenID()
+	if err != nil {
+		return goapi.Tokens{}, err
+	}
+
+	expiresAt := now.Add(s.cfg.RefreshTokenTTL)
+	refreshToken, err := s.signToken(goapi.Identity{UserID: userID}, tokenTypeRefresh, tokenID, now, expiresAt)
+	if err != nil {
+		return goapi.Tokens{}, err
+	}
+
+	err = s.repo.CreateRefreshToken(goapi.RefreshToken{ID: tokenID, UserID: userID, ExpiresAt: expiresAt})
+	if err != nil {
+		return goapi.Tokens{}, err
+	}
+
+	return goapi.Tokens{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(s.cfg.AccessTokenTTL.Seconds()),
+	}, nil
+}
+
+// signToken signs a token for identity. Refresh tokens carry no role, it is
+// looked up again on refresh.
+func (s *AuthService) signToken(identity goapi.Identity, tokenType, tokenID string, issuedAt, expiresAt time.Time) (string, error) {
+	claims := tokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   strconv.Itoa(identity.UserID),
+			ID:        tokenID,
+			IssuedAt:  jwt.NewNumericDate(issuedAt),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+		Type: tokenType,
+		Role: identity.Role,
+	}
+
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(s.cfg.JWTSecret))
+}
+
+func (s *AuthService) parseToken(token, tokenType string) (*tokenClaims, error) {
+	claims := &tokenClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(*jwt.Token) (interface{}, error) {
+		return []byte(s.cfg.JWTSecret), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Name}), jwt.WithExpirationRequired())
+	if err != nil {
+		if errors.Is(err, jwt.ErrTokenExpired) {
+			return nil, unauthorized("token has expired")
+		}
+		return nil, unauthorized("invalid token")
+	}
+
+	if claims.Type != tokenType {
+		return nil, unauthorized("wrong token type, expected %s token", tokenType)
+	}
+
+	return claims, nil
+}
+
+func newTokenID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+func normalizeEmail(email string) (string, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		return "", invalidField("email", "email must be a valid email address")
+	}
+
+	return email, nil
+}
@@ -0,0 +1,258 @@
+package service
+
+import (
+	"errors"
+	"time"
+
+	goapi "github.com/Stremilov/car-shop"
+	"github.com/Stremilov/car-shop/pkg/config"
+	"github.com/Stremilov/car-shop/pkg/patch"
+	"github.com/Stremilov/car-shop/pkg/repository"
+)
+
+const (
+	maxCarTypeLength = 10
+	firstCarYear     = 1886
+	maxPowerWatts    = 10_000_000
+)
+
+type CarService struct {
+	repo         repository.Car
+	orderRepo    repository.Order
+	deletePolicy config.DeletePolicy
+}
+
+func NewCarService(repo repository.Car, orderRepo repository.Order, deletePolicy config.DeletePolicy) *CarService {
+	return &CarService{repo: repo, orderRepo: orderRepo, deletePolicy: deletePolicy}
+}
+
+func (s *CarService) Create(car goapi.Car) (goapi.Car, error) {
+	if err := validateName("name", car.Name); err != nil {
+		return goapi.Car{}, err
+	}
+
+	if err := validatePower(car.Power); err != nil {
+		return goapi.Car{}, err
+	}
+
+	if err := validateCarType(car.Type); err != nil {
+		return goapi.Car{}, err
+	}
+
+	if err := validateYear(car.Year); err != nil {
+		return goapi.Car{}, err
+	}
+
+	return s.repo.Create(car)
+}
+
+func (s *CarService) GetAll(filter goapi.CarFilter, params goapi.ListParams) (goapi.Page[goapi.Car], error) {
+	if err := checkListParams(&params, goapi.CarSortFields); err != nil {
+		return goapi.Page[goapi.Car]{}, err
+	}
+
+	if filter.YearFrom != nil && filter.YearTo != nil && *filter.YearFrom > *filter.YearTo {
+		return goapi.Page[goapi.Car]{}, invalid("year_from must not be greater than year_to")
+	}
+
+	cars, total, err := s.repo.GetAll(filter, withLookahead(params))
+	if err != nil {
+		return goapi.Page[goapi.Car]{}, err
+	}
+
+	return newPage(cars, total, params, func(c goapi.Car) int { return c.CarID }), nil
+}
+
+func (s *CarService) GetByID(carID int) (goapi.Car, error) {
+	car, err := s.repo.GetByID(carID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return car, notFound("car %d not found", carID)
+	}
+
+	return car, err
+}
+
+// GetByIDWithDeleted is GetByID that also finds soft deleted cars.
+func (s *CarService) GetByIDWithDeleted(carID int) (goapi.Car, error) {
+	car, err := s.repo.GetByID(carID)
+	if errors.Is(err, repository.ErrNotFound) {
+		car, err = s.repo.GetDeleted(carID)
+	}
+	if errors.Is(err, repository.ErrNotFound) {
+		return car, notFound("car %d not found", carID)
+	}
+
+	return car, err
+}
+
+// Update changes the car and returns it. Unless version is 0, the car has
+// to be at that version.
+func (s *CarService) Update(carID int, input goapi.CarUpdate, version int) (goapi.Car, error) {
+	if err := input.Validate(); err != nil {
+		return goapi.Car{}, invalid("%s", err)
+	}
+
+	if input.Name != nil {
+		if err := validateName("name", *input.Name); err != nil {
+			return goapi.Car{}, err
+		}
+	}
+
+	if input.Power != nil {
+		if err := validatePower(*input.Power); err != nil {
+			return goapi.Car{}, err
+		}
+	}
+
+	if input.Type != nil {
+		if err := validateCarType(*input.Type); err != nil {
+			return goapi.Car{}, err
+		}
+	}
+
+	if input.Year != nil {
+		if err := validateYear(*input.Year); err != nil {
+			return goapi.Car{}, err
+		}
+	}
+
+	car, err := s.repo.Update(carID, input, version)
+
+	return car, carWriteError(err, carID, version)
+}
+
+// ApplyPatch applies p to the fields of car that can be changed and returns
+// the changes it makes as an update for Update. A patch of the power unit
+// alone converts the power rather than relabel its value, which leaves the
+// power as is since it is kept in watts.
+func (s *CarService) ApplyPatch(car goapi.Car, p patch.Patch) (goapi.CarUpdate, error) {
+	fields := goapi.CarUpdate{Name: &car.Name, Power: &car.Power, Type: &car.Type, Year: &car.Year}
+
+	var update goapi.CarUpdate
+	if err := applyPatch(fields, p, &update, nil); err != nil {
+		return update, err
+	}
+
+	if update.Power != nil && update.Power.Unit != car.Power.Unit && !setsPowerValue(car, p, *update.Power) {
+		update.Power = nil
+	}
+
+	return update, nil
+}
+
+// setsPowerValue reports whether p, which patches the power of car to
+// power, sets the value of the power rather than leave it as it was.
+func setsPowerValue(car goapi.Car, p patch.Patch, power goapi.Power) bool {
+	// The value the patch leaves depends on the value before unless it
+	// sets it. A patch that tests the value does not apply to the probe,
+	// and sets it if it changes it.
+	probe := car
+	probe.Power.Value = -1
+	fields := goapi.CarUpdate{Name: &probe.Name, Power: &probe.Power, Type: &probe.Type, Year: &probe.Year}
+
+	var update goapi.CarUpdate
+	if err := applyPatch(fields, p, &update, nil); err != nil {
+		return power.Value != car.Power.Value
+	}
+
+	return update.Power != nil && update.Power.Value != -1
+}
+
+// Delete deletes a car the way the deletion policy says: for good unless
+// it was ordered or has vehicles, in which case the conflict lists the
+// orders, or softly. Unless version is 0, the car has to be at that
+// version.
+func (s *CarService) Delete(carID int, version int) error {
+	if s.deletePolicy == config.DeleteSoft {
+		return carWriteError(s.repo.SoftDelete(carID, version), carID, version)
+	}
+
+	err := s.repo.Delete(carID, version)
+	if errors.Is(err, repository.ErrForeignKeyViolation) {
+		orderIDs, err := s.orderRepo.GetIDsByCarID(carID)
+		if err != nil {
+			return err
+		}
+		if len(orderIDs) == 0 {
+			return conflict("car %d has vehicles in the inventory and cannot be deleted", carID)
+		}
+		return conflictWith(blockingOrders{OrderIDs: orderIDs}, "car %d has orders and cannot be deleted", carID)
+	}
+
+	return carWriteError(err, carID, version)
+}
+
+// ForceDelete deletes a car for good together with its vehicles and the
+// orders of it, whatever the deletion policy. An order that also has other
+// cars or extras is deleted as a whole rather than left with a total that
+// no longer adds up. Orders with payments cannot be deleted though. Unless
+// version is 0, the car has to be at that version.
+func (s *CarService) ForceDelete(carID int, version int) error {
+	err := s.repo.DeleteCascade(carID, version)
+	if errors.Is(err, repository.ErrForeignKeyViolation) {
+		return conflict("orders of car %d have payments and cannot be deleted", carID)
+	}
+
+	return carWriteError(err, carID, version)
+}
+
+// carWriteError maps the errors of a write to the car at version.
+func carWriteError(err error, carID, version int) error {
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		return notFound("car %d not found", carID)
+	case errors.Is(err, repository.ErrVersionMismatch):
+		return preconditionFailed("car %d has changed since version %d", carID, version)
+	}
+
+	return err
+}
+
+// Restore brings back a soft deleted car and returns it.
+func (s *CarService) Restore(carID int) (goapi.Car, error) {
+	err := s.repo.Restore(carID)
+	if errors.Is(err, repository.ErrNotFound) {
+		if _, err := s.GetByID(carID); err != nil {
+			return goapi.Car{}, err
+		}
+		return goapi.Car{}, conflict("car %d is not deleted", carID)
+	}
+	if err != nil {
+		return goapi.Car{}, err
+	}
+
+	return s.GetByID(carID)
+}
+
+func validatePower(power goapi.Power) error {
+	if !power.Unit.Valid() {
+		return invalidField("power.unit", "power unit must be %s or %s", goapi.PowerUnitHP, goapi.PowerUnitKW)
+	}
+
+	if watts := power.Watts(); watts <= 0 || watts > maxPowerWatts {
+		return invalidField("power.value", "power must be positive and at most %d kW", maxPowerWatts/1000)
+	}
+
+	return nil
+}
+
+func validateCarType(carType string) error {
+	if carType == "" {
+		return invalidField("type", "type must not be empty")
+	}
+
+	if len([]rune(carType)) > maxCarTypeLength {
+		return invalidField("type", "type must be at most %d characters long", maxCarTypeLength)
+	}
+
+	return nil
+}
+
+func validateYear(year int) error {
+	lastYear := time.Now().Year() + 1
+	if year < firstCarYear || year > lastYear {
+		return invalidField("year", "year must be between %d and %d", firstCarYear, lastYear)
+	}
+
+	return nil
+}
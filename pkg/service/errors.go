@@ -0,0 +1,72 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+)
+
+type Kind int
+
+const (
+	KindInvalid Kind = iota + 1
+	KindNotFound
+	KindConflict
+	KindUnauthorized
+	// KindPreconditionFailed means the record is not at the version the
+	// client expected anymore.
+	KindPreconditionFailed
+)
+
+// Error is a domain error returned by the services. Handlers map its Kind
+// to an HTTP status code and show Message to the client as is. Field names
+// the offending input field of a KindInvalid error, if there is a single one.
+// Details, if set, is shown along with Message.
+type Error struct {
+	Kind    Kind
+	Message string
+	Field   string
+	Details interface{}
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func invalid(format string, args ...interface{}) error {
+	return &Error{Kind: KindInvalid, Message: fmt.Sprintf(format, args...)}
+}
+
+func invalidField(field, format string, args ...interface{}) error {
+	return &Error{Kind: KindInvalid, Message: fmt.Sprintf(format, args...), Field: field}
+}
+
+func notFound(format string, args ...interface{}) error {
+	return &Error{Kind: KindNotFound, Message: fmt.Sprintf(format, args...)}
+}
+
+func conflict(format string, args ...interface{}) error {
+	return &Error{Kind: KindConflict, Message: fmt.Sprintf(format, args...)}
+}
+
+// conflictWith is conflict with details, such as the records in the way.
+func conflictWith(details interface{}, format string, args ...interface{}) error {
+	return &Error{Kind: KindConflict, Message: fmt.Sprintf(format, args...), Details: details}
+}
+
+func preconditionFailed(format string, args ...interface{}) error {
+	return &Error{Kind: KindPreconditionFailed, Message: fmt.Sprintf(format, args...)}
+}
+
+func unauthorized(format string, args ...interface{}) error {
+	return &Error{Kind: KindUnauthorized, Message: fmt.Sprintf(format, args...)}
+}
+
+// KindOf reports the Kind of a domain error, or 0 if err is not one.
+func KindOf(err error) Kind {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Kind
+	}
+
+	return 0
+}
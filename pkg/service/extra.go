@@ -0,0 +1,59 @@
+package service
+
+import (
+	"errors"
+
+	goapi "github.com/Stremilov/car-shop"
+	"github.com/Stremilov/car-shop/pkg/repository"
+)
+
+type ExtraService struct {
+	repo repository.Extra
+}
+
+func NewExtraService(repo repository.Extra) *ExtraService {
+	return &ExtraService{repo: repo}
+}
+
+func (s *ExtraService) Create(extra goapi.Extra) (goapi.Extra, error) {
+	if err := validateName("name", extra.Name); err != nil {
+		return goapi.Extra{}, err
+	}
+
+	if extra.Price < 0 {
+		return goapi.Extra{}, invalidField("price", "price must not be negative")
+	}
+
+	if err := validateCurrency("currency", extra.Currency); err != nil {
+		return goapi.Extra{}, err
+	}
+
+	created, err := s.repo.Create(extra)
+	if errors.Is(err, repository.ErrDuplicate) {
+		return created, conflict("extra %q already exists", extra.Name)
+	}
+
+	return created, err
+}
+
+func (s *ExtraService) GetAll(params goapi.ListParams) (goapi.Page[goapi.Extra], error) {
+	if err := checkListParams(&params, goapi.ExtraSortFields); err != nil {
+		return goapi.Page[goapi.Extra]{}, err
+	}
+
+	extras, total, err := s.repo.GetAll(withLookahead(params))
+	if err != nil {
+		return goapi.Page[goapi.Extra]{}, err
+	}
+
+	return newPage(extras, total, params, func(e goapi.Extra) int { return e.ExtraID }), nil
+}
+
+func (s *ExtraService) GetByID(extraID int) (goapi.Extra, error) {
+	extra, err := s.repo.GetByID(extraID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return extra, notFound("extra %d not found", extraID)
+	}
+
+	return extra, err
+}
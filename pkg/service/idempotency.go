@@ -0,0 +1,71 @@
+package service
+
+import (
+	"errors"
+	"time"
+
+	goapi "github.com/Stremilov/car-shop"
+	"github.com/Stremilov/car-shop/pkg/repository"
+)
+
+// maxRequestKeyLength is how long the Idempotency-Key of a request may be.
+const maxRequestKeyLength = 255
+
+type IdempotencyService struct {
+	repo repository.Idempotency
+	ttl  time.Duration
+}
+
+func NewIdempotencyService(repo repository.Idempotency, ttl time.Duration) *IdempotencyService {
+	return &IdempotencyService{repo: repo, ttl: ttl}
+}
+
+// Begin claims key for a request of userID identified by fingerprint and
+// returns the new request with true. If the user made the same request with
+// the key before, it returns that request with false so that its response
+// can be replayed. Using the key for a different request is invalid, and so
+// is retrying while the first request is still being handled.
+func (s *IdempotencyService) Begin(userID int, key, fingerprint string) (goapi.IdempotentRequest, bool, error) {
+	if len(key) > maxRequestKeyLength {
+		return goapi.IdempotentRequest{}, false, invalid("the Idempotency-Key must be at most %d characters long", maxRequestKeyLength)
+	}
+
+	request := goapi.IdempotentRequest{
+		UserID:      userID,
+		Key:         key,
+		Fingerprint: fingerprint,
+		ExpiresAt:   time.Now().Add(s.ttl),
+	}
+
+	first, isNew, err := s.repo.Create(request)
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		return goapi.IdempotentRequest{}, false, conflict("the request with this Idempotency-Key changed while handling it, try again")
+	case errors.Is(err, repository.ErrForeignKeyViolation):
+		return goapi.IdempotentRequest{}, false, unauthorized("the user no longer exists")
+	case err != nil:
+		return goapi.IdempotentRequest{}, false, err
+	case isNew:
+		return first, true, nil
+	}
+
+	if first.Fingerprint != fingerprint {
+		return goapi.IdempotentRequest{}, false, invalid("the Idempotency-Key %q was already used for a different request", key)
+	}
+	if first.Status == 0 {
+		return goapi.IdempotentRequest{}, false, conflict("the request with this Idempotency-Key is still being handled")
+	}
+
+	return first, false, nil
+}
+
+// Complete keeps the response to request for its retries.
+func (s *IdempotencyService) Complete(request goapi.IdempotentRequest) error {
+	return s.repo.Complete(request)
+}
+
+// Abandon releases the key of a request whose response is not worth
+// keeping, so that the request can be retried with it.
+func (s *IdempotencyService) Abandon(request goapi.IdempotentRequest) error {
+	return s.repo.Delete(request.UserID, request.Key)
+}
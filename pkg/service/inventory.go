@@ -0,0 +1,135 @@
+package service
+
+import (
+	"errors"
+
+	goapi "github.com/Stremilov/car-shop"
+	"github.com/Stremilov/car-shop/pkg/repository"
+)
+
+type InventoryService struct {
+	repo    repository.Inventory
+	carRepo repository.Car
+}
+
+func NewInventoryService(repo repository.Inventory, carRepo repository.Car) *InventoryService {
+	return &InventoryService{repo: repo, carRepo: carRepo}
+}
+
+// Create adds a vehicle to the inventory. New vehicles are either in stock
+// or still in transit; reserved and sold are for orders to set.
+func (s *InventoryService) Create(vehicle goapi.Vehicle) (goapi.Vehicle, error) {
+	vehicle.VIN = goapi.NormalizeVIN(vehicle.VIN)
+	if !goapi.ValidVIN(vehicle.VIN) {
+		return goapi.Vehicle{}, invalidField("vin", "vin must be 17 letters and digits, without I, O and Q")
+	}
+
+	if vehicle.Status == "" {
+		vehicle.Status = goapi.VehicleInStock
+	}
+
+	if err := validateManualStatus(vehicle.Status); err != nil {
+		return goapi.Vehicle{}, err
+	}
+
+	if _, err := s.carRepo.GetByID(vehicle.CarID); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return goapi.Vehicle{}, invalidField("car_id", "car %d does not exist", vehicle.CarID)
+		}
+		return goapi.Vehicle{}, err
+	}
+
+	created, err := s.repo.Create(vehicle)
+	switch {
+	case errors.Is(err, repository.ErrDuplicate):
+		return created, conflict("a vehicle with VIN %s already exists", vehicle.VIN)
+	case errors.Is(err, repository.ErrForeignKeyViolation):
+		return created, invalidField("car_id", "car %d does not exist", vehicle.CarID)
+	}
+
+	return created, err
+}
+
+func (s *InventoryService) GetAll(filter goapi.VehicleFilter, params goapi.ListParams) (goapi.Page[goapi.Vehicle], error) {
+	if err := checkListParams(&params, goapi.VehicleSortFields); err != nil {
+		return goapi.Page[goapi.Vehicle]{}, err
+	}
+
+	if filter.Status != "" && !filter.Status.Valid() {
+		return goapi.Page[goapi.Vehicle]{}, invalidField("status", "status must be one of %s, %s, %s or %s",
+			goapi.VehicleInStock, goapi.VehicleReserved, goapi.VehicleSold, goapi.VehicleInTransit)
+	}
+
+	vehicles, total, err := s.repo.GetAll(filter, withLookahead(params))
+	if err != nil {
+		return goapi.Page[goapi.Vehicle]{}, err
+	}
+
+	return newPage(vehicles, total, params, func(v goapi.Vehicle) int { return v.VehicleID }), nil
+}
+
+func (s *InventoryService) GetByID(vehicleID int) (goapi.Vehicle, error) {
+	vehicle, err := s.repo.GetByID(vehicleID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return vehicle, notFound("vehicle %d not found", vehicleID)
+	}
+
+	return vehicle, err
+}
+
+// SetStatus moves a vehicle between in stock and in transit. Vehicles
+// that are reserved or sold belong to an order and only change with it.
+func (s *InventoryService) SetStatus(vehicleID int, status goapi.VehicleStatus) (goapi.Vehicle, error) {
+	if err := validateManualStatus(status); err != nil {
+		return goapi.Vehicle{}, err
+	}
+
+	vehicle, err := s.GetByID(vehicleID)
+	if err != nil {
+		return vehicle, err
+	}
+
+	if vehicle.Status == status {
+		return vehicle, nil
+	}
+
+	if err := validateManualStatus(vehicle.Status); err != nil {
+		return goapi.Vehicle{}, conflict("vehicle %d is %s and belongs to an order", vehicleID, vehicle.Status)
+	}
+
+	err = s.repo.SetStatus(vehicleID, vehicle.Status, status)
+	if errors.Is(err, repository.ErrNotFound) {
+		return goapi.Vehicle{}, conflict("vehicle %d changed while updating it, try again", vehicleID)
+	}
+	if err != nil {
+		return goapi.Vehicle{}, err
+	}
+
+	return s.GetByID(vehicleID)
+}
+
+// GetStock counts the vehicles of every car, or of carID only.
+func (s *InventoryService) GetStock(carID *int) ([]goapi.Stock, error) {
+	stock, err := s.repo.GetStock(carID)
+	if err != nil {
+		return nil, err
+	}
+
+	if carID != nil && len(stock) == 0 {
+		return nil, notFound("car %d not found", *carID)
+	}
+
+	if stock == nil {
+		stock = []goapi.Stock{}
+	}
+
+	return stock, nil
+}
+
+func validateManualStatus(status goapi.VehicleStatus) error {
+	if status != goapi.VehicleInStock && status != goapi.VehicleInTransit {
+		return invalidField("status", "status must be %s or %s", goapi.VehicleInStock, goapi.VehicleInTransit)
+	}
+
+	return nil
+}
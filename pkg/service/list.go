@@ -0,0 +1,67 @@
+package service
+
+import (
+	"slices"
+	"strings"
+
+	goapi "github.com/Stremilov/car-shop"
+)
+
+// checkListParams fills in the defaults of params and rejects paging and
+// sorting the repositories cannot honour.
+func checkListParams(params *goapi.ListParams, sortFields []string) error {
+	if params.Limit == 0 {
+		params.Limit = goapi.DefaultPageLimit
+	}
+
+	if params.Limit < 0 || params.Limit > goapi.MaxPageLimit {
+		return invalid("limit must be between 1 and %d", goapi.MaxPageLimit)
+	}
+
+	if params.Offset < 0 {
+		return invalid("offset must not be negative")
+	}
+
+	if params.Sort == "" {
+		params.Sort = "id"
+	}
+
+	if !slices.Contains(sortFields, params.Sort) {
+		return invalid("sort must be one of %s", strings.Join(sortFields, ", "))
+	}
+
+	if params.Cursor > 0 && params.Offset > 0 {
+		return invalid("cursor and offset cannot be used together")
+	}
+
+	if params.Cursor > 0 && params.Sort != "id" {
+		return invalid("cursor can only be used when sorting by id")
+	}
+
+	return nil
+}
+
+// withLookahead asks the repository for one item more than the page holds,
+// so newPage can tell whether another page follows.
+func withLookahead(params goapi.ListParams) goapi.ListParams {
+	params.Limit++
+	return params
+}
+
+func newPage[T any](items []T, total int, params goapi.ListParams, id func(T) int) goapi.Page[T] {
+	page := goapi.Page[T]{Items: items, Total: total}
+
+	if len(items) > params.Limit {
+		page.Items = items[:params.Limit]
+		if params.Sort == "id" {
+			cursor := goapi.EncodeCursor(id(page.Items[len(page.Items)-1]))
+			page.NextCursor = &cursor
+		}
+	}
+
+	if page.Items == nil {
+		page.Items = []T{}
+	}
+
+	return page
+}
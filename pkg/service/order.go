@@ -0,0 +1,430 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	goapi "github.com/Stremilov/car-shop"
+	"github.com/Stremilov/car-shop/pkg/config"
+	"github.com/Stremilov/car-shop/pkg/patch"
+	"github.com/Stremilov/car-shop/pkg/repository"
+)
+
+const maxOrderItems = 20
+
+type OrderService struct {
+	repo         repository.Order
+	userRepo     repository.User
+	carRepo      repository.Car
+	extraRepo    repository.Extra
+	pricingRepo  repository.Pricing
+	paymentRepo  repository.Payment
+	deletePolicy config.DeletePolicy
+}
+
+func NewOrderService(repo repository.Order, userRepo repository.User, carRepo repository.Car, extraRepo repository.Extra,
+	pricingRepo repository.Pricing, paymentRepo repository.Payment, deletePolicy config.DeletePolicy) *OrderService {
+	return &OrderService{repo: repo, userRepo: userRepo, carRepo: carRepo, extraRepo: extraRepo, pricingRepo: pricingRepo,
+		paymentRepo: paymentRepo, deletePolicy: deletePolicy}
+}
+
+// Create prices and places an order after checking that the user and
+// everything ordered exist. It reserves a vehicle for every car ordered and
+// fails with a conflict if there are not enough in stock.
+func (s *OrderService) Create(input goapi.OrderInput) (goapi.Order, error) {
+	if _, err := s.userRepo.GetByID(input.UserID); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return goapi.Order{}, invalid("user %d does not exist", input.UserID)
+		}
+		return goapi.Order{}, err
+	}
+
+	now := time.Now()
+	order := goapi.PricedOrder{UserID: input.UserID}
+
+	if input.CarID != 0 {
+		if err := s.addItem(&order, "", goapi.OrderItemInput{CarID: input.CarID}, now); err != nil {
+			return goapi.Order{}, err
+		}
+	}
+
+	for i, item := range input.Items {
+		if err := s.addItem(&order, fmt.Sprintf("items[%d].", i), item, now); err != nil {
+			return goapi.Order{}, err
+		}
+	}
+
+	if len(order.Items) == 0 {
+		return goapi.Order{}, invalidField("items", "an order needs at least one car or extra")
+	}
+	if len(order.Items) > maxOrderItems {
+		return goapi.Order{}, invalidField("items", "an order may have at most %d items", maxOrderItems)
+	}
+
+	if err := s.applyDiscounts(&order, input.PromoCode, now); err != nil {
+		return goapi.Order{}, err
+	}
+
+	created, err := s.repo.Create(order)
+
+	var outOfStock *repository.OutOfStockError
+	switch {
+	case errors.As(err, &outOfStock):
+		return created, conflict("car %d is out of stock", outOfStock.CarID)
+	case errors.Is(err, repository.ErrDiscountUsedUp):
+		return created, conflict("a discount of the order has just been used up, try again")
+	case errors.Is(err, repository.ErrForeignKeyViolation):
+		return created, conflict("the user, a car or an extra was deleted while placing the order, try again")
+	}
+
+	return created, err
+}
+
+// addItem checks that item orders exactly one existing car or extra, prices
+// it at now and adds it to order. prefix is the path of the item in the
+// input, such as "items[0].".
+func (s *OrderService) addItem(order *goapi.PricedOrder, prefix string, item goapi.OrderItemInput, now time.Time) error {
+	field := strings.TrimSuffix(prefix, ".")
+	if (item.CarID == 0) == (item.ExtraID == 0) {
+		return invalidField(field, "an item needs either a car_id or an extra_id")
+	}
+
+	if item.Quantity < 0 {
+		return invalidField(prefix+"quantity", "quantity must be positive")
+	}
+	if item.Quantity == 0 {
+		item.Quantity = 1
+	}
+
+	priced := goapi.PricedItem{CarID: item.CarID, ExtraID: item.ExtraID, Quantity: item.Quantity}
+	var currency string
+
+	if item.CarID != 0 {
+		if _, err := s.carRepo.GetByID(item.CarID); err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				return invalidField(prefix+"car_id", "car %d does not exist", item.CarID)
+			}
+			return err
+		}
+
+		price, err := s.pricingRepo.GetCarPrice(item.CarID, now)
+		if errors.Is(err, repository.ErrNotFound) {
+			return invalidField(prefix+"car_id", "car %d has no price yet", item.CarID)
+		}
+		if err != nil {
+			return err
+		}
+		priced.ListPrice, currency = price.Amount, price.Currency
+	} else {
+		extra, err := s.extraRepo.GetByID(item.ExtraID)
+		if errors.Is(err, repository.ErrNotFound) {
+			return invalidField(prefix+"extra_id", "extra %d does not exist", item.ExtraID)
+		}
+		if err != nil {
+			return err
+		}
+		priced.ListPrice, currency = extra.Price, extra.Currency
+	}
+
+	if order.Currency == "" {
+		order.Currency = currency
+	}
+	if currency != order.Currency {
+		return invalidField(field, "all items must be priced in one currency, not %s and %s", order.Currency, currency)
+	}
+
+	priced.UnitPrice = priced.ListPrice
+	order.Items = append(order.Items, priced)
+
+	return nil
+}
+
+// applyDiscounts gives every vehicle the biggest discount on its car and
+// then the order the biggest discount on the whole order, out of the
+// automatic discounts and the promo code. Discounts do not add up, so the
+// promo code is only used where it beats the others.
+func (s *OrderService) applyDiscounts(order *goapi.PricedOrder, promoCode string, now time.Time) error {
+	discounts, err := s.pricingRepo.GetAutomaticDiscounts(now)
+	if err != nil {
+		return err
+	}
+
+	var promo goapi.Discount
+	if promoCode != "" {
+		promo, err = s.pricingRepo.GetDiscountByCode(strings.ToUpper(promoCode))
+		if errors.Is(err, repository.ErrNotFound) {
+			return invalidField("promo_code", "unknown promo code %s", promoCode)
+		}
+		if err != nil {
+			return err
+		}
+
+		if !promo.ValidAt(now) {
+			return invalidField("promo_code", "promo code %s has expired or is used up", promoCode)
+		}
+		if !discountApplies(promo, *order) {
+			return invalidField("promo_code", "promo code %s does not apply to this order", promoCode)
+		}
+
+		discounts = append(discounts, promo)
+	}
+
+	for i := range order.Items {
+		item := &order.Items[i]
+		for _, d := range discounts {
+			if item.CarID == 0 || d.CarID == nil || *d.CarID != item.CarID || !discountCurrencyOK(d, *order) {
+				continue
+			}
+			if price := item.ListPrice - d.Off(item.ListPrice); price < item.UnitPrice {
+				item.UnitPrice, item.DiscountID = price, d.DiscountID
+			}
+		}
+	}
+
+	var subtotal int64
+	for _, item := range order.Items {
+		subtotal += item.UnitPrice * int64(item.Quantity)
+	}
+
+	for _, d := range discounts {
+		if d.CarID != nil || !discountCurrencyOK(d, *order) {
+			continue
+		}
+		if off := d.Off(subtotal); off > order.Discount {
+			order.Discount, order.DiscountID = off, d.DiscountID
+		}
+	}
+
+	if promo.DiscountID != 0 && slices.Contains(order.DiscountIDs(), promo.DiscountID) {
+		order.PromoCode = promo.Code
+	}
+
+	return nil
+}
+
+// discountApplies reports whether d could lower the price of order at all.
+func discountApplies(d goapi.Discount, order goapi.PricedOrder) bool {
+	if !discountCurrencyOK(d, order) {
+		return false
+	}
+
+	if d.CarID == nil {
+		return true
+	}
+
+	return slices.ContainsFunc(order.Items, func(item goapi.PricedItem) bool { return item.CarID == *d.CarID })
+}
+
+// discountCurrencyOK reports whether d can be taken off prices in the
+// currency of order. Percentages can be taken off any price.
+func discountCurrencyOK(d goapi.Discount, order goapi.PricedOrder) bool {
+	return d.Kind == goapi.DiscountPercent || d.Currency == order.Currency
+}
+
+func (s *OrderService) GetAll(filter goapi.OrderFilter, params goapi.ListParams) (goapi.Page[goapi.Order], error) {
+	if err := checkListParams(&params, goapi.OrderSortFields); err != nil {
+		return goapi.Page[goapi.Order]{}, err
+	}
+
+	if filter.DateFrom != nil && filter.DateTo != nil && filter.DateFrom.After(*filter.DateTo) {
+		return goapi.Page[goapi.Order]{}, invalid("date_from must not be after date_to")
+	}
+
+	if _, ok := orderTransitions[filter.Status]; filter.Status != "" && !ok {
+		return goapi.Page[goapi.Order]{}, invalidField("status", "unknown order status %q", filter.Status)
+	}
+
+	orders, total, err := s.repo.GetAll(filter, withLookahead(params))
+	if err != nil {
+		return goapi.Page[goapi.Order]{}, err
+	}
+
+	return newPage(orders, total, params, func(o goapi.Order) int { return o.OrderID }), nil
+}
+
+func (s *OrderService) GetByID(orderID int) (goapi.Order, error) {
+	order, err := s.repo.GetByID(orderID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return order, notFound("order %d not found", orderID)
+	}
+
+	return order, err
+}
+
+// GetByIDWithDeleted is GetByID that also finds soft deleted orders.
+func (s *OrderService) GetByIDWithDeleted(orderID int) (goapi.Order, error) {
+	order, err := s.repo.GetByID(orderID)
+	if errors.Is(err, repository.ErrNotFound) {
+		order, err = s.repo.GetDeleted(orderID)
+	}
+	if errors.Is(err, repository.ErrNotFound) {
+		return order, notFound("order %d not found", orderID)
+	}
+
+	return order, err
+}
+
+func (s *OrderService) GetByUserID(userID int) ([]goapi.Order, error) {
+	if _, err := s.userRepo.GetByID(userID); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, notFound("user %d not found", userID)
+		}
+		return nil, err
+	}
+
+	return s.repo.GetByUserID(userID)
+}
+
+// Delete deletes an order the way the deletion policy says: for good
+// unless it has payments, or softly unless a payment of it is in progress
+// or has taken the money, since the webhook events of the provider would
+// not find the order anymore. Either way the vehicles it holds go back in
+// stock.
+func (s *OrderService) Delete(orderID int) error {
+	if s.deletePolicy == config.DeleteSoft {
+		payments, err := s.paymentRepo.GetByOrderID(orderID)
+		if err != nil {
+			return err
+		}
+		for _, p := range payments {
+			if p.Status != goapi.PaymentFailed && p.Status != goapi.PaymentRefunded {
+				return conflict("order %d has a payment that is %s and cannot be deleted", orderID, p.Status)
+			}
+		}
+
+		err = s.repo.SoftDelete(orderID)
+		if errors.Is(err, repository.ErrNotFound) {
+			return notFound("order %d not found", orderID)
+		}
+		return err
+	}
+
+	err := s.repo.Delete(orderID)
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		return notFound("order %d not found", orderID)
+	case errors.Is(err, repository.ErrForeignKeyViolation):
+		return conflict("order %d has payments and cannot be deleted", orderID)
+	}
+
+	return err
+}
+
+// Restore brings back a soft deleted order and returns it. An order that
+// held its vehicles reserved reserves them again, which fails with a
+// conflict if one of them has been ordered or sold in the meantime.
+func (s *OrderService) Restore(orderID int) (goapi.Order, error) {
+	order, err := s.repo.GetDeleted(orderID)
+	if errors.Is(err, repository.ErrNotFound) {
+		if _, err := s.GetByID(orderID); err != nil {
+			return goapi.Order{}, err
+		}
+		return goapi.Order{}, conflict("order %d is not deleted", orderID)
+	}
+	if err != nil {
+		return goapi.Order{}, err
+	}
+
+	var vehicleStatus goapi.VehicleStatus
+	if order.Status.HoldsVehicles() {
+		vehicleStatus = goapi.VehicleReserved
+	}
+
+	err = s.repo.Restore(orderID, vehicleStatus)
+
+	var outOfStock *repository.OutOfStockError
+	switch {
+	case errors.As(err, &outOfStock):
+		return goapi.Order{}, conflict("a vehicle of car %d in order %d is not in stock anymore", outOfStock.CarID, orderID)
+	case errors.Is(err, repository.ErrNotFound):
+		return goapi.Order{}, conflict("order %d changed while restoring it, try again", orderID)
+	case err != nil:
+		return goapi.Order{}, err
+	}
+
+	return s.GetByID(orderID)
+}
+
+// orderTransitions lists the statuses an order may move to from each
+// status. Cancelled and refunded orders are final.
+var orderTransitions = map[goapi.OrderStatus][]goapi.OrderStatus{
+	goapi.OrderDraft:            {goapi.OrderPendingPayment, goapi.OrderCancelled},
+	goapi.OrderPendingPayment:   {goapi.OrderPaid, goapi.OrderCancelled},
+	goapi.OrderPaid:             {goapi.OrderReadyForDelivery, goapi.OrderRefunded},
+	goapi.OrderReadyForDelivery: {goapi.OrderDelivered, goapi.OrderRefunded},
+	goapi.OrderDelivered:        {goapi.OrderRefunded},
+	goapi.OrderCancelled:        nil,
+	goapi.OrderRefunded:         nil,
+}
+
+// orderVehicleStatus is what happens to the vehicle of an order entering a
+// status: it is sold once paid for and back in stock if the deal falls
+// through. Other statuses leave it alone.
+var orderVehicleStatus = map[goapi.OrderStatus]goapi.VehicleStatus{
+	goapi.OrderPaid:      goapi.VehicleSold,
+	goapi.OrderCancelled: goapi.VehicleInStock,
+	goapi.OrderRefunded:  goapi.VehicleInStock,
+}
+
+// ApplyPatch applies p to the fields of order that can be changed and
+// returns the changes it makes as an update. The status is changed with
+// SetStatus.
+func (s *OrderService) ApplyPatch(order goapi.Order, p patch.Patch) (goapi.OrderUpdate, error) {
+	fields := goapi.OrderUpdate{Status: &order.Status}
+
+	var update goapi.OrderUpdate
+	err := applyPatch(fields, p, &update, nil)
+
+	return update, err
+}
+
+// SetStatus moves the order to status on behalf of changedBy if the
+// lifecycle allows it, and returns the updated order.
+func (s *OrderService) SetStatus(orderID int, status goapi.OrderStatus, changedBy int, note string) (goapi.Order, error) {
+	if _, ok := orderTransitions[status]; !ok {
+		return goapi.Order{}, invalidField("status", "unknown order status %q", status)
+	}
+
+	order, err := s.GetByID(orderID)
+	if err != nil {
+		return order, err
+	}
+
+	if !slices.Contains(orderTransitions[order.Status], status) {
+		return goapi.Order{}, conflict("order %d cannot go from %s to %s", orderID, order.Status, status)
+	}
+
+	change := goapi.OrderStatusChange{
+		OrderID:   orderID,
+		From:      order.Status,
+		To:        status,
+		ChangedBy: changedBy,
+		Note:      strings.TrimSpace(note),
+	}
+
+	err = s.repo.SetStatus(change, orderVehicleStatus[status])
+	if errors.Is(err, repository.ErrNotFound) {
+		return goapi.Order{}, conflict("order %d changed while updating it, try again", orderID)
+	}
+	if err != nil {
+		return goapi.Order{}, err
+	}
+
+	return s.GetByID(orderID)
+}
+
+func (s *OrderService) GetHistory(orderID int) ([]goapi.OrderStatusChange, error) {
+	if _, err := s.GetByID(orderID); err != nil {
+		return nil, err
+	}
+
+	history, err := s.repo.GetHistory(orderID)
+	if history == nil && err == nil {
+		history = []goapi.OrderStatusChange{}
+	}
+
+	return history, err
+}
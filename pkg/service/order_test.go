@@ -0,0 +1,230 @@
+package service_test
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	goapi "github.com/Stremilov/car-shop"
+	"github.com/Stremilov/car-shop/pkg/config"
+	"github.com/Stremilov/car-shop/pkg/repository"
+	"github.com/Stremilov/car-shop/pkg/service"
+)
+
+var vins = []string{"1M8GDM9AXKP042788", "1FTFW1ET5DFC10312", "5YJSA1E26HF000337"}
+
+// shop is the services on in-memory storage.
+type shop struct {
+	*service.Service
+	t *testing.T
+}
+
+func newShop(t *testing.T, args ...string) *shop {
+	t.Helper()
+
+	cfg, _, err := config.Load(append([]string{"-storage=memory", "-auth-jwt-secret=" + strings.Repeat("x", 32),
+		"-payment-webhook-secret=" + strings.Repeat("y", 32)}, args...))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &shop{Service: service.NewService(repository.NewMemoryRepository(), cfg), t: t}
+}
+
+// addUser adds a customer and returns their ID.
+func (s *shop) addUser() int {
+	s.t.Helper()
+
+	user, err := s.User.Create(goapi.User{FirstName: "Ann", LastName: "Buyer", Age: 30})
+	if err != nil {
+		s.t.Fatal(err)
+	}
+
+	return user.UserID
+}
+
+// addCar adds a car at price euro cents with vehicles in stock and returns
+// its ID.
+func (s *shop) addCar(price int64, vins ...string) int {
+	s.t.Helper()
+
+	car, err := s.Car.Create(goapi.Car{Name: "Golf", Power: goapi.Power{Value: 150, Unit: goapi.PowerUnitHP}, Type: "hatch", Year: 2020})
+	if err != nil {
+		s.t.Fatal(err)
+	}
+
+	if _, err := s.Pricing.AddCarPrice(car.CarID, goapi.CarPrice{Amount: price, Currency: "EUR"}); err != nil {
+		s.t.Fatal(err)
+	}
+
+	for _, vin := range vins {
+		if _, err := s.Inventory.Create(goapi.Vehicle{CarID: car.CarID, VIN: vin}); err != nil {
+			s.t.Fatal(err)
+		}
+	}
+
+	return car.CarID
+}
+
+// order places an order, which must succeed.
+func (s *shop) order(input goapi.OrderInput) goapi.Order {
+	s.t.Helper()
+
+	order, err := s.Order.Create(input)
+	if err != nil {
+		s.t.Fatalf("Create(%+v): %v", input, err)
+	}
+
+	return order
+}
+
+func assertKind(t *testing.T, err error, want service.Kind) {
+	t.Helper()
+
+	if got := service.KindOf(err); got != want {
+		t.Errorf("got error %v of kind %d, want kind %d", err, got, want)
+	}
+}
+
+func TestCreateOrderOutOfStock(t *testing.T) {
+	s := newShop(t)
+	userID := s.addUser()
+	carID := s.addCar(2000000, vins[0])
+	noStockID := s.addCar(2000000)
+
+	s.order(goapi.OrderInput{UserID: userID, CarID: carID})
+
+	_, err := s.Order.Create(goapi.OrderInput{UserID: userID, CarID: carID})
+	assertKind(t, err, service.KindConflict)
+
+	_, err = s.Order.Create(goapi.OrderInput{UserID: userID, CarID: noStockID})
+	assertKind(t, err, service.KindConflict)
+
+	_, err = s.Order.Create(goapi.OrderInput{UserID: userID, Items: []goapi.OrderItemInput{{CarID: carID, Quantity: 2}}})
+	assertKind(t, err, service.KindConflict)
+
+	stock, err := s.Inventory.GetStock(&carID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stock) != 1 || stock[0].InStock != 0 || stock[0].Reserved != 1 {
+		t.Errorf("stock after the failed orders: got %+v, want 1 reserved and none in stock", stock)
+	}
+}
+
+func TestSetOrderStatus(t *testing.T) {
+	s := newShop(t)
+	userID := s.addUser()
+	carID := s.addCar(2000000, vins...)
+	orderID := s.order(goapi.OrderInput{UserID: userID, CarID: carID}).OrderID
+
+	steps := []struct {
+		status goapi.OrderStatus
+		want   service.Kind
+	}{
+		{"lost", service.KindInvalid},
+		{goapi.OrderPaid, service.KindConflict},
+		{goapi.OrderDelivered, service.KindConflict},
+		{goapi.OrderPendingPayment, 0},
+		{goapi.OrderDraft, service.KindConflict},
+		{goapi.OrderPaid, 0},
+		{goapi.OrderCancelled, service.KindConflict},
+		{goapi.OrderReadyForDelivery, 0},
+		{goapi.OrderDelivered, 0},
+		{goapi.OrderRefunded, 0},
+		{goapi.OrderPendingPayment, service.KindConflict},
+	}
+	for _, step := range steps {
+		_, err := s.Order.SetStatus(orderID, step.status, userID, "")
+		assertKind(t, err, step.want)
+	}
+
+	history, err := s.Order.GetHistory(orderID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []goapi.OrderStatus
+	for _, change := range history {
+		got = append(got, change.To)
+	}
+	want := []goapi.OrderStatus{goapi.OrderPendingPayment, goapi.OrderPaid, goapi.OrderReadyForDelivery,
+		goapi.OrderDelivered, goapi.OrderRefunded}
+	if !slices.Equal(got, want) {
+		t.Errorf("history: got %v, want %v", got, want)
+	}
+}
+
+// TestDeleteCancelledOrder deletes an order after the vehicle it gave back
+// was ordered again, which must leave the new order its vehicle.
+func TestDeleteCancelledOrder(t *testing.T) {
+	for _, policy := range []string{"restrict", "soft"} {
+		t.Run(policy, func(t *testing.T) {
+			s := newShop(t, "-deletion-orders="+policy)
+			userID := s.addUser()
+			carID := s.addCar(2000000, vins[0])
+
+			cancelled := s.order(goapi.OrderInput{UserID: userID, CarID: carID}).OrderID
+			if _, err := s.Order.SetStatus(cancelled, goapi.OrderCancelled, userID, ""); err != nil {
+				t.Fatal(err)
+			}
+
+			s.order(goapi.OrderInput{UserID: userID, CarID: carID})
+
+			if err := s.Order.Delete(cancelled); err != nil {
+				t.Fatal(err)
+			}
+
+			_, err := s.Order.Create(goapi.OrderInput{UserID: userID, CarID: carID})
+			assertKind(t, err, service.KindConflict)
+		})
+	}
+}
+
+func TestCreateOrderTotals(t *testing.T) {
+	s := newShop(t)
+	userID := s.addUser()
+	carID := s.addCar(2000000, vins...)
+
+	extra, err := s.Extra.Create(goapi.Extra{Name: "Floor mats", Price: 4990, Currency: "EUR"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	order := s.order(goapi.OrderInput{UserID: userID, Items: []goapi.OrderItemInput{
+		{CarID: carID, Quantity: 2},
+		{ExtraID: extra.ExtraID, Quantity: 3},
+	}})
+
+	var cars, extras int
+	seen := make(map[string]bool)
+	for _, item := range order.Items {
+		switch {
+		case item.Car != nil:
+			cars += item.Quantity
+			if seen[item.VIN] {
+				t.Errorf("VIN %s reserved twice", item.VIN)
+			}
+			seen[item.VIN] = true
+		case item.ExtraID == extra.ExtraID:
+			extras += item.Quantity
+			if item.Total != 3*4990 {
+				t.Errorf("extras line: got total %d, want %d", item.Total, 3*4990)
+			}
+		}
+	}
+	if cars != 2 || extras != 3 {
+		t.Errorf("got %d cars and %d extras, want 2 and 3", cars, extras)
+	}
+
+	if want := int64(2*2000000 + 3*4990); order.Subtotal != want || order.Total != want || order.Currency != "EUR" {
+		t.Errorf("got subtotal %d and total %d %s, want %d EUR", order.Subtotal, order.Total, order.Currency, want)
+	}
+
+	dollars, err := s.Extra.Create(goapi.Extra{Name: "Roof box", Price: 30000, Currency: "USD"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.Order.Create(goapi.OrderInput{UserID: userID, CarID: carID, Items: []goapi.OrderItemInput{{ExtraID: dollars.ExtraID}}})
+	assertKind(t, err, service.KindInvalid)
+}
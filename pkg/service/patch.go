@@ -0,0 +1,105 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"sort"
+
+	"github.com/Stremilov/car-shop/pkg/patch"
+)
+
+// applyPatch applies p to fields, the fields of a record that can be
+// changed, and decodes the fields whose value it changes into update. A
+// null or removed field is cleared, which sets it to its value in cleared,
+// the value it has on a record created without it; fields missing from
+// cleared are required and cannot be cleared. The patch cannot add fields.
+// The new values are left for the caller to validate.
+func applyPatch(fields interface{}, p patch.Patch, update interface{}, cleared map[string]interface{}) error {
+	doc, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+
+	patched, err := p.Apply(doc)
+	if err != nil {
+		return conflict("patch does not apply: %s", err)
+	}
+
+	var before, after map[string]json.RawMessage
+	if err := json.Unmarshal(doc, &before); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(patched, &after); err != nil {
+		return invalid("patch must leave a JSON object")
+	}
+
+	changed := make(map[string]json.RawMessage)
+	for _, name := range sortedNames(before) {
+		value, ok := after[name]
+		if !ok || string(value) == "null" {
+			clearedValue, optional := cleared[name]
+			if !optional {
+				return invalidField(name, "%s is required and cannot be cleared", name)
+			}
+			if value, err = json.Marshal(clearedValue); err != nil {
+				return err
+			}
+		}
+		if !sameJSON(before[name], value) {
+			changed[name] = value
+		}
+	}
+	for _, name := range sortedNames(after) {
+		if _, ok := before[name]; !ok {
+			return invalidField(name, "%s cannot be changed", name)
+		}
+	}
+
+	data, err := json.Marshal(changed)
+	if err != nil {
+		return err
+	}
+
+	err = json.Unmarshal(data, update)
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &typeErr):
+		return invalidField(typeErr.Field, "%s cannot be a JSON %s", typeErr.Field, typeErr.Value)
+	case err != nil:
+		return invalid("%s", err)
+	}
+
+	return nil
+}
+
+func sortedNames(members map[string]json.RawMessage) []string {
+	names := make([]string, 0, len(members))
+	for name := range members {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// sameJSON reports whether a and b are the same JSON value, whatever the
+// order of object members.
+func sameJSON(a, b json.RawMessage) bool {
+	return bytes.Equal(normalized(a), normalized(b))
+}
+
+// normalized encodes value again, with the members of objects sorted.
+func normalized(value json.RawMessage) []byte {
+	var v interface{}
+	if err := json.Unmarshal(value, &v); err != nil {
+		return value
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return value
+	}
+
+	return data
+}
@@ -0,0 +1,335 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+
+	goapi "github.com/Stremilov/car-shop"
+	"github.com/Stremilov/car-shop/pkg/config"
+	"github.com/Stremilov/car-shop/pkg/payment"
+	"github.com/Stremilov/car-shop/pkg/repository"
+)
+
+// maxIdempotencyKeyLength is how long the idempotency keys of clients may
+// be.
+const maxIdempotencyKeyLength = 100
+
+// PaymentProvider moves the money. Every operation takes an idempotency key
+// the provider remembers its result under, so that an operation retried
+// after a timeout does not charge or refund twice.
+type PaymentProvider interface {
+	// Name is stored with every payment to tell the providers apart.
+	Name() string
+	// Authorize reserves amount on the payment method token stands for.
+	Authorize(key, token string, amount goapi.Money) (payment.Result, error)
+	// Capture takes the money of the authorization ref.
+	Capture(key, ref string, amount goapi.Money) (payment.Result, error)
+	// Refund pays the money of the captured payment ref back.
+	Refund(key, ref string, amount goapi.Money) (payment.Result, error)
+}
+
+// newPaymentProvider returns the provider cfg names. config.Validate only
+// lets the fake provider through so far.
+func newPaymentProvider(cfg config.Payment) PaymentProvider {
+	return payment.NewFake()
+}
+
+// paymentTransitions lists the statuses a payment may move to from each
+// status. Failed and refunded payments are final.
+var paymentTransitions = map[goapi.PaymentStatus][]goapi.PaymentStatus{
+	goapi.PaymentPending:    {goapi.PaymentAuthorized, goapi.PaymentCaptured, goapi.PaymentFailed},
+	goapi.PaymentAuthorized: {goapi.PaymentCaptured, goapi.PaymentFailed},
+	goapi.PaymentCaptured:   {goapi.PaymentRefunded},
+	goapi.PaymentFailed:     nil,
+	goapi.PaymentRefunded:   nil,
+}
+
+// paymentReaches reports whether a payment in status from can end up in
+// status to.
+func paymentReaches(from, to goapi.PaymentStatus) bool {
+	for _, next := range paymentTransitions[from] {
+		if next == to || paymentReaches(next, to) {
+			return true
+		}
+	}
+
+	return false
+}
+
+type PaymentService struct {
+	repo          repository.Payment
+	orders        Order
+	provider      PaymentProvider
+	webhookSecret string
+}
+
+func NewPaymentService(repo repository.Payment, orders Order, provider PaymentProvider, webhookSecret string) *PaymentService {
+	return &PaymentService{repo: repo, orders: orders, provider: provider, webhookSecret: webhookSecret}
+}
+
+// Pay charges the total of an order pending payment to the payment method
+// in input on behalf of payerID. The order is paid once the provider
+// captures the money, which may happen later through a webhook event.
+//
+// A retry with the same idempotency key returns the payment of the first
+// attempt, with created false, instead of charging again.
+func (s *PaymentService) Pay(orderID int, idempotencyKey string, input goapi.PaymentInput, payerID int) (goapi.Payment, bool, error) {
+	if idempotencyKey == "" {
+		return goapi.Payment{}, false, invalid("an Idempotency-Key is required")
+	}
+	if len(idempotencyKey) > maxIdempotencyKeyLength {
+		return goapi.Payment{}, false, invalid("the Idempotency-Key must be at most %d characters long", maxIdempotencyKeyLength)
+	}
+
+	if p, err := s.repo.GetByKey(orderID, idempotencyKey); !errors.Is(err, repository.ErrNotFound) {
+		return p, false, err
+	}
+
+	order, err := s.orders.GetByID(orderID)
+	if err != nil {
+		return goapi.Payment{}, false, err
+	}
+
+	if order.Status != goapi.OrderPendingPayment {
+		return goapi.Payment{}, false, conflict("order %d is %s, only orders pending payment can be paid", orderID, order.Status)
+	}
+	if order.Total <= 0 {
+		return goapi.Payment{}, false, invalid("order %d has nothing to pay", orderID)
+	}
+
+	p, err := s.repo.Create(goapi.Payment{
+		OrderID:        orderID,
+		Provider:       s.provider.Name(),
+		Amount:         order.Total,
+		Currency:       order.Currency,
+		Status:         goapi.PaymentPending,
+		IdempotencyKey: idempotencyKey,
+	})
+	if errors.Is(err, repository.ErrDuplicate) {
+		// Either a concurrent retry with the same key got here first or
+		// the order already has a payment that has not failed.
+		if first, err := s.repo.GetByKey(orderID, idempotencyKey); err == nil {
+			return first, false, nil
+		}
+		return goapi.Payment{}, false, conflict("order %d already has a payment in progress", orderID)
+	}
+	if err != nil {
+		return goapi.Payment{}, false, err
+	}
+
+	result, err := s.provider.Authorize(providerKey(p, "authorize"), input.Token, money(p))
+	if err != nil {
+		// The attempt is given up on so that the client can retry with a
+		// new key.
+		failed := payment.Result{Status: goapi.PaymentFailed, FailureReason: "payment provider unavailable"}
+		if updateErr := s.update(&p, failed); updateErr != nil {
+			return goapi.Payment{}, false, updateErr
+		}
+		return goapi.Payment{}, false, fmt.Errorf("authorize payment %d: %w", p.PaymentID, err)
+	}
+
+	if err := s.update(&p, result); err != nil {
+		return goapi.Payment{}, false, err
+	}
+
+	if err := s.settle(&p, payerID); err != nil {
+		return goapi.Payment{}, false, err
+	}
+
+	p, err = s.repo.GetByID(p.PaymentID)
+
+	return p, true, err
+}
+
+func (s *PaymentService) GetByID(paymentID int) (goapi.Payment, error) {
+	p, err := s.repo.GetByID(paymentID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return p, notFound("payment %d not found", paymentID)
+	}
+
+	return p, err
+}
+
+func (s *PaymentService) GetByOrderID(orderID int) ([]goapi.Payment, error) {
+	if _, err := s.orders.GetByID(orderID); err != nil {
+		return nil, err
+	}
+
+	payments, err := s.repo.GetByOrderID(orderID)
+	if payments == nil && err == nil {
+		payments = []goapi.Payment{}
+	}
+
+	return payments, err
+}
+
+// Capture takes the money of an authorized payment and marks its order as
+// paid on behalf of changedBy. Payments are captured right after they are
+// authorized, so this is for retrying a capture that failed.
+func (s *PaymentService) Capture(paymentID int, changedBy int) (goapi.Payment, error) {
+	p, err := s.GetByID(paymentID)
+	if err != nil {
+		return p, err
+	}
+
+	if p.Status != goapi.PaymentAuthorized {
+		return goapi.Payment{}, conflict("payment %d is %s, only authorized payments can be captured", paymentID, p.Status)
+	}
+
+	if err := s.settle(&p, changedBy); err != nil {
+		return goapi.Payment{}, err
+	}
+
+	return s.GetByID(paymentID)
+}
+
+// Refund pays a captured payment back and marks its order as refunded on
+// behalf of changedBy.
+func (s *PaymentService) Refund(paymentID int, changedBy int) (goapi.Payment, error) {
+	p, err := s.GetByID(paymentID)
+	if err != nil {
+		return p, err
+	}
+
+	if p.Status != goapi.PaymentCaptured {
+		return goapi.Payment{}, conflict("payment %d is %s, only captured payments can be refunded", paymentID, p.Status)
+	}
+
+	result, err := s.provider.Refund(providerKey(p, "refund"), p.ProviderRef, money(p))
+	if err != nil {
+		return goapi.Payment{}, fmt.Errorf("refund payment %d: %w", paymentID, err)
+	}
+	if result.Status != goapi.PaymentRefunded {
+		return goapi.Payment{}, conflict("payment %d could not be refunded: %s", paymentID, result.FailureReason)
+	}
+
+	if err := s.update(&p, result); err != nil {
+		return goapi.Payment{}, err
+	}
+
+	if err := s.settle(&p, changedBy); err != nil {
+		return goapi.Payment{}, err
+	}
+
+	return s.GetByID(paymentID)
+}
+
+// VerifyWebhook reports whether signature is the signature of a webhook
+// body sent by the provider.
+func (s *PaymentService) VerifyWebhook(body []byte, signature string) bool {
+	return payment.Verify(s.webhookSecret, body, signature)
+}
+
+// HandleEvent applies a webhook event of the provider to its payment and
+// returns the payment. Providers deliver events at least once, so an event
+// reporting the status the payment already has changes nothing, apart from
+// finishing what an earlier delivery may have left undone, and neither
+// does a stale one.
+func (s *PaymentService) HandleEvent(event payment.Event) (goapi.Payment, error) {
+	status, ok := event.Status()
+	if !ok {
+		return goapi.Payment{}, invalidField("type", "unknown event type %q", event.Type)
+	}
+
+	p, err := s.repo.GetByRef(s.provider.Name(), event.PaymentRef)
+	if errors.Is(err, repository.ErrNotFound) {
+		return p, notFound("payment %q not found", event.PaymentRef)
+	}
+	if err != nil {
+		return p, err
+	}
+
+	// Events may also arrive out of order. One reporting a status the
+	// payment has already moved past is stale.
+	if p.Status != status && !paymentReaches(status, p.Status) {
+		if !slices.Contains(paymentTransitions[p.Status], status) {
+			return goapi.Payment{}, conflict("payment %d cannot go from %s to %s", p.PaymentID, p.Status, status)
+		}
+
+		result := payment.Result{Ref: p.ProviderRef, Status: status, FailureReason: event.FailureReason}
+		if err := s.update(&p, result); err != nil {
+			return goapi.Payment{}, err
+		}
+	}
+
+	// Changes coming from the provider are not made by any user.
+	if err := s.settle(&p, 0); err != nil {
+		return goapi.Payment{}, err
+	}
+
+	return s.GetByID(p.PaymentID)
+}
+
+// settle does what follows from the status of p: authorized payments are
+// captured, and the order of a captured or refunded payment is moved
+// along on behalf of changedBy. Running it again does nothing more.
+func (s *PaymentService) settle(p *goapi.Payment, changedBy int) error {
+	switch p.Status {
+	case goapi.PaymentAuthorized:
+		result, err := s.provider.Capture(providerKey(*p, "capture"), p.ProviderRef, money(*p))
+		if err != nil {
+			return fmt.Errorf("capture payment %d: %w", p.PaymentID, err)
+		}
+		if result.Status != goapi.PaymentCaptured {
+			return conflict("payment %d could not be captured: %s", p.PaymentID, result.FailureReason)
+		}
+
+		if err := s.update(p, result); err != nil {
+			return err
+		}
+
+		return s.settle(p, changedBy)
+	case goapi.PaymentCaptured:
+		return s.moveOrder(p, goapi.OrderPaid, changedBy)
+	case goapi.PaymentRefunded:
+		return s.moveOrder(p, goapi.OrderRefunded, changedBy)
+	}
+
+	return nil
+}
+
+// moveOrder moves the order of p to status unless it is there already.
+func (s *PaymentService) moveOrder(p *goapi.Payment, status goapi.OrderStatus, changedBy int) error {
+	order, err := s.orders.GetByID(p.OrderID)
+	if err != nil {
+		return err
+	}
+
+	if order.Status == status {
+		return nil
+	}
+
+	_, err = s.orders.SetStatus(p.OrderID, status, changedBy, fmt.Sprintf("payment %d %s", p.PaymentID, p.Status))
+
+	return err
+}
+
+// update stores the outcome of a provider operation on p.
+func (s *PaymentService) update(p *goapi.Payment, result payment.Result) error {
+	from := p.Status
+
+	p.Status = result.Status
+	p.FailureReason = result.FailureReason
+	if result.Ref != "" {
+		p.ProviderRef = result.Ref
+	}
+
+	err := s.repo.Update(*p, from)
+	if errors.Is(err, repository.ErrNotFound) {
+		return conflict("payment %d changed while updating it, try again", p.PaymentID)
+	}
+
+	return err
+}
+
+// providerKey is the idempotency key of an operation on p at the provider.
+// It only depends on the payment, so a retried operation reuses it.
+func providerKey(p goapi.Payment, operation string) string {
+	return "payment-" + strconv.Itoa(p.PaymentID) + "-" + operation
+}
+
+func money(p goapi.Payment) goapi.Money {
+	return goapi.Money{Amount: p.Amount, Currency: p.Currency}
+}
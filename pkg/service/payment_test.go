@@ -0,0 +1,117 @@
+package service_test
+
+import (
+	"testing"
+
+	goapi "github.com/Stremilov/car-shop"
+	"github.com/Stremilov/car-shop/pkg/payment"
+	"github.com/Stremilov/car-shop/pkg/service"
+)
+
+// pendingOrder places an order and moves it to pending payment. It returns
+// the order and the ID of its customer.
+func (s *shop) pendingOrder() (goapi.Order, int) {
+	s.t.Helper()
+
+	userID := s.addUser()
+	order := s.order(goapi.OrderInput{UserID: userID, CarID: s.addCar(2000000, vins[0])})
+
+	order, err := s.Order.SetStatus(order.OrderID, goapi.OrderPendingPayment, userID, "")
+	if err != nil {
+		s.t.Fatal(err)
+	}
+
+	return order, userID
+}
+
+func (s *shop) assertOrderStatus(orderID int, want goapi.OrderStatus) {
+	s.t.Helper()
+
+	order, err := s.Order.GetByID(orderID)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	if order.Status != want {
+		s.t.Errorf("order %d: got status %s, want %s", orderID, order.Status, want)
+	}
+}
+
+func TestPayIdempotent(t *testing.T) {
+	s := newShop(t)
+	order, userID := s.pendingOrder()
+	input := goapi.PaymentInput{Token: "tok_visa"}
+
+	first, created, err := s.Payment.Pay(order.OrderID, "key-1", input, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !created || first.Status != goapi.PaymentCaptured || first.Amount != order.Total {
+		t.Errorf("first attempt: got created %t, status %s and amount %d, want true, captured and %d",
+			created, first.Status, first.Amount, order.Total)
+	}
+	s.assertOrderStatus(order.OrderID, goapi.OrderPaid)
+
+	retry, created, err := s.Payment.Pay(order.OrderID, "key-1", input, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created || retry.PaymentID != first.PaymentID || retry.Status != first.Status {
+		t.Errorf("retry: got created %t and payment %d %s, want false and payment %d %s",
+			created, retry.PaymentID, retry.Status, first.PaymentID, first.Status)
+	}
+
+	_, _, err = s.Payment.Pay(order.OrderID, "key-2", input, userID)
+	assertKind(t, err, service.KindConflict)
+
+	payments, err := s.Payment.GetByOrderID(order.OrderID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(payments) != 1 {
+		t.Errorf("got %d payments, want 1", len(payments))
+	}
+}
+
+func TestHandleEvent(t *testing.T) {
+	s := newShop(t)
+	order, userID := s.pendingOrder()
+
+	p, _, err := s.Payment.Pay(order.OrderID, "key-1", goapi.PaymentInput{Token: payment.TokenPending}, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Status != goapi.PaymentPending {
+		t.Fatalf("got status %s, want pending", p.Status)
+	}
+	s.assertOrderStatus(order.OrderID, goapi.OrderPendingPayment)
+
+	tests := []struct {
+		name       string
+		event      payment.Event
+		wantKind   service.Kind
+		wantStatus goapi.PaymentStatus
+	}{
+		// The authorization is captured straight away.
+		{"authorized", payment.Event{Type: "payment.authorized", PaymentRef: p.ProviderRef}, 0, goapi.PaymentCaptured},
+		{"captured", payment.Event{Type: "payment.captured", PaymentRef: p.ProviderRef}, 0, goapi.PaymentCaptured},
+		{"stale", payment.Event{Type: "payment.authorized", PaymentRef: p.ProviderRef}, 0, goapi.PaymentCaptured},
+		{"unknown type", payment.Event{Type: "payment.pending", PaymentRef: p.ProviderRef}, service.KindInvalid, goapi.PaymentCaptured},
+		{"failed after capture", payment.Event{Type: "payment.failed", PaymentRef: p.ProviderRef}, service.KindConflict, goapi.PaymentCaptured},
+		{"unknown payment", payment.Event{Type: "payment.captured", PaymentRef: "fake_0"}, service.KindNotFound, goapi.PaymentCaptured},
+	}
+
+	for _, tt := range tests {
+		_, err := s.Payment.HandleEvent(tt.event)
+		assertKind(t, err, tt.wantKind)
+
+		got, err := s.Payment.GetByID(p.PaymentID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Status != tt.wantStatus {
+			t.Errorf("%s: got status %s, want %s", tt.name, got.Status, tt.wantStatus)
+		}
+	}
+
+	s.assertOrderStatus(order.OrderID, goapi.OrderPaid)
+}
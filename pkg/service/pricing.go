@@ -0,0 +1,161 @@
+package service
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	goapi "github.com/Stremilov/car-shop"
+	"github.com/Stremilov/car-shop/pkg/repository"
+)
+
+// clockSkew is how far in the past a new price may take effect, so that
+// one meant to take effect right away is not rejected for arriving late.
+const clockSkew = time.Minute
+
+var currencyPattern = regexp.MustCompile(`^[A-Z]{3}$`)
+
+type PricingService struct {
+	repo    repository.Pricing
+	carRepo repository.Car
+}
+
+func NewPricingService(repo repository.Pricing, carRepo repository.Car) *PricingService {
+	return &PricingService{repo: repo, carRepo: carRepo}
+}
+
+// AddCarPrice schedules a new list price for a car. Prices cannot take
+// effect in the past, so the prices orders were placed at stay as they
+// were.
+func (s *PricingService) AddCarPrice(carID int, price goapi.CarPrice) (goapi.CarPrice, error) {
+	if err := s.checkCar(carID); err != nil {
+		return goapi.CarPrice{}, err
+	}
+
+	if price.Amount < 0 {
+		return goapi.CarPrice{}, invalidField("amount", "amount must not be negative")
+	}
+
+	if err := validateCurrency("currency", price.Currency); err != nil {
+		return goapi.CarPrice{}, err
+	}
+
+	now := time.Now()
+	if price.EffectiveFrom.IsZero() {
+		price.EffectiveFrom = now
+	}
+	if price.EffectiveFrom.Before(now.Add(-clockSkew)) {
+		return goapi.CarPrice{}, invalidField("effective_from", "effective_from must not be in the past")
+	}
+
+	price.CarID = carID
+
+	created, err := s.repo.CreateCarPrice(price)
+	switch {
+	case errors.Is(err, repository.ErrDuplicate):
+		return created, conflict("car %d already has a price taking effect at %s", carID,
+			price.EffectiveFrom.Format(time.RFC3339))
+	case errors.Is(err, repository.ErrForeignKeyViolation):
+		return created, notFound("car %d not found", carID)
+	}
+
+	return created, err
+}
+
+// GetCarPrices returns the price schedule of a car, past and future
+// prices included.
+func (s *PricingService) GetCarPrices(carID int) ([]goapi.CarPrice, error) {
+	if err := s.checkCar(carID); err != nil {
+		return nil, err
+	}
+
+	prices, err := s.repo.GetCarPrices(carID)
+	if prices == nil && err == nil {
+		prices = []goapi.CarPrice{}
+	}
+
+	return prices, err
+}
+
+func (s *PricingService) checkCar(carID int) error {
+	_, err := s.carRepo.GetByID(carID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return notFound("car %d not found", carID)
+	}
+
+	return err
+}
+
+// CreateDiscount adds a discount, or a promo code if it has a code. Codes
+// are not case-sensitive and stored in upper case.
+func (s *PricingService) CreateDiscount(discount goapi.Discount) (goapi.Discount, error) {
+	discount.Code = strings.ToUpper(discount.Code)
+
+	switch discount.Kind {
+	case goapi.DiscountPercent:
+		if discount.Value < 1 || discount.Value > 100 {
+			return goapi.Discount{}, invalidField("value", "a percent discount must be between 1 and 100")
+		}
+		if discount.Currency != "" {
+			return goapi.Discount{}, invalidField("currency", "only fixed discounts have a currency")
+		}
+	case goapi.DiscountFixed:
+		if discount.Value < 1 {
+			return goapi.Discount{}, invalidField("value", "value must be positive")
+		}
+		if err := validateCurrency("currency", discount.Currency); err != nil {
+			return goapi.Discount{}, err
+		}
+	default:
+		return goapi.Discount{}, invalidField("kind", "kind must be %s or %s", goapi.DiscountPercent, goapi.DiscountFixed)
+	}
+
+	if discount.ValidFrom != nil && discount.ValidTo != nil && !discount.ValidTo.After(*discount.ValidFrom) {
+		return goapi.Discount{}, invalidField("valid_to", "valid_to must be after valid_from")
+	}
+
+	if discount.MaxUses != nil && *discount.MaxUses < 1 {
+		return goapi.Discount{}, invalidField("max_uses", "max_uses must be positive")
+	}
+
+	if discount.CarID != nil {
+		if _, err := s.carRepo.GetByID(*discount.CarID); err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				return goapi.Discount{}, invalidField("car_id", "car %d does not exist", *discount.CarID)
+			}
+			return goapi.Discount{}, err
+		}
+	}
+
+	created, err := s.repo.CreateDiscount(discount)
+	switch {
+	case errors.Is(err, repository.ErrDuplicate):
+		return created, conflict("promo code %s already exists", discount.Code)
+	case errors.Is(err, repository.ErrForeignKeyViolation):
+		return created, invalidField("car_id", "car %d does not exist", *discount.CarID)
+	}
+
+	return created, err
+}
+
+func (s *PricingService) GetAllDiscounts(params goapi.ListParams) (goapi.Page[goapi.Discount], error) {
+	if err := checkListParams(&params, goapi.DiscountSortFields); err != nil {
+		return goapi.Page[goapi.Discount]{}, err
+	}
+
+	discounts, total, err := s.repo.GetAllDiscounts(withLookahead(params))
+	if err != nil {
+		return goapi.Page[goapi.Discount]{}, err
+	}
+
+	return newPage(discounts, total, params, func(d goapi.Discount) int { return d.DiscountID }), nil
+}
+
+func validateCurrency(field, currency string) error {
+	if !currencyPattern.MatchString(currency) {
+		return invalidField(field, "%s must be an ISO 4217 code such as EUR", field)
+	}
+
+	return nil
+}
@@ -0,0 +1,75 @@
+package service_test
+
+import (
+	"testing"
+
+	goapi "github.com/Stremilov/car-shop"
+	"github.com/Stremilov/car-shop/pkg/service"
+)
+
+func (s *shop) addDiscount(discount goapi.Discount) goapi.Discount {
+	s.t.Helper()
+
+	created, err := s.Pricing.CreateDiscount(discount)
+	if err != nil {
+		s.t.Fatalf("CreateDiscount(%+v): %v", discount, err)
+	}
+
+	return created
+}
+
+func TestBestDiscount(t *testing.T) {
+	s := newShop(t)
+	userID := s.addUser()
+	carID := s.addCar(2000000, vins...)
+
+	s.addDiscount(goapi.Discount{Kind: goapi.DiscountPercent, Value: 10})
+	s.addDiscount(goapi.Discount{Code: "SMALL5", Kind: goapi.DiscountPercent, Value: 5})
+	big := s.addDiscount(goapi.Discount{Code: "BIG", Kind: goapi.DiscountFixed, Value: 300000, Currency: "EUR"})
+	s.addDiscount(goapi.Discount{Kind: goapi.DiscountFixed, Value: 100000, Currency: "EUR", CarID: &carID})
+
+	tests := []struct {
+		promoCode     string
+		wantDiscount  int64
+		wantPromoCode string
+	}{
+		// 10% of the 1,900,000 left after the discount on the car.
+		{"", 190000, ""},
+		{"small5", 190000, ""},
+		{"big", 300000, big.Code},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.promoCode, func(t *testing.T) {
+			order := s.order(goapi.OrderInput{UserID: userID, CarID: carID, PromoCode: tt.promoCode})
+
+			if order.Subtotal != 1900000 || order.Discount != tt.wantDiscount || order.PromoCode != tt.wantPromoCode {
+				t.Errorf("got subtotal %d, discount %d and promo code %q, want 1900000, %d and %q",
+					order.Subtotal, order.Discount, order.PromoCode, tt.wantDiscount, tt.wantPromoCode)
+			}
+			if order.Total != order.Subtotal-order.Discount {
+				t.Errorf("got total %d, want %d", order.Total, order.Subtotal-order.Discount)
+			}
+		})
+	}
+}
+
+func TestPromoCodeMaxUses(t *testing.T) {
+	s := newShop(t)
+	userID := s.addUser()
+	carID := s.addCar(2000000, vins...)
+
+	maxUses := 1
+	s.addDiscount(goapi.Discount{Code: "ONCE", Kind: goapi.DiscountPercent, Value: 15, MaxUses: &maxUses})
+
+	if order := s.order(goapi.OrderInput{UserID: userID, CarID: carID, PromoCode: "ONCE"}); order.PromoCode != "ONCE" {
+		t.Fatalf("first order: got promo code %q, want ONCE", order.PromoCode)
+	}
+
+	_, err := s.Order.Create(goapi.OrderInput{UserID: userID, CarID: carID, PromoCode: "ONCE"})
+	assertKind(t, err, service.KindInvalid)
+
+	if order := s.order(goapi.OrderInput{UserID: userID, CarID: carID}); order.Discount != 0 {
+		t.Errorf("order without the code: got discount %d, want 0", order.Discount)
+	}
+}
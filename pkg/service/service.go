@@ -1,15 +1,128 @@
 package service
 
-import "github.com/Stremilov/car-shop/pkg/repository"
+import (
+	"time"
+
+	goapi "github.com/Stremilov/car-shop"
+	"github.com/Stremilov/car-shop/pkg/config"
+	"github.com/Stremilov/car-shop/pkg/patch"
+	"github.com/Stremilov/car-shop/pkg/payment"
+	"github.com/Stremilov/car-shop/pkg/repository"
+)
+
+type Authorization interface {
+	SignUp(input goapi.SignUpInput) (int, error)
+	SignIn(input goapi.SignInInput) (goapi.Tokens, error)
+	Refresh(refreshToken string) (goapi.Tokens, error)
+	Revoke(refreshToken string) error
+	ParseAccessToken(accessToken string) (goapi.Identity, error)
+	EnsureAdmin(email, password string) error
+}
 
 type User interface {
+	Create(user goapi.User) (goapi.User, error)
+	GetAll(filter goapi.UserFilter, params goapi.ListParams) (goapi.Page[goapi.User], error)
+	GetByID(userID int) (goapi.User, error)
+	GetByIDWithDeleted(userID int) (goapi.User, error)
+	ApplyPatch(user goapi.User, p patch.Patch) (goapi.UserUpdate, error)
+	Update(userID int, input goapi.UserUpdate, version int) (goapi.User, error)
+	Delete(userID int, version int) error
+	ForceDelete(userID int, version int) error
+	Restore(userID int) (goapi.User, error)
+}
+
+type Car interface {
+	Create(car goapi.Car) (goapi.Car, error)
+	GetAll(filter goapi.CarFilter, params goapi.ListParams) (goapi.Page[goapi.Car], error)
+	GetByID(carID int) (goapi.Car, error)
+	GetByIDWithDeleted(carID int) (goapi.Car, error)
+	ApplyPatch(car goapi.Car, p patch.Patch) (goapi.CarUpdate, error)
+	Update(carID int, input goapi.CarUpdate, version int) (goapi.Car, error)
+	Delete(carID int, version int) error
+	ForceDelete(carID int, version int) error
+	Restore(carID int) (goapi.Car, error)
+}
+
+type Order interface {
+	Create(input goapi.OrderInput) (goapi.Order, error)
+	GetAll(filter goapi.OrderFilter, params goapi.ListParams) (goapi.Page[goapi.Order], error)
+	GetByID(orderID int) (goapi.Order, error)
+	GetByIDWithDeleted(orderID int) (goapi.Order, error)
+	GetByUserID(userID int) ([]goapi.Order, error)
+	ApplyPatch(order goapi.Order, p patch.Patch) (goapi.OrderUpdate, error)
+	SetStatus(orderID int, status goapi.OrderStatus, changedBy int, note string) (goapi.Order, error)
+	GetHistory(orderID int) ([]goapi.OrderStatusChange, error)
+	Delete(orderID int) error
+	Restore(orderID int) (goapi.Order, error)
+}
+
+type Extra interface {
+	Create(extra goapi.Extra) (goapi.Extra, error)
+	GetAll(params goapi.ListParams) (goapi.Page[goapi.Extra], error)
+	GetByID(extraID int) (goapi.Extra, error)
+}
 
+type Pricing interface {
+	AddCarPrice(carID int, price goapi.CarPrice) (goapi.CarPrice, error)
+	GetCarPrices(carID int) ([]goapi.CarPrice, error)
+	CreateDiscount(discount goapi.Discount) (goapi.Discount, error)
+	GetAllDiscounts(params goapi.ListParams) (goapi.Page[goapi.Discount], error)
+}
+
+type Payment interface {
+	Pay(orderID int, idempotencyKey string, input goapi.PaymentInput, payerID int) (goapi.Payment, bool, error)
+	GetByID(paymentID int) (goapi.Payment, error)
+	GetByOrderID(orderID int) ([]goapi.Payment, error)
+	Capture(paymentID int, changedBy int) (goapi.Payment, error)
+	Refund(paymentID int, changedBy int) (goapi.Payment, error)
+	VerifyWebhook(body []byte, signature string) bool
+	HandleEvent(event payment.Event) (goapi.Payment, error)
+}
+
+type Idempotency interface {
+	Begin(userID int, key, fingerprint string) (goapi.IdempotentRequest, bool, error)
+	Complete(request goapi.IdempotentRequest) error
+	Abandon(request goapi.IdempotentRequest) error
+}
+
+type Trash interface {
+	Purge(now time.Time) (Purged, error)
+}
+
+type Inventory interface {
+	Create(vehicle goapi.Vehicle) (goapi.Vehicle, error)
+	GetAll(filter goapi.VehicleFilter, params goapi.ListParams) (goapi.Page[goapi.Vehicle], error)
+	GetByID(vehicleID int) (goapi.Vehicle, error)
+	SetStatus(vehicleID int, status goapi.VehicleStatus) (goapi.Vehicle, error)
+	GetStock(carID *int) ([]goapi.Stock, error)
 }
 
 type Service struct {
+	Authorization
 	User
+	Car
+	Order
+	Extra
+	Pricing
+	Payment
+	Idempotency
+	Trash
+	Inventory
 }
 
-func NewService(repos *repository.Repository) *Service{
-	return &Service{}
-}
\ No newline at end of file
+func NewService(repos *repository.Repository, cfg *config.Config) *Service {
+	orders := NewOrderService(repos.Order, repos.User, repos.Car, repos.Extra, repos.Pricing, repos.Payment, cfg.Deletion.Orders)
+
+	return &Service{
+		Authorization: NewAuthService(repos.Authorization, repos.User, cfg.Auth),
+		User:          NewUserService(repos.User, repos.Order, cfg.Deletion.Users),
+		Car:           NewCarService(repos.Car, repos.Order, cfg.Deletion.Cars),
+		Order:         orders,
+		Extra:         NewExtraService(repos.Extra),
+		Pricing:       NewPricingService(repos.Pricing, repos.Car),
+		Payment:       NewPaymentService(repos.Payment, orders, newPaymentProvider(cfg.Payment), cfg.Payment.WebhookSecret),
+		Idempotency:   NewIdempotencyService(repos.Idempotency, cfg.HTTP.IdempotencyTTL),
+		Trash:         NewTrashService(repos.User, repos.Car, repos.Order, cfg.Deletion.Retention),
+		Inventory:     NewInventoryService(repos.Inventory, repos.Car),
+	}
+}
@@ -0,0 +1,52 @@
+package service
+
+import (
+	"time"
+
+	"github.com/Stremilov/car-shop/pkg/repository"
+)
+
+// Purged counts the records a purge removed for good.
+type Purged struct {
+	Users  int
+	Cars   int
+	Orders int
+}
+
+type TrashService struct {
+	userRepo  repository.User
+	carRepo   repository.Car
+	orderRepo repository.Order
+	retention time.Duration
+}
+
+func NewTrashService(userRepo repository.User, carRepo repository.Car, orderRepo repository.Order, retention time.Duration) *TrashService {
+	return &TrashService{userRepo: userRepo, carRepo: carRepo, orderRepo: orderRepo, retention: retention}
+}
+
+// Purge removes the users, cars and orders that were soft deleted longer
+// than the retention before now for good. Records something still refers
+// to are kept: orders with payments, and users and cars with orders. The
+// orders go first, so that the users and cars only they referred to can
+// go too. Without a retention nothing is ever purged.
+func (s *TrashService) Purge(now time.Time) (Purged, error) {
+	var purged Purged
+	if s.retention == 0 {
+		return purged, nil
+	}
+
+	deletedBefore := now.Add(-s.retention)
+
+	var err error
+	if purged.Orders, err = s.orderRepo.Purge(deletedBefore); err != nil {
+		return purged, err
+	}
+
+	if purged.Users, err = s.userRepo.Purge(deletedBefore); err != nil {
+		return purged, err
+	}
+
+	purged.Cars, err = s.carRepo.Purge(deletedBefore)
+
+	return purged, err
+}
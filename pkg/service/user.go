@@ -0,0 +1,240 @@
+package service
+
+import (
+	"errors"
+	"strings"
+
+	goapi "github.com/Stremilov/car-shop"
+	"github.com/Stremilov/car-shop/pkg/config"
+	"github.com/Stremilov/car-shop/pkg/patch"
+	"github.com/Stremilov/car-shop/pkg/repository"
+)
+
+const (
+	maxNameLength = 50
+	maxAge        = 150
+)
+
+type UserService struct {
+	repo         repository.User
+	orderRepo    repository.Order
+	deletePolicy config.DeletePolicy
+}
+
+func NewUserService(repo repository.User, orderRepo repository.Order, deletePolicy config.DeletePolicy) *UserService {
+	return &UserService{repo: repo, orderRepo: orderRepo, deletePolicy: deletePolicy}
+}
+
+func (s *UserService) Create(user goapi.User) (goapi.User, error) {
+	if err := validateName("first_name", user.FirstName); err != nil {
+		return goapi.User{}, err
+	}
+
+	if err := validateName("last_name", user.LastName); err != nil {
+		return goapi.User{}, err
+	}
+
+	if err := validateAge(user.Age); err != nil {
+		return goapi.User{}, err
+	}
+
+	if user.Role == "" {
+		user.Role = goapi.RoleCustomer
+	}
+
+	if err := validateRole(user.Role); err != nil {
+		return goapi.User{}, err
+	}
+
+	return s.repo.Create(user)
+}
+
+func (s *UserService) GetAll(filter goapi.UserFilter, params goapi.ListParams) (goapi.Page[goapi.User], error) {
+	if err := checkListParams(&params, goapi.UserSortFields); err != nil {
+		return goapi.Page[goapi.User]{}, err
+	}
+
+	if filter.Role != "" {
+		if err := validateRole(filter.Role); err != nil {
+			return goapi.Page[goapi.User]{}, err
+		}
+	}
+
+	if filter.AgeMin != nil && filter.AgeMax != nil && *filter.AgeMin > *filter.AgeMax {
+		return goapi.Page[goapi.User]{}, invalid("age_min must not be greater than age_max")
+	}
+
+	people, total, err := s.repo.GetAll(filter, withLookahead(params))
+	if err != nil {
+		return goapi.Page[goapi.User]{}, err
+	}
+
+	return newPage(people, total, params, func(u goapi.User) int { return u.UserID }), nil
+}
+
+func (s *UserService) GetByID(userID int) (goapi.User, error) {
+	user, err := s.repo.GetByID(userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return user, notFound("user %d not found", userID)
+	}
+
+	return user, err
+}
+
+// GetByIDWithDeleted is GetByID that also finds soft deleted users.
+func (s *UserService) GetByIDWithDeleted(userID int) (goapi.User, error) {
+	user, err := s.repo.GetByID(userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		user, err = s.repo.GetDeleted(userID)
+	}
+	if errors.Is(err, repository.ErrNotFound) {
+		return user, notFound("user %d not found", userID)
+	}
+
+	return user, err
+}
+
+// Update changes the user and returns them. Unless version is 0, the user
+// has to be at that version.
+func (s *UserService) Update(userID int, input goapi.UserUpdate, version int) (goapi.User, error) {
+	if err := input.Validate(); err != nil {
+		return goapi.User{}, invalid("%s", err)
+	}
+
+	if input.FirstName != nil {
+		if err := validateName("first_name", *input.FirstName); err != nil {
+			return goapi.User{}, err
+		}
+	}
+
+	if input.LastName != nil {
+		if err := validateName("last_name", *input.LastName); err != nil {
+			return goapi.User{}, err
+		}
+	}
+
+	if input.Age != nil {
+		if err := validateAge(*input.Age); err != nil {
+			return goapi.User{}, err
+		}
+	}
+
+	if input.Role != nil {
+		if err := validateRole(*input.Role); err != nil {
+			return goapi.User{}, err
+		}
+	}
+
+	user, err := s.repo.Update(userID, input, version)
+
+	return user, userWriteError(err, userID, version)
+}
+
+// ApplyPatch applies p to the fields of user that can be changed and
+// returns the changes it makes as an update for Update. Clearing the age
+// sets it to 0 and clearing the role makes the user a customer, as for a
+// user created without them; the names are required.
+func (s *UserService) ApplyPatch(user goapi.User, p patch.Patch) (goapi.UserUpdate, error) {
+	fields := goapi.UserUpdate{FirstName: &user.FirstName, LastName: &user.LastName, Age: &user.Age, Role: &user.Role}
+
+	var update goapi.UserUpdate
+	err := applyPatch(fields, p, &update, map[string]interface{}{"age": 0, "role": goapi.RoleCustomer})
+
+	return update, err
+}
+
+// Delete deletes a user the way the deletion policy says: for good unless
+// they have orders, in which case the conflict lists the orders, or softly.
+// Unless version is 0, the user has to be at that version.
+func (s *UserService) Delete(userID int, version int) error {
+	if s.deletePolicy == config.DeleteSoft {
+		return userWriteError(s.repo.SoftDelete(userID, version), userID, version)
+	}
+
+	err := s.repo.Delete(userID, version)
+	if errors.Is(err, repository.ErrForeignKeyViolation) {
+		orderIDs, err := s.orderRepo.GetIDsByUserID(userID)
+		if err != nil {
+			return err
+		}
+		return conflictWith(blockingOrders{OrderIDs: orderIDs}, "user %d has orders and cannot be deleted", userID)
+	}
+
+	return userWriteError(err, userID, version)
+}
+
+// ForceDelete deletes a user for good together with their orders, whatever
+// the deletion policy. Orders with payments cannot be deleted though.
+// Unless version is 0, the user has to be at that version.
+func (s *UserService) ForceDelete(userID int, version int) error {
+	err := s.repo.DeleteCascade(userID, version)
+	if errors.Is(err, repository.ErrForeignKeyViolation) {
+		return conflict("orders of user %d have payments and cannot be deleted", userID)
+	}
+
+	return userWriteError(err, userID, version)
+}
+
+// userWriteError maps the errors of a write to the user at version.
+func userWriteError(err error, userID, version int) error {
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		return notFound("user %d not found", userID)
+	case errors.Is(err, repository.ErrVersionMismatch):
+		return preconditionFailed("user %d has changed since version %d", userID, version)
+	}
+
+	return err
+}
+
+// Restore brings back a soft deleted user and returns them. Their refresh
+// tokens stay revoked, so they have to sign in again.
+func (s *UserService) Restore(userID int) (goapi.User, error) {
+	err := s.repo.Restore(userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		if _, err := s.GetByID(userID); err != nil {
+			return goapi.User{}, err
+		}
+		return goapi.User{}, conflict("user %d is not deleted", userID)
+	}
+	if err != nil {
+		return goapi.User{}, err
+	}
+
+	return s.GetByID(userID)
+}
+
+// blockingOrders are the details of a conflict about the orders that keep
+// a record from being deleted.
+type blockingOrders struct {
+	OrderIDs []int `json:"order_ids"`
+}
+
+func validateName(field, name string) error {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return invalidField(field, "%s must not be empty", field)
+	}
+
+	if len([]rune(name)) > maxNameLength {
+		return invalidField(field, "%s must be at most %d characters long", field, maxNameLength)
+	}
+
+	return nil
+}
+
+func validateAge(age int) error {
+	if age < 0 || age > maxAge {
+		return invalidField("age", "age must be between 0 and %d", maxAge)
+	}
+
+	return nil
+}
+
+func validateRole(role goapi.Role) error {
+	if !role.Valid() {
+		return invalidField("role", "role must be one of %s, %s or %s", goapi.RoleCustomer, goapi.RoleSales, goapi.RoleAdmin)
+	}
+
+	return nil
+}
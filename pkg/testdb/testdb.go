@@ -0,0 +1,90 @@
+// Package testdb gives tests a Postgres schema of their own in the database
+// the CARSHOP_TEST_DB_DSN variable points to. Tests that need one are
+// skipped without it, so that the rest run anywhere:
+//
+//	CARSHOP_TEST_DB_DSN="user=carshop password=... dbname=carshop_test sslmode=disable" go test ./...
+package testdb
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	_ "github.com/lib/pq"
+)
+
+// DSNEnv names the variable with the connection string of the test
+// database.
+const DSNEnv = "CARSHOP_TEST_DB_DSN"
+
+// New returns a connection to a new, empty schema in the test database,
+// which is dropped with everything in it once t is done. It skips t if
+// there is no test database.
+func New(t testing.TB) *sql.DB {
+	t.Helper()
+
+	dsn := os.Getenv(DSNEnv)
+	if dsn == "" {
+		t.Skipf("%s is not set", DSNEnv)
+	}
+
+	admin, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { admin.Close() })
+
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		t.Fatal(err)
+	}
+	schema := "test_" + hex.EncodeToString(b[:])
+
+	if _, err := admin.Exec(`CREATE SCHEMA ` + schema); err != nil {
+		t.Fatalf("create schema: %v", err)
+	}
+	t.Cleanup(func() {
+		if _, err := admin.Exec(`DROP SCHEMA ` + schema + ` CASCADE`); err != nil {
+			t.Errorf("drop schema %s: %v", schema, err)
+		}
+	})
+
+	dsn, err = withSearchPath(dsn, schema)
+	if err != nil {
+		t.Fatalf("%s: %v", DSNEnv, err)
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if err := db.Ping(); err != nil {
+		t.Fatalf("connect to the test database: %v", err)
+	}
+
+	return db
+}
+
+// withSearchPath returns dsn, as a URL or as key=value pairs, with the
+// search path set to schema on every connection.
+func withSearchPath(dsn, schema string) (string, error) {
+	if !strings.HasPrefix(dsn, "postgres://") && !strings.HasPrefix(dsn, "postgresql://") {
+		return dsn + " search_path=" + schema, nil
+	}
+
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	q.Set("search_path", schema)
+	u.RawQuery = q.Encode()
+
+	return u.String(), nil
+}
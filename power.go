@@ -0,0 +1,143 @@
+package goapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+type PowerUnit string
+
+const (
+	PowerUnitHP PowerUnit = "hp"
+	PowerUnitKW PowerUnit = "kW"
+)
+
+// DefaultPowerUnit is used when a client does not name a unit.
+const DefaultPowerUnit = PowerUnitHP
+
+// Watts per unit. The horsepower is the mechanical one.
+const (
+	wattsPerHP = 745.69987158227022
+	wattsPerKW = 1000
+)
+
+// ParsePowerUnit accepts a unit name in any letter case.
+func ParsePowerUnit(s string) (PowerUnit, error) {
+	switch {
+	case strings.EqualFold(s, string(PowerUnitHP)):
+		return PowerUnitHP, nil
+	case strings.EqualFold(s, string(PowerUnitKW)):
+		return PowerUnitKW, nil
+	}
+
+	return "", fmt.Errorf("power unit must be %s or %s", PowerUnitHP, PowerUnitKW)
+}
+
+func (u PowerUnit) Valid() bool {
+	return u == PowerUnitHP || u == PowerUnitKW
+}
+
+func (u PowerUnit) watts() float64 {
+	if u == PowerUnitKW {
+		return wattsPerKW
+	}
+
+	return wattsPerHP
+}
+
+// Power is an engine power in either unit. It is stored in whole watts, so
+// converting between units on the way in and out loses nothing visible.
+type Power struct {
+	Value float64   `json:"value" binding:"gt=0" example:"150"`
+	Unit  PowerUnit `json:"unit" binding:"oneof=hp kW" enums:"hp,kW" example:"hp"`
+}
+
+// PowerFromWatts returns w in the default unit.
+func PowerFromWatts(w int64) Power {
+	return Power{Value: float64(w) / DefaultPowerUnit.watts(), Unit: DefaultPowerUnit}
+}
+
+// Watts returns the power in whole watts.
+func (p Power) Watts() int64 {
+	return int64(math.Round(p.Value * p.Unit.watts()))
+}
+
+// In converts p to unit.
+func (p Power) In(unit PowerUnit) Power {
+	return Power{Value: p.Value * p.Unit.watts() / unit.watts(), Unit: unit}
+}
+
+// MarshalJSON rounds the value to two decimals; conversions leave long
+// fractions that mean nothing to a client.
+func (p Power) MarshalJSON() ([]byte, error) {
+	type power Power
+	return json.Marshal(power{Value: math.Round(p.Value*100) / 100, Unit: p.Unit})
+}
+
+// UnmarshalJSON accepts {"value": 110, "unit": "kW"} as well as the older
+// bare forms 150 and "150", which are horsepower, and "110 kW". A unit it
+// does not know is kept as is for validation to report.
+func (p *Power) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+
+	switch {
+	case bytes.HasPrefix(data, []byte("{")):
+		var v struct {
+			Value float64 `json:"value"`
+			Unit  string  `json:"unit"`
+		}
+		if err := json.Unmarshal(data, &v); err != nil {
+			return err
+		}
+		p.Value, p.Unit = v.Value, unitOrDefault(v.Unit)
+	case bytes.HasPrefix(data, []byte(`"`)):
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		return p.parse(s)
+	default:
+		value, err := strconv.ParseFloat(string(data), 64)
+		if err != nil {
+			return fmt.Errorf("invalid power %s", data)
+		}
+		p.Value, p.Unit = value, DefaultPowerUnit
+	}
+
+	return nil
+}
+
+// parse reads "150", "150hp" or "110 kW".
+func (p *Power) parse(s string) error {
+	s = strings.TrimSpace(s)
+	end := strings.IndexFunc(s, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.' && r != '-' && r != '+'
+	})
+	if end < 0 {
+		end = len(s)
+	}
+
+	value, err := strconv.ParseFloat(s[:end], 64)
+	if err != nil {
+		return fmt.Errorf("invalid power %q", s)
+	}
+
+	p.Value, p.Unit = value, unitOrDefault(strings.TrimSpace(s[end:]))
+	return nil
+}
+
+func unitOrDefault(s string) PowerUnit {
+	if s == "" {
+		return DefaultPowerUnit
+	}
+
+	if unit, err := ParsePowerUnit(s); err == nil {
+		return unit
+	}
+
+	return PowerUnit(s)
+}
@@ -0,0 +1,116 @@
+package goapi
+
+import "time"
+
+// Money is an amount in the minor unit of Currency, such as cents.
+type Money struct {
+	Amount   int64  `json:"amount" example:"2500000"`
+	Currency string `json:"currency" example:"EUR"`
+}
+
+// CarPrice is the list price of a car from EffectiveFrom on, until the next
+// price of the car takes effect. EffectiveFrom defaults to now. Amount is
+// in cents.
+type CarPrice struct {
+	PriceID       int       `json:"price_id" readonly:"true"`
+	CarID         int       `json:"car_id" readonly:"true"`
+	Amount        int64     `json:"amount" binding:"min=0" example:"2500000"`
+	Currency      string    `json:"currency" binding:"required,iso4217" example:"EUR"`
+	EffectiveFrom time.Time `json:"effective_from"`
+	CreatedAt     time.Time `json:"created_at" readonly:"true"`
+}
+
+type DiscountKind string
+
+const (
+	DiscountPercent DiscountKind = "percent"
+	DiscountFixed   DiscountKind = "fixed"
+)
+
+// Discount takes Value percent, or Value cents in Currency, off the price
+// of every vehicle of CarID or, without a CarID, off the whole order.
+// Discounts with a Code are promo codes and only apply when the code is
+// given with the order; the others apply to every order while they are
+// valid.
+type Discount struct {
+	DiscountID int          `json:"discount_id" readonly:"true"`
+	Code       string       `json:"code,omitempty" binding:"omitempty,max=30,alphanum" example:"SPRING10"`
+	Kind       DiscountKind `json:"kind" binding:"required,oneof=percent fixed"`
+	Value      int64        `json:"value" binding:"required,min=1" example:"10"`
+	Currency   string       `json:"currency,omitempty" binding:"omitempty,iso4217"`
+	CarID      *int         `json:"car_id,omitempty" binding:"omitempty,min=1"`
+	ValidFrom  *time.Time   `json:"valid_from,omitempty"`
+	ValidTo    *time.Time   `json:"valid_to,omitempty"`
+	MaxUses    *int         `json:"max_uses,omitempty" binding:"omitempty,min=1"`
+	Uses       int          `json:"uses" readonly:"true"`
+	CreatedAt  time.Time    `json:"created_at" readonly:"true"`
+}
+
+// DiscountSortFields lists the fields the discounts list can be sorted by.
+var DiscountSortFields = []string{"id", "code", "valid_from", "valid_to"}
+
+// ValidAt reports whether the discount may be used at t.
+func (d Discount) ValidAt(t time.Time) bool {
+	if d.ValidFrom != nil && t.Before(*d.ValidFrom) {
+		return false
+	}
+	if d.ValidTo != nil && !t.Before(*d.ValidTo) {
+		return false
+	}
+
+	return d.MaxUses == nil || d.Uses < *d.MaxUses
+}
+
+// Off returns how much the discount takes off price, in the currency of
+// price. Percentages are rounded down, and no discount takes off more than
+// the price.
+func (d Discount) Off(price int64) int64 {
+	off := d.Value
+	if d.Kind == DiscountPercent {
+		off = price * d.Value / 100
+	}
+
+	return min(off, price)
+}
+
+// PricedOrder is an order ready to be stored, with the price of every item
+// and the discounts worked out.
+type PricedOrder struct {
+	UserID   int
+	Currency string
+	Items    []PricedItem
+	// Discount is taken off the whole order by DiscountID.
+	Discount   int64
+	DiscountID int
+	PromoCode  string
+}
+
+// PricedItem is Quantity of a car or an extra. UnitPrice is ListPrice less
+// the discount DiscountID gives on it.
+type PricedItem struct {
+	CarID      int
+	ExtraID    int
+	Quantity   int
+	ListPrice  int64
+	UnitPrice  int64
+	DiscountID int
+}
+
+// DiscountIDs lists the discounts the order uses, each once.
+func (o PricedOrder) DiscountIDs() []int {
+	var ids []int
+	seen := make(map[int]bool)
+	add := func(id int) {
+		if id != 0 && !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+
+	for _, item := range o.Items {
+		add(item.DiscountID)
+	}
+	add(o.DiscountID)
+
+	return ids
+}
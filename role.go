@@ -0,0 +1,68 @@
+package goapi
+
+type Role string
+
+const (
+	RoleCustomer Role = "customer"
+	RoleSales    Role = "sales"
+	RoleAdmin    Role = "admin"
+)
+
+func (r Role) Valid() bool {
+	_, ok := policy[r]
+	return ok
+}
+
+type Permission string
+
+const (
+	// PermManageUsers allows creating, listing, updating and deleting any
+	// user. Everyone may read and update their own profile.
+	PermManageUsers Permission = "users:manage"
+	PermReadCars    Permission = "cars:read"
+	// PermManageCars also covers the inventory of vehicles.
+	PermManageCars Permission = "cars:manage"
+	// PermManagePricing allows setting car prices and managing
+	// discounts and promo codes.
+	PermManagePricing Permission = "pricing:manage"
+	// PermCreateOrders allows placing orders for oneself.
+	PermCreateOrders Permission = "orders:create"
+	// PermManageOrders allows reading, placing and deleting orders of any
+	// user. Without it only one's own orders are accessible.
+	PermManageOrders Permission = "orders:manage"
+	// PermForceDelete allows deleting users and cars together with
+	// everything that refers to them, whatever the deletion policy.
+	PermForceDelete Permission = "data:force_delete"
+	// PermManageDeleted allows seeing and restoring soft deleted users,
+	// cars and orders.
+	PermManageDeleted Permission = "data:manage_deleted"
+)
+
+var policy = map[Role][]Permission{
+	RoleCustomer: {PermReadCars, PermCreateOrders},
+	RoleSales:    {PermReadCars, PermManageCars, PermManagePricing, PermCreateOrders, PermManageOrders},
+	RoleAdmin: {PermManageUsers, PermReadCars, PermManageCars, PermManagePricing, PermCreateOrders, PermManageOrders,
+		PermForceDelete, PermManageDeleted},
+}
+
+func (r Role) Can(p Permission) bool {
+	for _, granted := range policy[r] {
+		if granted == p {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Identity is the authenticated caller of a request.
+type Identity struct {
+	UserID int
+	Role   Role
+}
+
+// CanAccessUser reports whether the caller may act on the data of userID
+// given the permission that covers other users' data.
+func (i Identity) CanAccessUser(userID int, p Permission) bool {
+	return i.UserID == userID || i.Role.Can(p)
+}
@@ -3,25 +3,48 @@ package goapi
 import (
 	"context"
 	"net/http"
-	"time"
+	"sync"
+
+	"github.com/Stremilov/car-shop/pkg/config"
 )
 
 type Server struct {
+	mu         sync.Mutex
 	httpServer *http.Server
+	stopped    bool
 }
 
-func (s *Server) Run(port string, handler http.Handler) error {
+func (s *Server) Run(cfg config.HTTP, handler http.Handler) error {
+	s.mu.Lock()
+	if s.stopped {
+		s.mu.Unlock()
+		return http.ErrServerClosed
+	}
+
 	s.httpServer = &http.Server{
-		Addr:           ":" + port,
+		Addr:           ":" + cfg.Port,
 		Handler:        handler,
-		MaxHeaderBytes: 1 << 20,
-		ReadTimeout:    10 * time.Second,
-		WriteTimeout:   10 * time.Second,
+		MaxHeaderBytes: cfg.MaxHeaderBytes,
+		ReadTimeout:    cfg.ReadTimeout,
+		WriteTimeout:   cfg.WriteTimeout,
 	}
+	httpServer := s.httpServer
+	s.mu.Unlock()
 
-	return s.httpServer.ListenAndServe()
+	return httpServer.ListenAndServe()
 }
 
+// ShutDown stops accepting new connections and waits for in-flight requests
+// until ctx is done. It is safe to call before or concurrently with Run.
 func (s *Server) ShutDown(ctx context.Context) error {
-	return s.httpServer.Shutdown(ctx)
+	s.mu.Lock()
+	s.stopped = true
+	httpServer := s.httpServer
+	s.mu.Unlock()
+
+	if httpServer == nil {
+		return nil
+	}
+
+	return httpServer.Shutdown(ctx)
 }
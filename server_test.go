@@ -0,0 +1,98 @@
+package goapi
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Stremilov/car-shop/pkg/config"
+)
+
+func TestShutDownDrainsInFlightRequests(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := strconv.Itoa(l.Addr().(*net.TCPAddr).Port)
+	l.Close()
+
+	started := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			close(started)
+			time.Sleep(300 * time.Millisecond)
+		}
+		io.WriteString(w, "done")
+	})
+
+	server := new(Server)
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- server.Run(config.HTTP{
+			Port:           port,
+			ReadTimeout:    time.Second,
+			WriteTimeout:   time.Second,
+			MaxHeaderBytes: 1 << 20,
+		}, handler)
+	}()
+
+	base := "http://127.0.0.1:" + port
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		resp, err := http.Get(base + "/")
+		if err == nil {
+			resp.Body.Close()
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("server did not start")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	type result struct {
+		body string
+		err  error
+	}
+	slow := make(chan result, 1)
+	go func() {
+		resp, err := http.Get(base + "/slow")
+		if err != nil {
+			slow <- result{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		slow <- result{body: string(body), err: err}
+	}()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.ShutDown(ctx); err != nil {
+		t.Fatalf("ShutDown: %v", err)
+	}
+
+	if res := <-slow; res.err != nil || res.body != "done" {
+		t.Fatalf("in-flight request got %q, %v; want \"done\", nil", res.body, res.err)
+	}
+
+	if err := <-runErr; err != http.ErrServerClosed {
+		t.Fatalf("Run returned %v, want http.ErrServerClosed", err)
+	}
+}
+
+func TestShutDownBeforeRun(t *testing.T) {
+	server := new(Server)
+	if err := server.ShutDown(context.Background()); err != nil {
+		t.Fatalf("ShutDown: %v", err)
+	}
+
+	if err := server.Run(config.HTTP{Port: "0"}, http.NotFoundHandler()); err != http.ErrServerClosed {
+		t.Fatalf("Run after ShutDown returned %v, want http.ErrServerClosed", err)
+	}
+}
@@ -0,0 +1,48 @@
+package goapi
+
+import (
+	"errors"
+	"time"
+)
+
+type User struct {
+	UserID    int       `json:"user_id" readonly:"true"`
+	FirstName string    `json:"first_name" binding:"required,max=50"`
+	LastName  string    `json:"last_name" binding:"required,max=50"`
+	Age       int       `json:"age" binding:"min=0,max=150"`
+	Role      Role      `json:"role" binding:"omitempty,oneof=customer sales admin"`
+	CreatedAt time.Time `json:"created_at" readonly:"true"`
+	UpdatedAt time.Time `json:"updated_at" readonly:"true"`
+	// DeletedAt is set once the user is soft deleted. Orders keep showing
+	// the users they were placed by.
+	DeletedAt *time.Time `json:"deleted_at,omitempty" readonly:"true"`
+	// Version is bumped on every change to the user. It is their ETag.
+	Version int `json:"version" readonly:"true"`
+}
+
+// UserSortFields lists the fields the users list can be sorted by.
+var UserSortFields = []string{"id", "first_name", "last_name", "age", "role"}
+
+type UserFilter struct {
+	AgeMin  *int
+	AgeMax  *int
+	Role    Role
+	Deleted Deleted
+}
+
+// UserUpdate holds the fields of a user to change; nil fields stay as they
+// are.
+type UserUpdate struct {
+	FirstName *string `json:"first_name,omitempty" binding:"omitempty,min=1,max=50"`
+	LastName  *string `json:"last_name,omitempty" binding:"omitempty,min=1,max=50"`
+	Age       *int    `json:"age,omitempty" binding:"omitempty,min=0,max=150"`
+	Role      *Role   `json:"role,omitempty" binding:"omitempty,oneof=customer sales admin"`
+}
+
+func (i UserUpdate) Validate() error {
+	if i.FirstName == nil && i.LastName == nil && i.Age == nil && i.Role == nil {
+		return errors.New("no fields to update")
+	}
+
+	return nil
+}
@@ -0,0 +1,88 @@
+package goapi
+
+import (
+	"regexp"
+	"strings"
+	"time"
+)
+
+// VehicleStatus is where a single vehicle is in its life at the shop.
+type VehicleStatus string
+
+const (
+	VehicleInStock   VehicleStatus = "in_stock"
+	VehicleReserved  VehicleStatus = "reserved"
+	VehicleSold      VehicleStatus = "sold"
+	VehicleInTransit VehicleStatus = "in_transit"
+)
+
+func (s VehicleStatus) Valid() bool {
+	switch s {
+	case VehicleInStock, VehicleReserved, VehicleSold, VehicleInTransit:
+		return true
+	}
+
+	return false
+}
+
+// Vehicle is one physical unit of a car model, identified by its VIN.
+type Vehicle struct {
+	VehicleID int           `json:"vehicle_id" readonly:"true"`
+	CarID     int           `json:"car_id" binding:"required,min=1"`
+	VIN       string        `json:"vin" binding:"required,vin" example:"1HGCM82633A004352"`
+	Status    VehicleStatus `json:"status" binding:"omitempty,oneof=in_stock in_transit" enums:"in_stock,reserved,sold,in_transit"`
+	CreatedAt time.Time     `json:"created_at" readonly:"true"`
+	UpdatedAt time.Time     `json:"updated_at" readonly:"true"`
+}
+
+// vinPattern is 17 characters out of digits and capital letters, except I,
+// O and Q, which look too much like 1 and 0.
+var vinPattern = regexp.MustCompile(`^[A-HJ-NPR-Z0-9]{17}$`)
+
+// NormalizeVIN returns vin in the canonical form it is stored in.
+func NormalizeVIN(vin string) string {
+	return strings.ToUpper(strings.TrimSpace(vin))
+}
+
+// ValidVIN reports whether vin is well-formed, in any letter case.
+func ValidVIN(vin string) bool {
+	return vinPattern.MatchString(NormalizeVIN(vin))
+}
+
+// VehicleSortFields lists the fields the vehicles list can be sorted by.
+var VehicleSortFields = []string{"id", "car_id", "vin", "status"}
+
+type VehicleFilter struct {
+	CarID  *int
+	Status VehicleStatus
+}
+
+type VehicleStatusInput struct {
+	Status VehicleStatus `json:"status" binding:"required,oneof=in_stock in_transit"`
+}
+
+// Stock counts the vehicles of one car model by status. InStock is what can
+// be ordered right now.
+type Stock struct {
+	CarID     int `json:"car_id"`
+	InStock   int `json:"in_stock"`
+	Reserved  int `json:"reserved"`
+	Sold      int `json:"sold"`
+	InTransit int `json:"in_transit"`
+	Total     int `json:"total"`
+}
+
+// Count adds one vehicle in status to the stock.
+func (s *Stock) Count(status VehicleStatus) {
+	switch status {
+	case VehicleInStock:
+		s.InStock++
+	case VehicleReserved:
+		s.Reserved++
+	case VehicleSold:
+		s.Sold++
+	case VehicleInTransit:
+		s.InTransit++
+	}
+	s.Total++
+}